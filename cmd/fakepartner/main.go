@@ -0,0 +1,32 @@
+// fakepartner runs the fake third-party processor on its own, point the bank at it with
+// THIRD_PARTY_CLIENT=http and THIRD_PARTY_BASE_URL=http://localhost:8081
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+
+	"github.com/midedickson/simple-banking-app/fakepartner"
+)
+
+func main() {
+	addr := flag.String("addr", ":8081", "address to listen on")
+	callbackURL := flag.String("callback-url", "", "where processed transactions are confirmed, none when empty")
+	callbackSecret := flag.String("callback-secret", "", "shared secret callbacks are signed with, the bank's PARTNER_WEBHOOK_SECRET")
+	var faults fakepartner.Faults
+	flag.DurationVar(&faults.Latency, "latency", 0, "delay added to every request")
+	flag.DurationVar(&faults.Stall, "stall", 0, "hold every request this long and answer 504")
+	flag.IntVar(&faults.FailNext, "fail-next", 0, "refuse the next n requests")
+	flag.Float64Var(&faults.FailRate, "fail-rate", 0, "share of requests refused, between 0 and 1")
+	flag.IntVar(&faults.FailStatus, "fail-status", http.StatusInternalServerError, "status of refused requests")
+	flag.IntVar(&faults.AcceptThenFail, "accept-then-fail", 0, "store the next n transactions but answer with the fail status")
+	flag.IntVar(&faults.DeclineNext, "decline-next", 0, "confirm the next n transactions as failed")
+	flag.BoolVar(&faults.DropCallbacks, "drop-callbacks", false, "never confirm accepted transactions")
+	flag.Parse()
+
+	partner := fakepartner.NewPartner(*callbackURL, *callbackSecret)
+	partner.SetFaults(faults)
+	log.Printf("Starting fake partner on %s...", *addr)
+	log.Fatal(http.ListenAndServe(*addr, partner))
+}
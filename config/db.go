@@ -23,7 +23,7 @@ func ConnectToDB() {
 
 func AutoMigrate() {
 	log.Println("Auto Migrating Models...")
-	err := DB.AutoMigrate(&models.Transaction{})
+	err := DB.AutoMigrate(&models.Transaction{}, &models.UserAccount{}, &models.JournalEntry{}, &models.Posting{}, &models.IdempotencyKey{}, &models.OutboxEntry{}, &models.WebhookEvent{}, &models.ReconciliationReport{}, &models.ReconciliationItem{}, &models.SettlementImport{}, &models.SettlementEntry{}, &models.SuspenseItem{}, &models.Hold{}, &models.FXQuote{})
 	if err != nil {
 		panic(err)
 	}
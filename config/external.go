@@ -0,0 +1,121 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/midedickson/simple-banking-app/external"
+	mock_client "github.com/midedickson/simple-banking-app/mock"
+)
+
+// reads where the third party lives, starting from external.DefaultClientSettings:
+// THIRD_PARTY_BASE_URL, THIRD_PARTY_TIMEOUT, THIRD_PARTY_CONNECT_TIMEOUT and
+// THIRD_PARTY_HEADERS (comma separated Name=value pairs)
+func NewClientSettings() (external.ClientSettings, error) {
+	settings := external.DefaultClientSettings()
+	settings.BaseURL = getEnv("THIRD_PARTY_BASE_URL", settings.BaseURL)
+	var err error
+	if settings.Timeout, err = getDurationEnv("THIRD_PARTY_TIMEOUT", settings.Timeout); err != nil {
+		return settings, err
+	}
+	if settings.ConnectTimeout, err = getDurationEnv("THIRD_PARTY_CONNECT_TIMEOUT", settings.ConnectTimeout); err != nil {
+		return settings, err
+	}
+	if rawHeaders := getEnv("THIRD_PARTY_HEADERS", ""); rawHeaders != "" {
+		settings.Headers = map[string]string{}
+		for _, rawHeader := range strings.Split(rawHeaders, ",") {
+			name, value, ok := strings.Cut(rawHeader, "=")
+			if !ok || strings.TrimSpace(name) == "" {
+				return settings, fmt.Errorf("invalid THIRD_PARTY_HEADERS entry %q", rawHeader)
+			}
+			settings.Headers[strings.TrimSpace(name)] = strings.TrimSpace(value)
+		}
+	}
+	return settings, nil
+}
+
+// picks the client used to reach the third party from THIRD_PARTY_CLIENT,
+// "mock" (the default) keeps everything in memory and "http" talks to THIRD_PARTY_BASE_URL;
+// with webhook confirmation the mock partner confirms to THIRD_PARTY_CALLBACK_URL
+func NewThirdPartyClient(settings external.ClientSettings, confirmation string) (external.HTTPDoer, error) {
+	switch client := getEnv("THIRD_PARTY_CLIENT", "mock"); client {
+	case "mock":
+		if confirmation != ConfirmByWebhook {
+			return mock_client.CreateNewMockClient("", ""), nil
+		}
+		callbackURL := getEnv("THIRD_PARTY_CALLBACK_URL", defaultCallbackURL)
+		return mock_client.CreateNewMockClient(callbackURL, getEnv("PARTNER_WEBHOOK_SECRET", "")), nil
+	case "http":
+		return external.NewHTTPClient(settings), nil
+	default:
+		return nil, fmt.Errorf("THIRD_PARTY_CLIENT must be mock or http, got %q", client)
+	}
+}
+
+// builds the retry policy for third-party calls, starting from external.DefaultRetryPolicy:
+// THIRD_PARTY_MAX_ATTEMPTS, THIRD_PARTY_RETRY_BASE_DELAY, THIRD_PARTY_RETRY_MAX_DELAY,
+// THIRD_PARTY_RETRY_JITTER and THIRD_PARTY_RETRYABLE_STATUS_CODES (comma separated)
+func NewRetryPolicy() (external.RetryPolicy, error) {
+	policy := external.DefaultRetryPolicy()
+	var err error
+	if policy.MaxAttempts, err = getIntEnv("THIRD_PARTY_MAX_ATTEMPTS", policy.MaxAttempts); err != nil {
+		return policy, err
+	}
+	if policy.MaxAttempts < 1 {
+		return policy, fmt.Errorf("THIRD_PARTY_MAX_ATTEMPTS must be at least 1, got %d", policy.MaxAttempts)
+	}
+	if policy.BaseDelay, err = getDurationEnv("THIRD_PARTY_RETRY_BASE_DELAY", policy.BaseDelay); err != nil {
+		return policy, err
+	}
+	if policy.MaxDelay, err = getDurationEnv("THIRD_PARTY_RETRY_MAX_DELAY", policy.MaxDelay); err != nil {
+		return policy, err
+	}
+	if policy.Jitter, err = strconv.ParseFloat(getEnv("THIRD_PARTY_RETRY_JITTER", strconv.FormatFloat(policy.Jitter, 'f', -1, 64)), 64); err != nil {
+		return policy, err
+	}
+	if policy.Jitter < 0 || policy.Jitter > 1 {
+		return policy, fmt.Errorf("THIRD_PARTY_RETRY_JITTER must be between 0 and 1, got %v", policy.Jitter)
+	}
+	if rawStatusCodes := getEnv("THIRD_PARTY_RETRYABLE_STATUS_CODES", ""); rawStatusCodes != "" {
+		policy.RetryableStatusCodes = nil
+		for _, rawStatusCode := range strings.Split(rawStatusCodes, ",") {
+			statusCode, err := strconv.Atoi(strings.TrimSpace(rawStatusCode))
+			if err != nil {
+				return policy, fmt.Errorf("invalid THIRD_PARTY_RETRYABLE_STATUS_CODES entry %q", rawStatusCode)
+			}
+			policy.RetryableStatusCodes = append(policy.RetryableStatusCodes, statusCode)
+		}
+	}
+	return policy, nil
+}
+
+// builds the third-party circuit breaker, starting from external.DefaultCircuitBreakerSettings:
+// THIRD_PARTY_BREAKER_FAILURE_RATE, THIRD_PARTY_BREAKER_MIN_CALLS, THIRD_PARTY_BREAKER_WINDOW,
+// THIRD_PARTY_BREAKER_COOLDOWN and THIRD_PARTY_BREAKER_HALF_OPEN_CALLS
+func NewCircuitBreaker() (*external.CircuitBreaker, error) {
+	settings := external.DefaultCircuitBreakerSettings()
+	var err error
+	if settings.FailureRateThreshold, err = strconv.ParseFloat(getEnv("THIRD_PARTY_BREAKER_FAILURE_RATE", strconv.FormatFloat(settings.FailureRateThreshold, 'f', -1, 64)), 64); err != nil {
+		return nil, err
+	}
+	if settings.FailureRateThreshold <= 0 || settings.FailureRateThreshold > 1 {
+		return nil, fmt.Errorf("THIRD_PARTY_BREAKER_FAILURE_RATE must be above 0 and at most 1, got %v", settings.FailureRateThreshold)
+	}
+	if settings.MinimumCalls, err = getIntEnv("THIRD_PARTY_BREAKER_MIN_CALLS", settings.MinimumCalls); err != nil {
+		return nil, err
+	}
+	if settings.Window, err = getDurationEnv("THIRD_PARTY_BREAKER_WINDOW", settings.Window); err != nil {
+		return nil, err
+	}
+	if settings.CoolDown, err = getDurationEnv("THIRD_PARTY_BREAKER_COOLDOWN", settings.CoolDown); err != nil {
+		return nil, err
+	}
+	if settings.HalfOpenCalls, err = getIntEnv("THIRD_PARTY_BREAKER_HALF_OPEN_CALLS", settings.HalfOpenCalls); err != nil {
+		return nil, err
+	}
+	if settings.MinimumCalls < 1 || settings.HalfOpenCalls < 1 {
+		return nil, fmt.Errorf("THIRD_PARTY_BREAKER_MIN_CALLS and THIRD_PARTY_BREAKER_HALF_OPEN_CALLS must be at least 1")
+	}
+	return external.NewCircuitBreaker(settings), nil
+}
@@ -0,0 +1,38 @@
+package config
+
+import (
+	"log"
+	"os"
+	"time"
+
+	"github.com/midedickson/simple-banking-app/fx"
+	"github.com/shopspring/decimal"
+)
+
+const (
+	defaultFXSpread   = "0.005"
+	defaultFXQuoteTTL = 30 * time.Second
+)
+
+// builds the fx quoter from FX_RATES_FILE, FX_SPREAD and FX_QUOTE_TTL
+func NewFXQuoter() (*fx.Quoter, error) {
+	var provider fx.RateProvider = fx.NewStaticRateProvider(fx.DevelopmentRates)
+	if ratesFile := os.Getenv("FX_RATES_FILE"); ratesFile != "" {
+		fileProvider, err := fx.NewFileRateProvider(ratesFile)
+		if err != nil {
+			return nil, err
+		}
+		provider = fileProvider
+	} else {
+		log.Println("FX_RATES_FILE not set, using development exchange rates")
+	}
+	spread, err := decimal.NewFromString(getEnv("FX_SPREAD", defaultFXSpread))
+	if err != nil {
+		return nil, err
+	}
+	ttl, err := getDurationEnv("FX_QUOTE_TTL", defaultFXQuoteTTL)
+	if err != nil {
+		return nil, err
+	}
+	return fx.NewQuoter(DB, provider, spread, ttl), nil
+}
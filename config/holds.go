@@ -0,0 +1,37 @@
+package config
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/midedickson/simple-banking-app/holds"
+)
+
+const (
+	defaultHoldTTL            = 7 * 24 * time.Hour
+	defaultHoldExpiryInterval = time.Minute
+)
+
+// how long a hold reserves funds before it expires, from HOLD_TTL
+func HoldTTL() (time.Duration, error) {
+	ttl, err := getDurationEnv("HOLD_TTL", defaultHoldTTL)
+	if err != nil {
+		return 0, err
+	}
+	if ttl <= 0 {
+		return 0, fmt.Errorf("HOLD_TTL must be positive, got %s", ttl)
+	}
+	return ttl, nil
+}
+
+// expires holds that ran out every HOLD_EXPIRY_INTERVAL
+func StartHoldExpirer(expirer holds.Expirer) (func(), error) {
+	interval, err := getDurationEnv("HOLD_EXPIRY_INTERVAL", defaultHoldExpiryInterval)
+	if err != nil {
+		return nil, err
+	}
+	if interval <= 0 {
+		return nil, fmt.Errorf("HOLD_EXPIRY_INTERVAL must be positive, got %s", interval)
+	}
+	return holds.StartExpirer(expirer, interval), nil
+}
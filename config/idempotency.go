@@ -0,0 +1,49 @@
+package config
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/midedickson/simple-banking-app/idempotency"
+)
+
+const (
+	defaultIdempotencyKeyTTL        = 24 * time.Hour
+	defaultIdempotencyKeyLease      = time.Minute
+	defaultIdempotencySweepInterval = time.Minute
+)
+
+// builds the idempotency store selected by IDEMPOTENCY_STORE, "database" (default) or "memory",
+// with keys expiring after IDEMPOTENCY_KEY_TTL and held for IDEMPOTENCY_KEY_LEASE while processing
+func NewIdempotencyStore() (idempotency.IdempotencyStore, error) {
+	ttl, err := getDurationEnv("IDEMPOTENCY_KEY_TTL", defaultIdempotencyKeyTTL)
+	if err != nil {
+		return nil, err
+	}
+	lease, err := getDurationEnv("IDEMPOTENCY_KEY_LEASE", defaultIdempotencyKeyLease)
+	if err != nil {
+		return nil, err
+	}
+	switch store := getEnv("IDEMPOTENCY_STORE", "database"); store {
+	case "database":
+		return idempotency.NewDBIdempotencyStore(DB, ttl, lease), nil
+	case "memory":
+		log.Println("Using in-memory idempotency store, keys will not survive a restart or be shared between instances")
+		return idempotency.NewIdempotencyStore(ttl, lease), nil
+	default:
+		return nil, fmt.Errorf("unknown IDEMPOTENCY_STORE %q", store)
+	}
+}
+
+// how often expired idempotency keys are swept, from IDEMPOTENCY_SWEEP_INTERVAL
+func IdempotencySweepInterval() (time.Duration, error) {
+	interval, err := getDurationEnv("IDEMPOTENCY_SWEEP_INTERVAL", defaultIdempotencySweepInterval)
+	if err != nil {
+		return 0, err
+	}
+	if interval <= 0 {
+		return 0, fmt.Errorf("IDEMPOTENCY_SWEEP_INTERVAL must be positive, got %s", interval)
+	}
+	return interval, nil
+}
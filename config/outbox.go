@@ -0,0 +1,39 @@
+package config
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/midedickson/simple-banking-app/outbox"
+)
+
+const (
+	defaultOutboxPollInterval = time.Second
+	defaultOutboxMaxAttempts  = 10
+)
+
+// starts the outbox dispatcher, polling every OUTBOX_POLL_INTERVAL and giving up
+// on an entry after OUTBOX_MAX_ATTEMPTS failed deliveries; settler is only used when
+// a successful delivery confirms the transaction
+func StartOutboxDispatcher(forwarder outbox.Forwarder, settler outbox.Settler, confirmation string) (stop func(), err error) {
+	interval, err := getDurationEnv("OUTBOX_POLL_INTERVAL", defaultOutboxPollInterval)
+	if err != nil {
+		return nil, err
+	}
+	if interval <= 0 {
+		return nil, fmt.Errorf("OUTBOX_POLL_INTERVAL must be positive, got %s", interval)
+	}
+	maxAttempts, err := getIntEnv("OUTBOX_MAX_ATTEMPTS", defaultOutboxMaxAttempts)
+	if err != nil {
+		return nil, err
+	}
+	if maxAttempts < 1 {
+		return nil, fmt.Errorf("OUTBOX_MAX_ATTEMPTS must be at least 1, got %d", maxAttempts)
+	}
+	if confirmation != ConfirmByResponse {
+		// transactions settle when the partner's webhook arrives
+		settler = nil
+	}
+	dispatcher := outbox.NewDispatcher(DB, forwarder, settler, maxAttempts)
+	return dispatcher.Start(interval), nil
+}
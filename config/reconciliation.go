@@ -0,0 +1,34 @@
+package config
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/midedickson/simple-banking-app/reconciliation"
+)
+
+const (
+	defaultReconciliationInterval = time.Hour
+	defaultReconciliationLag      = 10 * time.Minute
+)
+
+// builds the reconciliation engine and schedules it every RECONCILIATION_INTERVAL over windows
+// ending RECONCILIATION_LAG ago; an interval of 0 disables the schedule, reports can still be run over the API
+func StartReconciliation(fetcher reconciliation.Fetcher) (*reconciliation.Engine, func(), error) {
+	interval, err := getDurationEnv("RECONCILIATION_INTERVAL", defaultReconciliationInterval)
+	if err != nil {
+		return nil, nil, err
+	}
+	lag, err := getDurationEnv("RECONCILIATION_LAG", defaultReconciliationLag)
+	if err != nil {
+		return nil, nil, err
+	}
+	if interval < 0 || lag < 0 {
+		return nil, nil, fmt.Errorf("RECONCILIATION_INTERVAL and RECONCILIATION_LAG must not be negative")
+	}
+	engine := reconciliation.NewEngine(DB, fetcher)
+	if interval == 0 {
+		return engine, func() {}, nil
+	}
+	return engine, engine.Start(interval, lag), nil
+}
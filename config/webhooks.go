@@ -0,0 +1,51 @@
+package config
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/midedickson/simple-banking-app/webhooks"
+)
+
+// how the bank learns that the third party processed a transaction
+const (
+	// the partner confirms with a signed webhook, transactions settle when it arrives
+	ConfirmByWebhook = "webhook"
+	// a successful delivery counts as confirmation, transactions settle straight away
+	ConfirmByResponse = "response"
+)
+
+const (
+	defaultWebhookTolerance = 5 * time.Minute
+	defaultCallbackURL      = "http://localhost:8080/webhooks/partner"
+)
+
+// reads THIRD_PARTY_CONFIRMATION, webhook by default
+func ConfirmationMode() (string, error) {
+	switch mode := getEnv("THIRD_PARTY_CONFIRMATION", ConfirmByWebhook); mode {
+	case ConfirmByWebhook, ConfirmByResponse:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("THIRD_PARTY_CONFIRMATION must be webhook or response, got %q", mode)
+	}
+}
+
+// builds the verifier for partner webhooks from PARTNER_WEBHOOK_SECRET and PARTNER_WEBHOOK_TOLERANCE,
+// nil when no secret is set; the secret is required when transactions wait for webhooks
+func NewWebhookVerifier(confirmation string) (*webhooks.Verifier, error) {
+	secret := getEnv("PARTNER_WEBHOOK_SECRET", "")
+	if secret == "" {
+		if confirmation == ConfirmByWebhook {
+			return nil, fmt.Errorf("PARTNER_WEBHOOK_SECRET is required when THIRD_PARTY_CONFIRMATION is %s, set it or use THIRD_PARTY_CONFIRMATION=%s", ConfirmByWebhook, ConfirmByResponse)
+		}
+		return nil, nil
+	}
+	tolerance, err := getDurationEnv("PARTNER_WEBHOOK_TOLERANCE", defaultWebhookTolerance)
+	if err != nil {
+		return nil, err
+	}
+	if tolerance <= 0 {
+		return nil, fmt.Errorf("PARTNER_WEBHOOK_TOLERANCE must be positive, got %s", tolerance)
+	}
+	return webhooks.NewVerifier(secret, tolerance), nil
+}
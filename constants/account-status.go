@@ -0,0 +1,9 @@
+package constants
+
+const (
+	AccountStatusActive = "active"
+	AccountStatusFrozen = "frozen"
+	AccountStatusClosed = "closed"
+
+	DefaultCurrency = "NGN"
+)
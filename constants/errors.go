@@ -4,3 +4,25 @@ import "errors"
 
 var ErrInsufficientFunds = errors.New("insufficient funds in account balance")
 var ErrThirdPartyFailure = errors.New("third-party failure")
+var ErrThirdPartyTransactionNotFound = errors.New("third party has no record of the transaction")
+var ErrThirdPartyRejected = errors.New("third party rejected the transaction")
+var ErrThirdPartyUnavailable = errors.New("third party is unavailable, its circuit breaker is open")
+var ErrInvalidAmount = errors.New("amount must be greater than zero")
+var ErrAmountPrecision = errors.New("amount has more decimal places than the currency allows")
+var ErrUnsupportedCurrency = errors.New("unsupported currency")
+var ErrCurrencyMismatch = errors.New("currency does not match the account currency")
+var ErrTransactionNotPending = errors.New("transaction is no longer pending")
+var ErrTransactionNotFound = errors.New("transaction not found")
+var ErrDuplicateWebhookEvent = errors.New("webhook event has already been processed")
+var ErrTransactionNotReversible = errors.New("only successful credits and debits can be reversed")
+var ErrReversalExceedsAmount = errors.New("reversals would exceed the original transaction amount")
+var ErrHoldNotFound = errors.New("hold not found")
+var ErrHoldNotActive = errors.New("hold has already been captured, voided or has expired")
+var ErrCaptureExceedsHold = errors.New("capture amount exceeds the held amount")
+var ErrRateUnavailable = errors.New("exchange rate unavailable for currency pair")
+var ErrQuoteNotFound = errors.New("fx quote not found")
+var ErrQuoteExpired = errors.New("fx quote has expired")
+var ErrQuoteUsed = errors.New("fx quote has already been used")
+var ErrQuoteMismatch = errors.New("fx quote does not match the transfer currencies")
+var ErrUnbalancedEntry = errors.New("journal entry postings do not sum to zero in every currency")
+var ErrBalanceDrift = errors.New("account balance does not match the balance derived from its postings")
@@ -9,4 +9,22 @@ const (
 
 	DirectionDebit  = "debit"
 	DirectionCredit = "credit"
+
+	// steps of a hold recorded as transactions that move no funds, a capture is recorded as a debit
+	DirectionAuthorization = "authorization"
+	DirectionVoid          = "void"
+	DirectionExpiry        = "expiry"
+)
+
+const (
+	HoldActive   = "active"
+	HoldCaptured = "captured"
+	HoldVoided   = "voided"
+	HoldExpired  = "expired"
+)
+
+// outcomes the third party reports for a transaction in its webhooks
+const (
+	PartnerEventCompleted = "completed"
+	PartnerEventFailed    = "failed"
 )
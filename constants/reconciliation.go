@@ -0,0 +1,20 @@
+package constants
+
+// how a transaction compares against the partner's record of it
+const (
+	ReconciliationMatched        = "matched"
+	ReconciliationMissingRemote  = "missing_remote"
+	ReconciliationMissingLocal   = "missing_local"
+	ReconciliationAmountMismatch = "amount_mismatch"
+	ReconciliationStatusMismatch = "status_mismatch"
+)
+
+const (
+	ReconciliationCompleted = "completed"
+	ReconciliationFailed    = "failed"
+
+	// the partner's records were fetched one by one from its API
+	ReconciliationSourcePartnerAPI = "partner_api"
+	// the partner's records were supplied in bulk, e.g. from a settlement file
+	ReconciliationSourceImport = "import"
+)
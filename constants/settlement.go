@@ -0,0 +1,30 @@
+package constants
+
+// settlement statement formats the importer understands
+const (
+	SettlementFormatCSV     = "csv"
+	SettlementFormatCamt053 = "camt053"
+)
+
+const (
+	SettlementImportCompleted = "completed"
+	SettlementImportFailed    = "failed"
+
+	SettlementEntryMatched   = "matched"
+	SettlementEntrySuspended = "suspended"
+)
+
+// why a statement entry was put in the suspense queue
+const (
+	SuspenseUnknownReference  = "unknown_reference"
+	SuspenseMissingReference  = "missing_reference"
+	SuspenseAmountMismatch    = "amount_mismatch"
+	SuspenseDirectionMismatch = "direction_mismatch"
+	SuspenseStatusMismatch    = "status_mismatch"
+	SuspenseDuplicateEntry    = "duplicate_entry"
+)
+
+const (
+	SuspenseOpen     = "open"
+	SuspenseResolved = "resolved"
+)
@@ -0,0 +1,182 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/midedickson/simple-banking-app/constants"
+	"github.com/midedickson/simple-banking-app/dto"
+	"github.com/midedickson/simple-banking-app/utils"
+	"github.com/shopspring/decimal"
+)
+
+const (
+	defaultRecentTransactionsLimit = 10
+	maxRecentTransactionsLimit     = 100
+
+	defaultTransactionHistoryLimit = 20
+)
+
+var transactionDirections = map[string]bool{
+	constants.DirectionCredit:        true,
+	constants.DirectionDebit:         true,
+	constants.DirectionAuthorization: true,
+	constants.DirectionVoid:          true,
+	constants.DirectionExpiry:        true,
+}
+
+var transactionStatuses = map[string]bool{"pending": true, constants.SUCCESS: true, constants.FAILED: true}
+
+func (c *Controller) FetchUserAccountDetails(w http.ResponseWriter, r *http.Request) {
+	accountID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		utils.Dispatch400Error(w, "Invalid account ID", nil)
+		return
+	}
+	limit := defaultRecentTransactionsLimit
+	if rawLimit := r.URL.Query().Get("limit"); rawLimit != "" {
+		limit, err = strconv.Atoi(rawLimit)
+		if err != nil || limit <= 0 || limit > maxRecentTransactionsLimit {
+			utils.Dispatch400Error(w, "Invalid limit, expected a number between 1 and 100", nil)
+			return
+		}
+	}
+	userAccount := c.repo.FindAccountById(accountID)
+	if userAccount == nil {
+		utils.Dispatch404Error(w, "Account not found", nil)
+		return
+	}
+	recentTransactions, err := c.repo.FetchRecentTransactionsByAccountID(accountID, limit)
+	if err != nil {
+		utils.Dispatch500Error(w, err)
+		return
+	}
+	accountDetails := &dto.AccountDetailsDTO{
+		AccountID:          userAccount.ID,
+		LedgerBalance:      userAccount.Balance,
+		AvailableBalance:   userAccount.AvailableBalance(),
+		HeldBalance:        userAccount.Held,
+		Currency:           userAccount.Currency,
+		Status:             userAccount.Status,
+		RecentTransactions: recentTransactions,
+	}
+	utils.Dispatch200(w, "Account details fetched successfully", accountDetails)
+}
+
+// lists an account's transactions a page at a time, newest first unless ?order=asc
+func (c *Controller) FetchAccountTransactions(w http.ResponseWriter, r *http.Request) {
+	accountID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		utils.Dispatch400Error(w, "Invalid account ID", nil)
+		return
+	}
+	filter, err := parseTransactionHistoryFilter(r.URL.Query())
+	if err != nil {
+		utils.Dispatch400Error(w, "Invalid transaction filter", err.Error())
+		return
+	}
+	if c.repo.FindAccountById(accountID) == nil {
+		utils.Dispatch404Error(w, "Account not found", nil)
+		return
+	}
+	filter.AccountID = accountID
+	limit := filter.Limit
+	// one extra transaction tells whether there is a next page
+	filter.Limit++
+	transactions, err := c.repo.FetchTransactionHistory(filter)
+	if err != nil {
+		utils.Dispatch500Error(w, err)
+		return
+	}
+	page := &dto.TransactionPageDTO{Transactions: transactions}
+	if len(transactions) > limit {
+		page.Transactions = transactions[:limit]
+		last := page.Transactions[limit-1]
+		page.NextCursor = utils.EncodeTransactionCursor(dto.TransactionCursor{CreatedAt: last.CreatedAt, ID: last.ID})
+	}
+	utils.Dispatch200(w, "Account transactions fetched successfully", page)
+}
+
+func parseTransactionHistoryFilter(query url.Values) (*dto.TransactionHistoryFilter, error) {
+	filter := &dto.TransactionHistoryFilter{Limit: defaultTransactionHistoryLimit}
+	if direction := query.Get("direction"); direction != "" {
+		if !transactionDirections[direction] {
+			return nil, fmt.Errorf("unknown direction %q", direction)
+		}
+		filter.Direction = direction
+	}
+	if status := query.Get("status"); status != "" {
+		if !transactionStatuses[status] {
+			return nil, fmt.Errorf("unknown status %q", status)
+		}
+		filter.Status = status
+	}
+	var err error
+	if filter.From, err = parseTimeParam(query, "from"); err != nil {
+		return nil, err
+	}
+	if filter.To, err = parseTimeParam(query, "to"); err != nil {
+		return nil, err
+	}
+	if filter.From != nil && filter.To != nil && !filter.To.After(*filter.From) {
+		return nil, fmt.Errorf("to must be after from")
+	}
+	if filter.MinAmount, err = parseAmountParam(query, "min_amount"); err != nil {
+		return nil, err
+	}
+	if filter.MaxAmount, err = parseAmountParam(query, "max_amount"); err != nil {
+		return nil, err
+	}
+	if filter.MinAmount != nil && filter.MaxAmount != nil && filter.MinAmount.GreaterThan(*filter.MaxAmount) {
+		return nil, fmt.Errorf("min_amount must not be greater than max_amount")
+	}
+	switch order := query.Get("order"); order {
+	case "", "desc":
+	case "asc":
+		filter.Ascending = true
+	default:
+		return nil, fmt.Errorf("order must be asc or desc")
+	}
+	if rawLimit := query.Get("limit"); rawLimit != "" {
+		filter.Limit, err = strconv.Atoi(rawLimit)
+		if err != nil || filter.Limit <= 0 || filter.Limit > maxRecentTransactionsLimit {
+			return nil, fmt.Errorf("limit must be a number between 1 and %d", maxRecentTransactionsLimit)
+		}
+	}
+	if cursor := query.Get("cursor"); cursor != "" {
+		if filter.After, err = utils.DecodeTransactionCursor(cursor); err != nil {
+			return nil, err
+		}
+	}
+	return filter, nil
+}
+
+// an RFC 3339 time, nil when the parameter is absent
+func parseTimeParam(query url.Values, name string) (*time.Time, error) {
+	raw := query.Get(name)
+	if raw == "" {
+		return nil, nil
+	}
+	parsed, err := time.Parse(time.RFC3339, raw)
+	if err != nil {
+		return nil, fmt.Errorf("%s must be an RFC 3339 time", name)
+	}
+	return &parsed, nil
+}
+
+// a non-negative decimal, nil when the parameter is absent
+func parseAmountParam(query url.Values, name string) (*decimal.Decimal, error) {
+	raw := query.Get(name)
+	if raw == "" {
+		return nil, nil
+	}
+	amount, err := decimal.NewFromString(raw)
+	if err != nil || amount.IsNegative() {
+		return nil, fmt.Errorf("%s must be a non-negative amount", name)
+	}
+	return &amount, nil
+}
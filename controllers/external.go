@@ -0,0 +1,36 @@
+package controllers
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"time"
+
+	"github.com/midedickson/simple-banking-app/external"
+	"github.com/midedickson/simple-banking-app/utils"
+)
+
+// error code returned while the third-party circuit breaker is open
+const ThirdPartyUnavailableCode = "THIRD_PARTY_UNAVAILABLE"
+
+func (c *Controller) FetchThirdPartyStatus(w http.ResponseWriter, r *http.Request) {
+	utils.Dispatch200(w, "Third-party status fetched successfully", c.external.CircuitBreakerState())
+}
+
+// fails fast with a 503 while the third-party circuit breaker is open; callers have already
+// claimed the idempotency key and move it to CAN_RETRY, so the request can be resent with the same key later
+func (c *Controller) checkThirdPartyAvailable(w http.ResponseWriter) bool {
+	state := c.external.CircuitBreakerState()
+	if state.State != external.CircuitOpen {
+		return true
+	}
+	if state.RetryAt != nil {
+		retryAfter := math.Ceil(time.Until(*state.RetryAt).Seconds())
+		w.Header().Set("Retry-After", fmt.Sprintf("%d", int(math.Max(retryAfter, 1))))
+	}
+	utils.Dispatch503Error(w, "Third-party processor is unavailable, please retry later", map[string]any{
+		"code":     ThirdPartyUnavailableCode,
+		"retry_at": state.RetryAt,
+	})
+	return false
+}
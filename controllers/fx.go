@@ -0,0 +1,58 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/midedickson/simple-banking-app/constants"
+	"github.com/midedickson/simple-banking-app/currency"
+	"github.com/midedickson/simple-banking-app/dto"
+	"github.com/midedickson/simple-banking-app/fx"
+	"github.com/midedickson/simple-banking-app/utils"
+)
+
+func (c *Controller) CreateFXQuote(w http.ResponseWriter, r *http.Request) {
+	var createFXQuoteDTO dto.CreateFXQuoteDTO
+	err := json.NewDecoder(r.Body).Decode(&createFXQuoteDTO)
+	if err != nil {
+		utils.Dispatch400Error(w, "Invalid request payload", err)
+		return
+	}
+	from, fromOk := currency.Lookup(createFXQuoteDTO.From)
+	to, toOk := currency.Lookup(createFXQuoteDTO.To)
+	if !fromOk || !toOk {
+		utils.Dispatch400Error(w, "Invalid Currency", "unsupported currency")
+		return
+	}
+	quote, err := c.quoter.NewQuote(from.Code, to.Code)
+	if err != nil {
+		if errors.Is(err, constants.ErrRateUnavailable) {
+			utils.Dispatch422Error(w, "Invalid Currency", err.Error())
+			return
+		}
+		utils.Dispatch500Error(w, err)
+		return
+	}
+	utils.Dispatch200(w, "FX quote created successfully", quote)
+}
+
+// looks up the quote a cross-currency transfer executes at, a fresh quote is issued
+// when the client did not supply one; the repository uses the quote up with the transfer
+func (c *Controller) fetchTransferQuote(quoteID string, from string, to string) (*fx.Quote, error) {
+	if quoteID == "" {
+		quote, err := c.quoter.NewQuote(from, to)
+		if err != nil {
+			return nil, err
+		}
+		quoteID = quote.ID
+	}
+	quote, err := c.quoter.FetchQuote(quoteID)
+	if err != nil {
+		return nil, err
+	}
+	if quote.From != from || quote.To != to {
+		return nil, constants.ErrQuoteMismatch
+	}
+	return quote, nil
+}
@@ -0,0 +1,182 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/midedickson/simple-banking-app/constants"
+	"github.com/midedickson/simple-banking-app/dto"
+	"github.com/midedickson/simple-banking-app/utils"
+)
+
+// reserves funds on an account for a later capture, the hold expires after the configured time
+func (c *Controller) CreateHold(w http.ResponseWriter, r *http.Request) {
+	key := r.Header.Get("X-Idempotency-Key")
+	claim, ok := c.startIdempotentRequest(w, r, key, c.resumeHoldStep(http.StatusOK, "Hold placed successfully"))
+	if !ok {
+		return
+	}
+	defer claim.done()
+	var createHoldDTO dto.CreateHoldDTO
+	err := json.NewDecoder(r.Body).Decode(&createHoldDTO)
+	if err != nil {
+		c.updateIdempotencyKeyStatus(claim, constants.FAILED)
+		utils.Dispatch400Error(w, "Invalid request payload", err)
+		return
+	}
+	userAccount := c.repo.FindAccountById(createHoldDTO.AccountID)
+	if userAccount == nil {
+		c.updateIdempotencyKeyStatus(claim, constants.FAILED)
+		utils.Dispatch400Error(w, "Invalid account ID", nil)
+		return
+	}
+	holdCurrency, err := utils.ResolveCurrency(createHoldDTO.Currency, userAccount.Currency)
+	if err != nil {
+		c.updateIdempotencyKeyStatus(claim, constants.FAILED)
+		if errors.Is(err, constants.ErrCurrencyMismatch) {
+			utils.Dispatch422Error(w, "Invalid Currency", err.Error())
+			return
+		}
+		utils.Dispatch400Error(w, "Invalid Currency", err.Error())
+		return
+	}
+	if err := utils.ValidateAmount(createHoldDTO.Amount, holdCurrency.Exponent); err != nil {
+		c.updateIdempotencyKeyStatus(claim, constants.FAILED)
+		utils.Dispatch400Error(w, "Invalid Amount", err.Error())
+		return
+	}
+	held, err := c.repo.AuthorizeHold(&dto.CreateDBHoldDTO{
+		AccountID:      createHoldDTO.AccountID,
+		Amount:         createHoldDTO.Amount,
+		Currency:       holdCurrency.Code,
+		ExpiresAt:      time.Now().Add(c.holdTTL),
+		IdempotencyKey: key,
+	})
+	if err != nil {
+		c.failIdempotentRequest(claim, err)
+		if errors.Is(err, constants.ErrInsufficientFunds) {
+			utils.Dispatch400Error(w, "Insufficient funds", err)
+			return
+		}
+		utils.Dispatch500Error(w, err)
+		return
+	}
+	c.completeIdempotentRequest(w, claim, http.StatusOK, "Hold placed successfully", held)
+}
+
+// captures an active hold in full or in part, the rest of the hold is released
+func (c *Controller) CaptureHold(w http.ResponseWriter, r *http.Request) {
+	key := r.Header.Get("X-Idempotency-Key")
+	claim, ok := c.startIdempotentRequest(w, r, key, c.resumeHoldStep(http.StatusAccepted, "Capture accepted for processing"))
+	if !ok {
+		return
+	}
+	defer claim.done()
+	if ok := c.checkThirdPartyAvailable(w); !ok {
+		c.updateIdempotencyKeyStatus(claim, constants.CAN_RETRY)
+		return
+	}
+	var captureHoldDTO dto.CaptureHoldDTO
+	// an empty body captures the whole hold
+	err := json.NewDecoder(r.Body).Decode(&captureHoldDTO)
+	if err != nil && !errors.Is(err, io.EOF) {
+		c.updateIdempotencyKeyStatus(claim, constants.FAILED)
+		utils.Dispatch400Error(w, "Invalid request payload", err)
+		return
+	}
+	reference := mux.Vars(r)["reference"]
+	hold := c.repo.FetchHoldByReference(reference)
+	if hold == nil {
+		c.updateIdempotencyKeyStatus(claim, constants.FAILED)
+		utils.Dispatch404Error(w, "Hold not found", nil)
+		return
+	}
+	if captureHoldDTO.Amount != nil {
+		holdCurrency, err := utils.ResolveCurrency(hold.Currency, hold.Currency)
+		if err != nil {
+			c.updateIdempotencyKeyStatus(claim, constants.FAILED)
+			utils.Dispatch400Error(w, "Invalid Currency", err.Error())
+			return
+		}
+		if err := utils.ValidateAmount(*captureHoldDTO.Amount, holdCurrency.Exponent); err != nil {
+			c.updateIdempotencyKeyStatus(claim, constants.FAILED)
+			utils.Dispatch400Error(w, "Invalid Amount", err.Error())
+			return
+		}
+	}
+	captured, err := c.repo.CaptureHold(&dto.CaptureDBHoldDTO{
+		Reference:      reference,
+		Amount:         captureHoldDTO.Amount,
+		IdempotencyKey: key,
+	})
+	if err != nil {
+		c.failIdempotentRequest(claim, err)
+		c.dispatchHoldError(w, err)
+		return
+	}
+	// the dispatcher forwards the capture to the third party and settles it
+	c.completeIdempotentRequest(w, claim, http.StatusAccepted, "Capture accepted for processing", captured)
+}
+
+// releases an active hold without debiting anything
+func (c *Controller) VoidHold(w http.ResponseWriter, r *http.Request) {
+	key := r.Header.Get("X-Idempotency-Key")
+	claim, ok := c.startIdempotentRequest(w, r, key, c.resumeHoldStep(http.StatusOK, "Hold voided successfully"))
+	if !ok {
+		return
+	}
+	defer claim.done()
+	voided, err := c.repo.VoidHold(mux.Vars(r)["reference"], key)
+	if err != nil {
+		c.failIdempotentRequest(claim, err)
+		c.dispatchHoldError(w, err)
+		return
+	}
+	c.completeIdempotentRequest(w, claim, http.StatusOK, "Hold voided successfully", voided)
+}
+
+func (c *Controller) FetchHold(w http.ResponseWriter, r *http.Request) {
+	hold := c.repo.FetchHoldByReference(mux.Vars(r)["reference"])
+	if hold == nil {
+		utils.Dispatch404Error(w, "Hold not found", nil)
+		return
+	}
+	utils.Dispatch200(w, "Hold fetched successfully", hold)
+}
+
+func (c *Controller) dispatchHoldError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, constants.ErrHoldNotFound):
+		utils.Dispatch404Error(w, "Hold not found", nil)
+	case errors.Is(err, constants.ErrHoldNotActive):
+		utils.Dispatch409Error(w, "Hold is no longer active", err.Error())
+	case errors.Is(err, constants.ErrCaptureExceedsHold):
+		utils.Dispatch422Error(w, "Invalid Amount", err.Error())
+	default:
+		utils.Dispatch500Error(w, err)
+	}
+}
+
+// each hold step is written in one database transaction, so a request whose lease ran out
+// either recorded its step or never started it
+func (c *Controller) resumeHoldStep(statusCode int, msg string) func(w http.ResponseWriter, claim *idempotencyClaim) bool {
+	return func(w http.ResponseWriter, claim *idempotencyClaim) bool {
+		transactions, err := c.repo.FetchTransactionsByIdempotencyKey(claim.key)
+		if err != nil {
+			c.updateIdempotencyKeyStatus(claim, constants.CAN_RETRY)
+			utils.Dispatch500Error(w, err)
+			return true
+		}
+		if len(transactions) == 0 {
+			return false
+		}
+		transaction := transactions[0]
+		hold := c.repo.FetchHoldByReference(transaction.HoldReference)
+		c.completeIdempotentRequest(w, claim, statusCode, msg, &dto.HoldDTO{Hold: hold, Transaction: transaction})
+		return true
+	}
+}
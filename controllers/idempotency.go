@@ -1,8 +1,11 @@
 package controllers
 
 import (
+	"log"
 	"net/http"
 
+	"github.com/midedickson/simple-banking-app/constants"
+	"github.com/midedickson/simple-banking-app/idempotency"
 	"github.com/midedickson/simple-banking-app/utils"
 )
 
@@ -17,3 +20,143 @@ func (c *Controller) RequestNewIdempotencyKey(w http.ResponseWriter, r *http.Req
 	// send the response with the generated idempotency key in the body
 	utils.Dispatch200(w, "New Idempotency Key generated successfully", map[string]string{"idempotency_key": key})
 }
+
+// a request's claim on its idempotency key; the key is only updated under the claim's lease,
+// which is renewed in the background until done is called
+type idempotencyClaim struct {
+	key   string
+	lease string
+	done  func()
+}
+
+// checks the idempotency key of a request and marks it as processing,
+// returns false after writing the response when the request must not go ahead.
+// resume is called for a key released after its lease ran out, and reports whether it finished the request
+func (c *Controller) startIdempotentRequest(w http.ResponseWriter, r *http.Request, key string, resume func(w http.ResponseWriter, claim *idempotencyClaim) bool) (*idempotencyClaim, bool) {
+	if key == "" {
+		utils.Dispatch400Error(w, "Idempotency Key is required", nil)
+		return nil, false
+	}
+	if ok := c.registerIdempotencyKey(w, key); !ok {
+		return nil, false
+	}
+	status, err := c.idempotencyStore.CheckIdempotencyKeyStatus(key)
+	if err != nil {
+		utils.Dispatch422Error(w, "Invalid or missing Idempotency Key", nil)
+		return nil, false
+	}
+	if ok := c.checkIdempotencyFingerprint(w, r, key); !ok {
+		return nil, false
+	}
+	switch status {
+	case constants.SUCCESS:
+		c.replayIdempotentResponse(w, key)
+		return nil, false
+	case constants.WAITING, constants.CAN_RETRY:
+		claim, ok := c.claimIdempotencyKey(w, key, status)
+		if !ok {
+			return nil, false
+		}
+		if status == constants.CAN_RETRY {
+			if done := resume(w, claim); done {
+				claim.done()
+				return nil, false
+			}
+		}
+		return claim, true
+	case constants.PROCESSING:
+		utils.Dispatch409Error(w, "A similar transaction is already being processed, please wait to get the a feedback and try again later if it doesn't work.", status)
+		return nil, false
+	case constants.FAILED:
+		utils.Dispatch409Error(w, "A similar transaction has failed, please try again.", status)
+		return nil, false
+	}
+	return nil, false
+}
+
+// registers a key chosen by the client the first time it is used,
+// keys handed out by RequestNewIdempotencyKey are already known
+func (c *Controller) registerIdempotencyKey(w http.ResponseWriter, key string) bool {
+	if err := idempotency.ValidateIdempotencyKey(key); err != nil {
+		utils.Dispatch422Error(w, "Invalid or missing Idempotency Key", err.Error())
+		return false
+	}
+	if _, err := c.idempotencyStore.RegisterIdempotencyKey(key); err != nil {
+		utils.Dispatch500Error(w, err)
+		return false
+	}
+	return true
+}
+
+// moves a key from expected to processing, only one of several concurrent requests can win the claim;
+// the lease is kept alive for as long as the request runs
+func (c *Controller) claimIdempotencyKey(w http.ResponseWriter, key string, expected string) (*idempotencyClaim, bool) {
+	lease, claimed, err := c.idempotencyStore.ClaimIdempotencyKey(key, expected)
+	if err != nil {
+		utils.Dispatch500Error(w, err)
+		return nil, false
+	}
+	if !claimed {
+		utils.Dispatch409Error(w, "A similar transaction is already being processed, please wait to get the a feedback and try again later if it doesn't work.", constants.PROCESSING)
+		return nil, false
+	}
+	return &idempotencyClaim{key: key, lease: lease, done: c.idempotencyStore.KeepIdempotencyKeyLease(key, lease)}, true
+}
+
+// moves the claimed key to status, a claim that was lost to another request changes nothing
+func (c *Controller) updateIdempotencyKeyStatus(claim *idempotencyClaim, status string) {
+	if err := c.idempotencyStore.UpdateIdempotencyKeyStatus(claim.key, claim.lease, status); err != nil {
+		log.Printf("failed to move idempotency key %s to %s: %s", claim.key, status, err)
+	}
+}
+
+// marks the key successful with the response it produced, then sends that response,
+// so a retry with the same key gets exactly the same bytes back
+func (c *Controller) completeIdempotentRequest(w http.ResponseWriter, claim *idempotencyClaim, statusCode int, msg string, data any) {
+	response := utils.WriteInfo(msg, data)
+	if err := c.idempotencyStore.CompleteIdempotencyKey(claim.key, claim.lease, statusCode, response); err != nil {
+		log.Printf("failed to store response for idempotency key %s: %s", claim.key, err)
+	}
+	utils.DispatchRaw(w, statusCode, response)
+}
+
+// closes the key after a permanent failure, or leaves it open after a transient one
+// so the client can resend the request with the same key
+func (c *Controller) failIdempotentRequest(claim *idempotencyClaim, err error) {
+	status := constants.FAILED
+	if idempotency.IsTransientFailure(err) {
+		status = constants.CAN_RETRY
+	}
+	c.updateIdempotencyKeyStatus(claim, status)
+}
+
+// sends the stored response of a key that has already been processed successfully
+func (c *Controller) replayIdempotentResponse(w http.ResponseWriter, key string) {
+	statusCode, response, err := c.idempotencyStore.FetchIdempotencyKeyResponse(key)
+	if err != nil || statusCode == 0 {
+		// keys completed before responses were stored have nothing to replay
+		utils.Dispatch409Error(w, "Idempotency Key has already been processed", constants.SUCCESS)
+		return
+	}
+	w.Header().Set("Idempotent-Replayed", "true")
+	utils.DispatchRaw(w, statusCode, response)
+}
+
+// rejects a request that reuses an idempotency key with different parameters
+func (c *Controller) checkIdempotencyFingerprint(w http.ResponseWriter, r *http.Request, key string) bool {
+	fingerprint, err := idempotency.Fingerprint(r)
+	if err != nil {
+		utils.Dispatch400Error(w, "Invalid request payload", err.Error())
+		return false
+	}
+	matches, err := c.idempotencyStore.BindIdempotencyKeyFingerprint(key, fingerprint)
+	if err != nil {
+		utils.Dispatch500Error(w, err)
+		return false
+	}
+	if !matches {
+		utils.Dispatch422Error(w, "idempotency key reused with different parameters", nil)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,74 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/midedickson/simple-banking-app/dto"
+	"github.com/midedickson/simple-banking-app/models"
+	"github.com/midedickson/simple-banking-app/reconciliation"
+	"github.com/midedickson/simple-banking-app/utils"
+)
+
+const recentReconciliationReportsLimit = 20
+
+// runs a reconciliation over the requested window and returns its report
+func (c *Controller) CreateReconciliationReport(w http.ResponseWriter, r *http.Request) {
+	var createReconciliationDTO dto.CreateReconciliationDTO
+	err := json.NewDecoder(r.Body).Decode(&createReconciliationDTO)
+	if err != nil {
+		utils.Dispatch400Error(w, "Invalid request payload", err)
+		return
+	}
+	from, to := createReconciliationDTO.From, createReconciliationDTO.To
+	var report *models.ReconciliationReport
+	if createReconciliationDTO.Records != nil {
+		report, err = c.reconciler.RunAgainstImport(from, to, createReconciliationDTO.Records)
+	} else {
+		report, err = c.reconciler.RunAgainstPartner(from, to)
+	}
+	if err != nil {
+		if errors.Is(err, reconciliation.ErrInvalidWindow) {
+			utils.Dispatch400Error(w, "Invalid reconciliation window", err.Error())
+			return
+		}
+		if report != nil {
+			// the failed run is stored, so it can be looked up next to the completed ones
+			utils.Dispatch502Error(w, "Reconciliation failed", report)
+			return
+		}
+		utils.Dispatch500Error(w, err)
+		return
+	}
+	utils.Dispatch200(w, "Reconciliation completed successfully", report)
+}
+
+func (c *Controller) FetchReconciliationReports(w http.ResponseWriter, r *http.Request) {
+	reports, err := c.reconciler.FetchRecentReports(recentReconciliationReportsLimit)
+	if err != nil {
+		utils.Dispatch500Error(w, err)
+		return
+	}
+	utils.Dispatch200(w, "Reconciliation reports fetched successfully", reports)
+}
+
+func (c *Controller) FetchReconciliationReport(w http.ResponseWriter, r *http.Request) {
+	reportID, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		utils.Dispatch400Error(w, "Invalid report ID", nil)
+		return
+	}
+	report, err := c.reconciler.FetchReport(uint(reportID))
+	if err != nil {
+		if errors.Is(err, reconciliation.ErrReportNotFound) {
+			utils.Dispatch404Error(w, "Reconciliation report not found", nil)
+			return
+		}
+		utils.Dispatch500Error(w, err)
+		return
+	}
+	utils.Dispatch200(w, "Reconciliation report fetched successfully", report)
+}
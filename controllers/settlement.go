@@ -0,0 +1,155 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/midedickson/simple-banking-app/constants"
+	"github.com/midedickson/simple-banking-app/dto"
+	"github.com/midedickson/simple-banking-app/settlement"
+	"github.com/midedickson/simple-banking-app/utils"
+)
+
+// settlement files are end-of-day statements, anything bigger than this is not one
+const maxSettlementFileSize = 10 << 20
+
+// stores a partner settlement file sent as the raw request body and matches it to our transactions
+func (c *Controller) CreateSettlementImport(w http.ResponseWriter, r *http.Request) {
+	format := settlementFormat(r)
+	if format == "" {
+		utils.Dispatch400Error(w, "Unsupported settlement file format", "set ?format=csv or ?format=camt053")
+		return
+	}
+	content, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxSettlementFileSize))
+	if err != nil || len(content) == 0 {
+		utils.Dispatch400Error(w, "Invalid settlement file", nil)
+		return
+	}
+	settlementImport, err := c.settlementImporter.Import(format, r.URL.Query().Get("filename"), content)
+	if err != nil {
+		switch {
+		case errors.Is(err, settlement.ErrDuplicateImport):
+			utils.Dispatch409Error(w, "Settlement file has already been imported", settlementImport)
+		case errors.Is(err, settlement.ErrUnsupportedFormat):
+			utils.Dispatch400Error(w, "Unsupported settlement file format", err.Error())
+		case errors.Is(err, settlement.ErrInvalidStatement):
+			// the file is stored as failed, so it can be re-run once the parser is fixed
+			utils.Dispatch422Error(w, "Invalid settlement file", settlementImport)
+		default:
+			utils.Dispatch500Error(w, err)
+		}
+		return
+	}
+	utils.Dispatch200(w, "Settlement file imported successfully", settlementImport)
+}
+
+// the format from ?format=, or guessed from the Content-Type; empty when neither names a known format
+func settlementFormat(r *http.Request) string {
+	switch format := r.URL.Query().Get("format"); format {
+	case constants.SettlementFormatCSV, constants.SettlementFormatCamt053:
+		return format
+	case "":
+	default:
+		return ""
+	}
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch mediaType {
+	case "text/csv":
+		return constants.SettlementFormatCSV
+	case "application/xml", "text/xml":
+		return constants.SettlementFormatCamt053
+	}
+	return ""
+}
+
+func (c *Controller) FetchSettlementImport(w http.ResponseWriter, r *http.Request) {
+	importID, ok := settlementPathID(w, r, "Invalid import ID")
+	if !ok {
+		return
+	}
+	settlementImport, err := c.settlementImporter.FetchImport(importID)
+	if err != nil {
+		if errors.Is(err, settlement.ErrImportNotFound) {
+			utils.Dispatch404Error(w, "Settlement import not found", nil)
+			return
+		}
+		utils.Dispatch500Error(w, err)
+		return
+	}
+	utils.Dispatch200(w, "Settlement import fetched successfully", settlementImport)
+}
+
+// matches a stored settlement file again, e.g. after the transactions it was missing were booked
+func (c *Controller) RerunSettlementImport(w http.ResponseWriter, r *http.Request) {
+	importID, ok := settlementPathID(w, r, "Invalid import ID")
+	if !ok {
+		return
+	}
+	settlementImport, err := c.settlementImporter.Rerun(importID)
+	if err != nil {
+		switch {
+		case errors.Is(err, settlement.ErrImportNotFound):
+			utils.Dispatch404Error(w, "Settlement import not found", nil)
+		case errors.Is(err, settlement.ErrInvalidStatement):
+			utils.Dispatch422Error(w, "Invalid settlement file", settlementImport)
+		default:
+			utils.Dispatch500Error(w, err)
+		}
+		return
+	}
+	utils.Dispatch200(w, "Settlement import re-run successfully", settlementImport)
+}
+
+func (c *Controller) FetchSuspenseItems(w http.ResponseWriter, r *http.Request) {
+	status := r.URL.Query().Get("status")
+	if status != "" && status != constants.SuspenseOpen && status != constants.SuspenseResolved {
+		utils.Dispatch400Error(w, "Invalid suspense status", nil)
+		return
+	}
+	items, err := c.settlementImporter.FetchSuspenseItems(status)
+	if err != nil {
+		utils.Dispatch500Error(w, err)
+		return
+	}
+	utils.Dispatch200(w, "Suspense items fetched successfully", items)
+}
+
+func (c *Controller) ResolveSuspenseItem(w http.ResponseWriter, r *http.Request) {
+	itemID, ok := settlementPathID(w, r, "Invalid suspense item ID")
+	if !ok {
+		return
+	}
+	var resolveSuspenseItemDTO dto.ResolveSuspenseItemDTO
+	if err := json.NewDecoder(r.Body).Decode(&resolveSuspenseItemDTO); err != nil {
+		utils.Dispatch400Error(w, "Invalid request payload", err)
+		return
+	}
+	if resolveSuspenseItemDTO.Note == "" {
+		utils.Dispatch400Error(w, "A note explaining the resolution is required", nil)
+		return
+	}
+	item, err := c.settlementImporter.ResolveSuspenseItem(itemID, resolveSuspenseItemDTO.Note)
+	if err != nil {
+		if errors.Is(err, settlement.ErrSuspenseItemNotFound) {
+			utils.Dispatch404Error(w, "Suspense item not found", nil)
+			return
+		}
+		utils.Dispatch500Error(w, err)
+		return
+	}
+	utils.Dispatch200(w, "Suspense item resolved successfully", item)
+}
+
+func settlementPathID(w http.ResponseWriter, r *http.Request, message string) (uint, bool) {
+	id, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		utils.Dispatch400Error(w, message, nil)
+		return 0, false
+	}
+	return uint(id), true
+}
@@ -3,189 +3,287 @@ package controllers
 import (
 	"encoding/json"
 	"errors"
+	"io"
 	"net/http"
+	"time"
 
+	"github.com/gorilla/mux"
 	"github.com/midedickson/simple-banking-app/constants"
 	"github.com/midedickson/simple-banking-app/dto"
 	"github.com/midedickson/simple-banking-app/external"
+	"github.com/midedickson/simple-banking-app/fx"
 	"github.com/midedickson/simple-banking-app/idempotency"
+	"github.com/midedickson/simple-banking-app/reconciliation"
 	"github.com/midedickson/simple-banking-app/repository"
+	"github.com/midedickson/simple-banking-app/settlement"
 	"github.com/midedickson/simple-banking-app/utils"
-	"github.com/shopspring/decimal"
+	"github.com/midedickson/simple-banking-app/webhooks"
 )
 
 type Controller struct {
-	repo             repository.Repository
-	external         external.External
-	idempotencyStore idempotency.IdempotencyStore
+	repo               repository.Repository
+	external           external.External
+	idempotencyStore   idempotency.IdempotencyStore
+	quoter             *fx.Quoter
+	webhookVerifier    *webhooks.Verifier
+	reconciler         *reconciliation.Engine
+	settlementImporter *settlement.Importer
+	// how long a hold reserves funds before it expires
+	holdTTL time.Duration
 }
 
-func NewController(repo repository.Repository, external external.External, idempotencyStore idempotency.IdempotencyStore) *Controller {
-	return &Controller{repo: repo, external: external, idempotencyStore: idempotencyStore}
+// the collaborators only some routes need, set the ones for the routes being served;
+// without a webhook verifier the partner webhook route answers 503
+type Options struct {
+	Quoter             *fx.Quoter
+	WebhookVerifier    *webhooks.Verifier
+	Reconciler         *reconciliation.Engine
+	SettlementImporter *settlement.Importer
+	// how long a hold reserves funds before it expires
+	HoldTTL time.Duration
 }
 
-// func (c *Controller) CheckIdempotencyKeyStatus(key string) (string, error) {
-
-// 	return status, nil
-// }
+func NewController(repo repository.Repository, external external.External, idempotencyStore idempotency.IdempotencyStore, options Options) *Controller {
+	return &Controller{
+		repo:               repo,
+		external:           external,
+		idempotencyStore:   idempotencyStore,
+		quoter:             options.Quoter,
+		webhookVerifier:    options.WebhookVerifier,
+		reconciler:         options.Reconciler,
+		settlementImporter: options.SettlementImporter,
+		holdTTL:            options.HoldTTL,
+	}
+}
 
 func (c *Controller) CreateCreditTransaction(w http.ResponseWriter, r *http.Request) {
 	key := r.Header.Get("X-Idempotency-Key")
-	if key == "" {
-		utils.Dispatch400Error(w, "Idempotency Key is required", nil)
-		return
-	}
-	status, err := c.idempotencyStore.CheckIdempotencyKeyStatus(key)
-	if err != nil {
-		utils.Dispatch400Error(w, "Idempotency Key is required", nil)
+	claim, ok := c.startIdempotentRequest(w, r, key, c.resumeTransaction)
+	if !ok {
 		return
 	}
-	switch status {
-	case constants.SUCCESS:
-		utils.Dispatch409Error(w, "Idempotency Key has already been processed", status)
-		return
-	case constants.WAITING:
-		c.idempotencyStore.UpdateIdempotencyKeyStatus(key, constants.PROCESSING)
-	case constants.PROCESSING:
-		utils.Dispatch409Error(w, "A similar is already being processed, please wait to get the a feedback and try again later if it doesn't work.", status)
-		return
-	case constants.FAILED:
-		utils.Dispatch500Error(w, errors.New("a similar transaction has failed, please try again"))
+	defer claim.done()
+	if ok := c.checkThirdPartyAvailable(w); !ok {
+		c.updateIdempotencyKeyStatus(claim, constants.CAN_RETRY)
 		return
 	}
 	var createTransactionDTO dto.CreateTransactionDTO
-	err = json.NewDecoder(r.Body).Decode(&createTransactionDTO)
+	err := json.NewDecoder(r.Body).Decode(&createTransactionDTO)
 	if err != nil {
-		c.idempotencyStore.UpdateIdempotencyKeyStatus(key, constants.FAILED)
+		c.updateIdempotencyKeyStatus(claim, constants.FAILED)
 		utils.Dispatch400Error(w, "Invalid request payload", err)
 		return
 	}
-	zero := decimal.NewFromInt(0)
-	amountToAdd := decimal.NewFromFloat(createTransactionDTO.Amount)
-
-	if amountToAdd.LessThanOrEqual(zero) {
-		c.idempotencyStore.UpdateIdempotencyKeyStatus(key, constants.FAILED)
-
-		utils.Dispatch400Error(w, "Invalid Amount", nil)
-		return
-	}
 	userAccount := c.repo.FindAccountById(createTransactionDTO.AccountID)
 	if userAccount == nil {
-		c.idempotencyStore.UpdateIdempotencyKeyStatus(key, constants.FAILED)
-
+		c.updateIdempotencyKeyStatus(claim, constants.FAILED)
 		utils.Dispatch400Error(w, "Invalid account ID", nil)
 		return
 	}
-	createDBTransactionDTO := &dto.CreateDBTransactionDTO{
-		AccountID: createTransactionDTO.AccountID,
-		Amount:    createTransactionDTO.Amount,
-		Direction: constants.DirectionCredit,
-	}
-
-	transaction, err := c.repo.CreateTransaction(createDBTransactionDTO)
+	transactionCurrency, err := utils.ResolveCurrency(createTransactionDTO.Currency, userAccount.Currency)
 	if err != nil {
-		c.idempotencyStore.UpdateIdempotencyKeyStatus(key, constants.FAILED)
-		utils.Dispatch500Error(w, err)
+		c.updateIdempotencyKeyStatus(claim, constants.FAILED)
+		if errors.Is(err, constants.ErrCurrencyMismatch) {
+			utils.Dispatch422Error(w, "Invalid Currency", err.Error())
+			return
+		}
+		utils.Dispatch400Error(w, "Invalid Currency", err.Error())
 		return
 	}
-	// send transaction to the third-party system
-	err = c.external.ForwardTransactionToThirdParty(transaction)
-	if err != nil {
-		c.idempotencyStore.UpdateIdempotencyKeyStatus(key, constants.FAILED)
-		c.repo.UpdateTransactionStatus(transaction, constants.FAILED)
-		utils.Dispatch500Error(w, err)
+	if err := utils.ValidateAmount(createTransactionDTO.Amount, transactionCurrency.Exponent); err != nil {
+		c.updateIdempotencyKeyStatus(claim, constants.FAILED)
+		utils.Dispatch400Error(w, "Invalid Amount", err.Error())
 		return
 	}
+	createDBTransactionDTO := &dto.CreateDBTransactionDTO{
+		AccountID:      createTransactionDTO.AccountID,
+		Amount:         createTransactionDTO.Amount,
+		Direction:      constants.DirectionCredit,
+		Currency:       transactionCurrency.Code,
+		IdempotencyKey: key,
+	}
 
-	err = userAccount.Credit(transaction.Amount)
+	transaction, err := c.repo.CreateTransaction(createDBTransactionDTO)
 	if err != nil {
-		c.idempotencyStore.UpdateIdempotencyKeyStatus(key, constants.FAILED)
-		c.repo.UpdateTransactionStatus(transaction, constants.FAILED)
+		c.failIdempotentRequest(claim, err)
 		utils.Dispatch500Error(w, err)
 		return
 	}
-	c.idempotencyStore.UpdateIdempotencyKeyStatus(key, constants.SUCCESS)
-	c.repo.UpdateTransactionStatus(transaction, constants.SUCCESS)
-
-	utils.Dispatch200(w, "Transaction created successfully", transaction)
+	// the dispatcher forwards the transaction to the third party and settles it
+	c.completeIdempotentRequest(w, claim, http.StatusAccepted, "Transaction accepted for processing", transaction)
 }
 
 func (c *Controller) CreateDebitTransaction(w http.ResponseWriter, r *http.Request) {
 	key := r.Header.Get("X-Idempotency-Key")
-
-	status, err := c.idempotencyStore.CheckIdempotencyKeyStatus(key)
-	if err != nil {
-		utils.Dispatch422Error(w, "Invalid or missing Idempotency Key", nil)
+	claim, ok := c.startIdempotentRequest(w, r, key, c.resumeTransaction)
+	if !ok {
 		return
 	}
-	switch status {
-	case constants.SUCCESS:
-		utils.Dispatch409Error(w, "Idempotency Key has already been processed", status)
-		return
-	case constants.WAITING:
-		c.idempotencyStore.UpdateIdempotencyKeyStatus(key, constants.PROCESSING)
-	case constants.PROCESSING:
-		utils.Dispatch409Error(w, "A similar transaction is already being processed, please wait to get the a feedback and try again later if it doesn't work.", status)
-		return
-	case constants.FAILED:
-		utils.Dispatch409Error(w, "A similar transaction has failed, please try again.", status)
+	defer claim.done()
+	if ok := c.checkThirdPartyAvailable(w); !ok {
+		c.updateIdempotencyKeyStatus(claim, constants.CAN_RETRY)
 		return
 	}
 	var createTransactionDTO dto.CreateTransactionDTO
-	err = json.NewDecoder(r.Body).Decode(&createTransactionDTO)
+	err := json.NewDecoder(r.Body).Decode(&createTransactionDTO)
 	if err != nil {
-		c.idempotencyStore.UpdateIdempotencyKeyStatus(key, constants.FAILED)
+		c.updateIdempotencyKeyStatus(claim, constants.FAILED)
 		utils.Dispatch400Error(w, "Invalid request payload", err)
 		return
 	}
-	zero := decimal.NewFromInt(0)
-	amountToAdd := decimal.NewFromFloat(createTransactionDTO.Amount)
-
-	if amountToAdd.LessThanOrEqual(zero) {
-		c.idempotencyStore.UpdateIdempotencyKeyStatus(key, constants.FAILED)
-		utils.Dispatch400Error(w, "Invalid Amount", nil)
-		return
-	}
 	userAccount := c.repo.FindAccountById(createTransactionDTO.AccountID)
 	if userAccount == nil {
-		c.idempotencyStore.UpdateIdempotencyKeyStatus(key, constants.FAILED)
+		c.updateIdempotencyKeyStatus(claim, constants.FAILED)
 		utils.Dispatch400Error(w, "Invalid account ID", nil)
 		return
 	}
-
+	transactionCurrency, err := utils.ResolveCurrency(createTransactionDTO.Currency, userAccount.Currency)
+	if err != nil {
+		c.updateIdempotencyKeyStatus(claim, constants.FAILED)
+		if errors.Is(err, constants.ErrCurrencyMismatch) {
+			utils.Dispatch422Error(w, "Invalid Currency", err.Error())
+			return
+		}
+		utils.Dispatch400Error(w, "Invalid Currency", err.Error())
+		return
+	}
+	if err := utils.ValidateAmount(createTransactionDTO.Amount, transactionCurrency.Exponent); err != nil {
+		c.updateIdempotencyKeyStatus(claim, constants.FAILED)
+		utils.Dispatch400Error(w, "Invalid Amount", err.Error())
+		return
+	}
 	createDBTransactionDTO := &dto.CreateDBTransactionDTO{
-		AccountID: createTransactionDTO.AccountID,
-		Amount:    createTransactionDTO.Amount,
-		Direction: constants.DirectionDebit,
+		AccountID:      createTransactionDTO.AccountID,
+		Amount:         createTransactionDTO.Amount,
+		Direction:      constants.DirectionDebit,
+		Currency:       transactionCurrency.Code,
+		IdempotencyKey: key,
 	}
 
+	// the repository holds the amount until the debit settles, refusing what the available balance cannot cover
 	transaction, err := c.repo.CreateTransaction(createDBTransactionDTO)
 	if err != nil {
+		c.failIdempotentRequest(claim, err)
+		if errors.Is(err, constants.ErrInsufficientFunds) {
+			utils.Dispatch400Error(w, "Insufficient funds", err)
+			return
+		}
 		utils.Dispatch500Error(w, err)
 		return
 	}
-	// send transaction to the third-party system
-	err = c.external.ForwardTransactionToThirdParty(transaction)
+	// the dispatcher forwards the transaction to the third party and settles it
+	c.completeIdempotentRequest(w, claim, http.StatusAccepted, "Transaction accepted for processing", transaction)
+}
+
+// picks up a request whose lease ran out, reports whether a response was sent;
+// a transaction that was already created is queued for delivery, requests that never created one run again
+func (c *Controller) resumeTransaction(w http.ResponseWriter, claim *idempotencyClaim) bool {
+	transactions, err := c.repo.FetchTransactionsByIdempotencyKey(claim.key)
 	if err != nil {
-		c.idempotencyStore.UpdateIdempotencyKeyStatus(key, constants.FAILED)
-		c.repo.UpdateTransactionStatus(transaction, constants.FAILED)
+		c.updateIdempotencyKeyStatus(claim, constants.CAN_RETRY)
 		utils.Dispatch500Error(w, err)
+		return true
+	}
+	if len(transactions) == 0 {
+		return false
+	}
+	transaction := transactions[0]
+	if transaction.Status == constants.FAILED {
+		c.updateIdempotencyKeyStatus(claim, constants.FAILED)
+		utils.Dispatch409Error(w, "A similar transaction has failed, please try again.", constants.FAILED)
+		return true
+	}
+	c.completeIdempotentRequest(w, claim, http.StatusAccepted, "Transaction accepted for processing", transaction)
+	return true
+}
+
+// refunds a successful credit or debit in full or in part through a compensating transaction,
+// which is forwarded to the third party and settled like any other
+func (c *Controller) ReverseTransaction(w http.ResponseWriter, r *http.Request) {
+	key := r.Header.Get("X-Idempotency-Key")
+	claim, ok := c.startIdempotentRequest(w, r, key, c.resumeTransaction)
+	if !ok {
+		return
+	}
+	defer claim.done()
+	if ok := c.checkThirdPartyAvailable(w); !ok {
+		c.updateIdempotencyKeyStatus(claim, constants.CAN_RETRY)
+		return
+	}
+	var reverseTransactionDTO dto.ReverseTransactionDTO
+	// an empty body reverses whatever has not been reversed yet
+	err := json.NewDecoder(r.Body).Decode(&reverseTransactionDTO)
+	if err != nil && !errors.Is(err, io.EOF) {
+		c.updateIdempotencyKeyStatus(claim, constants.FAILED)
+		utils.Dispatch400Error(w, "Invalid request payload", err)
+		return
+	}
+	reference := mux.Vars(r)["reference"]
+	original := c.repo.FetchTransactionDetailsByReference(reference)
+	if original == nil {
+		c.updateIdempotencyKeyStatus(claim, constants.FAILED)
+		utils.Dispatch404Error(w, "Transaction not found", nil)
 		return
 	}
-	err = userAccount.Debit(transaction.Amount)
+	if reverseTransactionDTO.Amount != nil {
+		transactionCurrency, err := utils.ResolveCurrency(original.Currency, original.Currency)
+		if err != nil {
+			c.updateIdempotencyKeyStatus(claim, constants.FAILED)
+			utils.Dispatch400Error(w, "Invalid Currency", err.Error())
+			return
+		}
+		if err := utils.ValidateAmount(*reverseTransactionDTO.Amount, transactionCurrency.Exponent); err != nil {
+			c.updateIdempotencyKeyStatus(claim, constants.FAILED)
+			utils.Dispatch400Error(w, "Invalid Amount", err.Error())
+			return
+		}
+	}
+	reversal, err := c.repo.CreateReversal(&dto.CreateDBReversalDTO{
+		Reference:      reference,
+		Amount:         reverseTransactionDTO.Amount,
+		IdempotencyKey: key,
+	})
 	if err != nil {
-		c.idempotencyStore.UpdateIdempotencyKeyStatus(key, constants.FAILED)
-		c.repo.UpdateTransactionStatus(transaction, constants.FAILED)
-		utils.Dispatch400Error(w, "Insufficient funds", err)
+		c.failIdempotentRequest(claim, err)
+		switch {
+		case errors.Is(err, constants.ErrTransactionNotFound):
+			utils.Dispatch404Error(w, "Transaction not found", nil)
+		case errors.Is(err, constants.ErrTransactionNotReversible):
+			utils.Dispatch409Error(w, "Transaction cannot be reversed", err.Error())
+		case errors.Is(err, constants.ErrReversalExceedsAmount):
+			utils.Dispatch422Error(w, "Invalid Amount", err.Error())
+		case errors.Is(err, constants.ErrInsufficientFunds):
+			utils.Dispatch400Error(w, "Insufficient funds", err)
+		default:
+			utils.Dispatch500Error(w, err)
+		}
 		return
 	}
-	c.idempotencyStore.UpdateIdempotencyKeyStatus(key, constants.SUCCESS)
-	c.repo.UpdateTransactionStatus(transaction, constants.SUCCESS)
+	// the dispatcher forwards the reversal to the third party and settles it
+	c.completeIdempotentRequest(w, claim, http.StatusAccepted, "Reversal accepted for processing", reversal)
+}
 
-	utils.Dispatch200(w, "Transaction created successfully", transaction)
+func (c *Controller) FetchTransactionDetails(w http.ResponseWriter, r *http.Request) {
+	reference := mux.Vars(r)["reference"]
+	transaction := c.repo.FetchTransactionDetailsByReference(reference)
+	if transaction == nil {
+		utils.Dispatch404Error(w, "Transaction not found", nil)
+		return
+	}
+	transactionDetails := &dto.TransactionDetailsDTO{Transaction: transaction}
+	// merge in the third-party view of the transaction only when asked for,
+	// a failure there should not hide our own record of the transaction
+	if r.URL.Query().Get("include") == "external" {
+		externalTransaction, err := c.external.FetchTransactionDetailsFromThirdParty(reference)
+		if err != nil {
+			transactionDetails.ExternalError = err.Error()
+		} else {
+			transactionDetails.External = externalTransaction
+		}
+	}
+	utils.Dispatch200(w, "Transaction details fetched successfully", transactionDetails)
 }
-func (c *Controller) FetchTransactionDetails(w http.ResponseWriter, r *http.Request) {}
-func (c *Controller) FetchUserAccountDetails(w http.ResponseWriter, r *http.Request) {}
+
 func (c *Controller) Hello(w http.ResponseWriter, r *http.Request) {
 	utils.Dispatch200(w, "hello, you have reached simple banking api", nil)
 }
@@ -0,0 +1,125 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/midedickson/simple-banking-app/constants"
+	"github.com/midedickson/simple-banking-app/dto"
+	"github.com/midedickson/simple-banking-app/utils"
+)
+
+func (c *Controller) CreateTransfer(w http.ResponseWriter, r *http.Request) {
+	key := r.Header.Get("X-Idempotency-Key")
+	claim, ok := c.startIdempotentRequest(w, r, key, c.resumeTransfer)
+	if !ok {
+		return
+	}
+	defer claim.done()
+	var createTransferDTO dto.CreateTransferDTO
+	err := json.NewDecoder(r.Body).Decode(&createTransferDTO)
+	if err != nil {
+		c.updateIdempotencyKeyStatus(claim, constants.FAILED)
+		utils.Dispatch400Error(w, "Invalid request payload", err)
+		return
+	}
+	if createTransferDTO.SourceAccountID == createTransferDTO.DestinationAccountID {
+		c.updateIdempotencyKeyStatus(claim, constants.FAILED)
+		utils.Dispatch400Error(w, "Source and destination accounts must be different", nil)
+		return
+	}
+	sourceAccount := c.repo.FindAccountById(createTransferDTO.SourceAccountID)
+	if sourceAccount == nil {
+		c.updateIdempotencyKeyStatus(claim, constants.FAILED)
+		utils.Dispatch400Error(w, "Invalid source account ID", nil)
+		return
+	}
+	destinationAccount := c.repo.FindAccountById(createTransferDTO.DestinationAccountID)
+	if destinationAccount == nil {
+		c.updateIdempotencyKeyStatus(claim, constants.FAILED)
+		utils.Dispatch400Error(w, "Invalid destination account ID", nil)
+		return
+	}
+	sourceCurrency, err := utils.ResolveCurrency(sourceAccount.Currency, sourceAccount.Currency)
+	if err != nil {
+		c.updateIdempotencyKeyStatus(claim, constants.FAILED)
+		utils.Dispatch400Error(w, "Invalid Currency", err.Error())
+		return
+	}
+	if err := utils.ValidateAmount(createTransferDTO.Amount, sourceCurrency.Exponent); err != nil {
+		c.updateIdempotencyKeyStatus(claim, constants.FAILED)
+		utils.Dispatch400Error(w, "Invalid Amount", err.Error())
+		return
+	}
+	createDBTransferDTO := &dto.CreateDBTransferDTO{
+		SourceAccountID:      sourceAccount.ID,
+		DestinationAccountID: destinationAccount.ID,
+		Amount:               createTransferDTO.Amount,
+		DestinationAmount:    createTransferDTO.Amount,
+		IdempotencyKey:       key,
+	}
+	if sourceAccount.Currency != destinationAccount.Currency {
+		destinationCurrency, err := utils.ResolveCurrency(destinationAccount.Currency, destinationAccount.Currency)
+		if err != nil {
+			c.updateIdempotencyKeyStatus(claim, constants.FAILED)
+			utils.Dispatch400Error(w, "Invalid Currency", err.Error())
+			return
+		}
+		quote, err := c.fetchTransferQuote(createTransferDTO.QuoteID, sourceCurrency.Code, destinationCurrency.Code)
+		if err != nil {
+			c.updateIdempotencyKeyStatus(claim, constants.FAILED)
+			utils.Dispatch422Error(w, "Invalid FX Quote", err.Error())
+			return
+		}
+		createDBTransferDTO.DestinationAmount = quote.Convert(createTransferDTO.Amount, destinationCurrency.Exponent)
+		createDBTransferDTO.FXRate = &quote.Rate
+		createDBTransferDTO.QuoteID = quote.ID
+		if !createDBTransferDTO.DestinationAmount.IsPositive() {
+			c.updateIdempotencyKeyStatus(claim, constants.FAILED)
+			utils.Dispatch400Error(w, "Invalid Amount", "converted amount is too small")
+			return
+		}
+	}
+
+	// debit the source and credit the destination atomically
+	transfer, err := c.repo.CreateTransfer(createDBTransferDTO)
+	if err != nil {
+		c.failIdempotentRequest(claim, err)
+		if errors.Is(err, constants.ErrInsufficientFunds) {
+			utils.Dispatch400Error(w, "Insufficient funds", err)
+			return
+		}
+		if errors.Is(err, constants.ErrQuoteNotFound) || errors.Is(err, constants.ErrQuoteExpired) || errors.Is(err, constants.ErrQuoteUsed) || errors.Is(err, constants.ErrQuoteMismatch) {
+			utils.Dispatch422Error(w, "Invalid FX Quote", err.Error())
+			return
+		}
+		utils.Dispatch500Error(w, err)
+		return
+	}
+	c.completeIdempotentRequest(w, claim, http.StatusOK, "Transfer created successfully", transfer)
+}
+
+// both legs of a transfer are written together, so a request whose lease ran out
+// either finished the transfer or never started it
+func (c *Controller) resumeTransfer(w http.ResponseWriter, claim *idempotencyClaim) bool {
+	transactions, err := c.repo.FetchTransactionsByIdempotencyKey(claim.key)
+	if err != nil {
+		c.updateIdempotencyKeyStatus(claim, constants.CAN_RETRY)
+		utils.Dispatch500Error(w, err)
+		return true
+	}
+	if len(transactions) == 0 {
+		return false
+	}
+	transfer := &dto.TransferDTO{TransferID: transactions[0].TransferID}
+	for _, transaction := range transactions {
+		if transaction.Direction == constants.DirectionDebit {
+			transfer.Debit = transaction
+		} else {
+			transfer.Credit = transaction
+		}
+	}
+	c.completeIdempotentRequest(w, claim, http.StatusOK, "Transfer created successfully", transfer)
+	return true
+}
@@ -0,0 +1,68 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/midedickson/simple-banking-app/constants"
+	"github.com/midedickson/simple-banking-app/dto"
+	"github.com/midedickson/simple-banking-app/models"
+	"github.com/midedickson/simple-banking-app/utils"
+)
+
+// largest webhook body read, partner events are a few hundred bytes
+const maxWebhookBodySize = 1 << 20
+
+// the partner confirms processed transactions here, a non-2xx answer makes it deliver the event again
+func (c *Controller) ReceivePartnerWebhook(w http.ResponseWriter, r *http.Request) {
+	if c.webhookVerifier == nil {
+		utils.Dispatch503Error(w, "Partner webhooks are not configured", nil)
+		return
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxWebhookBodySize))
+	if err != nil {
+		utils.Dispatch400Error(w, "Invalid request payload", err.Error())
+		return
+	}
+	// the signature covers the raw body, so it is checked before anything is decoded
+	if err := c.webhookVerifier.Verify(r.Header, body, time.Now()); err != nil {
+		log.Printf("rejected partner webhook: %s", err)
+		utils.Dispatch401Error(w, "Invalid webhook signature", err.Error())
+		return
+	}
+	var event dto.PartnerWebhookDTO
+	if err := json.Unmarshal(body, &event); err != nil {
+		utils.Dispatch400Error(w, "Invalid request payload", err.Error())
+		return
+	}
+	if event.EventID == "" || event.Reference == "" {
+		utils.Dispatch400Error(w, "Invalid request payload", "event_id and reference are required")
+		return
+	}
+	if event.Status != constants.PartnerEventCompleted && event.Status != constants.PartnerEventFailed {
+		utils.Dispatch422Error(w, "Invalid webhook status", event.Status)
+		return
+	}
+	transaction, err := c.repo.ApplyWebhookEvent(&models.WebhookEvent{
+		EventID:    event.EventID,
+		Reference:  event.Reference,
+		Status:     event.Status,
+		ReceivedAt: time.Now(),
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, constants.ErrDuplicateWebhookEvent):
+			utils.Dispatch200(w, "Webhook event already processed", nil)
+		case errors.Is(err, constants.ErrTransactionNotFound):
+			utils.Dispatch404Error(w, "Transaction not found", nil)
+		default:
+			utils.Dispatch500Error(w, err)
+		}
+		return
+	}
+	utils.Dispatch200(w, "Webhook event processed", transaction)
+}
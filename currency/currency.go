@@ -0,0 +1,30 @@
+package currency
+
+import "strings"
+
+// ISO 4217 currency metadata
+type Currency struct {
+	Code string `json:"code"`
+	Name string `json:"name"`
+	// number of decimal places in the currency's minor unit
+	Exponent int32 `json:"exponent"`
+}
+
+// currencies the service can hold accounts in
+var registry = map[string]Currency{
+	"NGN": {Code: "NGN", Name: "Nigerian Naira", Exponent: 2},
+	"USD": {Code: "USD", Name: "US Dollar", Exponent: 2},
+	"EUR": {Code: "EUR", Name: "Euro", Exponent: 2},
+	"GBP": {Code: "GBP", Name: "Pound Sterling", Exponent: 2},
+	"GHS": {Code: "GHS", Name: "Ghana Cedi", Exponent: 2},
+	"KES": {Code: "KES", Name: "Kenyan Shilling", Exponent: 2},
+	"XOF": {Code: "XOF", Name: "CFA Franc BCEAO", Exponent: 0},
+	"JPY": {Code: "JPY", Name: "Yen", Exponent: 0},
+	"KWD": {Code: "KWD", Name: "Kuwaiti Dinar", Exponent: 3},
+}
+
+// Lookup finds a supported currency by its ISO 4217 code, the code is case-insensitive
+func Lookup(code string) (Currency, bool) {
+	c, ok := registry[strings.ToUpper(code)]
+	return c, ok
+}
@@ -0,0 +1,17 @@
+package dto
+
+import (
+	"github.com/midedickson/simple-banking-app/models"
+	"github.com/shopspring/decimal"
+)
+
+// data transfer object for returning an account with its recent activity
+type AccountDetailsDTO struct {
+	AccountID          int                   `json:"account_id"`
+	LedgerBalance      decimal.Decimal       `json:"ledger_balance"`
+	AvailableBalance   decimal.Decimal       `json:"available_balance"`
+	HeldBalance        decimal.Decimal       `json:"held_balance"`
+	Currency           string                `json:"currency"`
+	Status             string                `json:"status"`
+	RecentTransactions []*models.Transaction `json:"recent_transactions"`
+}
@@ -0,0 +1,7 @@
+package dto
+
+// data transfer object for requesting an fx quote
+type CreateFXQuoteDTO struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
@@ -0,0 +1,11 @@
+package dto
+
+import "time"
+
+// data transfer object for running a reconciliation over [from, to)
+type CreateReconciliationDTO struct {
+	From time.Time `json:"from"`
+	To   time.Time `json:"to"`
+	// the partner's records for the window; when absent each transaction is fetched from the partner
+	Records []*ForwardTransactionDTO `json:"records,omitempty"`
+}
@@ -1,14 +1,36 @@
 package dto
 
+import "github.com/shopspring/decimal"
+
 // data transfer object for creating transaction
 type CreateTransactionDTO struct {
-	Amount    float64 `json:"amount"`
-	AccountID int     `json:"account_id"`
+	Amount    decimal.Decimal `json:"amount"`
+	AccountID int             `json:"account_id"`
+	Currency  string          `json:"currency"` // optional, defaults to the account currency
+}
+
+// data transfer object for reversing a successful transaction
+type ReverseTransactionDTO struct {
+	// optional, the amount not reversed yet when absent
+	Amount *decimal.Decimal `json:"amount,omitempty"`
+}
+
+// data transfer object for creating a reversal in the database
+type CreateDBReversalDTO struct {
+	// reference of the transaction being reversed
+	Reference string `json:"reference"`
+	// nil reverses whatever has not been reversed yet
+	Amount *decimal.Decimal `json:"amount,omitempty"`
+	// key of the request creating the reversal
+	IdempotencyKey string `json:"-"`
 }
 
 // data transfer object for creating transaction in the database
 type CreateDBTransactionDTO struct {
-	Amount    float64 `json:"amount"`
-	AccountID int     `json:"account_id"`
-	Direction string  `json:"direction"`
+	Amount    decimal.Decimal `json:"amount"`
+	AccountID int             `json:"account_id"`
+	Direction string          `json:"direction"`
+	Currency  string          `json:"currency"`
+	// key of the request creating the transaction
+	IdempotencyKey string `json:"-"`
 }
@@ -0,0 +1,38 @@
+package dto
+
+import (
+	"github.com/midedickson/simple-banking-app/models"
+	"github.com/shopspring/decimal"
+)
+
+// data transfer object for moving funds between two accounts
+type CreateTransferDTO struct {
+	SourceAccountID      int             `json:"source_account_id"`
+	DestinationAccountID int             `json:"destination_account_id"`
+	Amount               decimal.Decimal `json:"amount"`
+	// fx quote to execute a cross-currency transfer at, a fresh quote is used when empty
+	QuoteID string `json:"quote_id,omitempty"`
+}
+
+// data transfer object for creating both legs of a transfer in the database
+type CreateDBTransferDTO struct {
+	SourceAccountID      int
+	DestinationAccountID int
+	// amount debited in the source currency
+	Amount decimal.Decimal
+	// amount credited in the destination currency, equal to Amount when no conversion happens
+	DestinationAmount decimal.Decimal
+	// rate applied for cross-currency transfers, nil otherwise
+	FXRate *decimal.Decimal
+	// fx quote the rate came from, used up in the same database transaction as the transfer
+	QuoteID string
+	// key of the request creating the transfer, recorded on both legs
+	IdempotencyKey string
+}
+
+// data transfer object for returning both legs of a transfer
+type TransferDTO struct {
+	TransferID string              `json:"transfer_id"`
+	Debit      *models.Transaction `json:"debit"`
+	Credit     *models.Transaction `json:"credit"`
+}
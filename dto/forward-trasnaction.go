@@ -1,7 +1,15 @@
 package dto
 
+import "github.com/shopspring/decimal"
+
 type ForwardTransactionDTO struct {
-	Reference string  `json:"reference"`
-	AccountID int     `json:"account_id"`
-	Amount    float64 `json:"amount"`
+	Reference string          `json:"reference"`
+	AccountID int             `json:"account_id"`
+	Amount    decimal.Decimal `json:"amount"`
+	Currency  string          `json:"currency"`
+	// reference of the transaction being refunded, only set on reversals
+	ReversalOf string `json:"reversal_of,omitempty"`
+	// the partner's outcome, constants.PartnerEventCompleted or constants.PartnerEventFailed;
+	// only set on records returned by the partner
+	Status string `json:"status,omitempty"`
 }
@@ -0,0 +1,46 @@
+package dto
+
+import (
+	"time"
+
+	"github.com/midedickson/simple-banking-app/models"
+	"github.com/shopspring/decimal"
+)
+
+// data transfer object for placing a hold on an account
+type CreateHoldDTO struct {
+	Amount    decimal.Decimal `json:"amount"`
+	AccountID int             `json:"account_id"`
+	Currency  string          `json:"currency"` // optional, defaults to the account currency
+}
+
+// data transfer object for placing a hold in the database
+type CreateDBHoldDTO struct {
+	Amount    decimal.Decimal `json:"amount"`
+	AccountID int             `json:"account_id"`
+	Currency  string          `json:"currency"`
+	ExpiresAt time.Time       `json:"expires_at"`
+	// key of the request placing the hold
+	IdempotencyKey string `json:"-"`
+}
+
+// data transfer object for capturing a hold
+type CaptureHoldDTO struct {
+	// optional, the whole hold when absent
+	Amount *decimal.Decimal `json:"amount,omitempty"`
+}
+
+// data transfer object for capturing a hold in the database
+type CaptureDBHoldDTO struct {
+	// reference of the hold being captured
+	Reference string           `json:"reference"`
+	Amount    *decimal.Decimal `json:"amount,omitempty"`
+	// key of the request capturing the hold
+	IdempotencyKey string `json:"-"`
+}
+
+// a hold with the transaction recording the step that was just taken on it
+type HoldDTO struct {
+	Hold        *models.Hold        `json:"hold"`
+	Transaction *models.Transaction `json:"transaction"`
+}
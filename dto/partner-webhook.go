@@ -0,0 +1,13 @@
+package dto
+
+import "time"
+
+// sent by the third party once it has processed a transaction
+type PartnerWebhookDTO struct {
+	EventID   string `json:"event_id"`
+	Reference string `json:"reference"`
+	// constants.PartnerEventCompleted or constants.PartnerEventFailed
+	Status    string    `json:"status"`
+	Reason    string    `json:"reason,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
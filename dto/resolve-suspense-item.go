@@ -0,0 +1,7 @@
+package dto
+
+// data transfer object for closing a settlement suspense item
+type ResolveSuspenseItemDTO struct {
+	// what ops did about the entry, kept on the item
+	Note string `json:"note"`
+}
@@ -0,0 +1,10 @@
+package dto
+
+import "github.com/midedickson/simple-banking-app/models"
+
+// data transfer object for returning a transaction, optionally enriched with the third-party view
+type TransactionDetailsDTO struct {
+	Transaction   *models.Transaction    `json:"transaction"`
+	External      *ForwardTransactionDTO `json:"external,omitempty"`
+	ExternalError string                 `json:"external_error,omitempty"`
+}
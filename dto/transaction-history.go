@@ -0,0 +1,39 @@
+package dto
+
+import (
+	"time"
+
+	"github.com/midedickson/simple-banking-app/models"
+	"github.com/shopspring/decimal"
+)
+
+// position in an account's transaction history, the last transaction of the previous page
+type TransactionCursor struct {
+	CreatedAt time.Time
+	ID        uint
+}
+
+// filters for listing an account's transactions, empty fields do not filter
+type TransactionHistoryFilter struct {
+	AccountID int
+	Direction string
+	Status    string
+	// created at or after From and before To
+	From *time.Time
+	To   *time.Time
+	// inclusive bounds on the amount
+	MinAmount *decimal.Decimal
+	MaxAmount *decimal.Decimal
+	// oldest first when set, newest first otherwise
+	Ascending bool
+	// transactions after this position in the chosen order, the first page when nil
+	After *TransactionCursor
+	Limit int
+}
+
+// data transfer object for returning a page of an account's transactions
+type TransactionPageDTO struct {
+	Transactions []*models.Transaction `json:"transactions"`
+	// pass as ?cursor= with the same filters for the next page, empty on the last page
+	NextCursor string `json:"next_cursor,omitempty"`
+}
@@ -0,0 +1,169 @@
+package external
+
+import (
+	"sync"
+	"time"
+
+	"github.com/midedickson/simple-banking-app/constants"
+)
+
+type CircuitState string
+
+const (
+	// calls go through and their outcomes are counted
+	CircuitClosed CircuitState = "closed"
+	// calls fail fast until the cool-down has passed
+	CircuitOpen CircuitState = "open"
+	// a few probe calls go through to find out whether the third party has recovered
+	CircuitHalfOpen CircuitState = "half_open"
+)
+
+type CircuitBreakerSettings struct {
+	// share of failed calls within the window that opens the breaker
+	FailureRateThreshold float64
+	// calls needed within the window before the failure rate is trusted
+	MinimumCalls int
+	// length of the window calls are counted over while closed
+	Window time.Duration
+	// how long the breaker stays open before letting probe calls through
+	CoolDown time.Duration
+	// probe calls let through while half-open, all of them must succeed to close the breaker
+	HalfOpenCalls int
+}
+
+func DefaultCircuitBreakerSettings() CircuitBreakerSettings {
+	return CircuitBreakerSettings{
+		FailureRateThreshold: 0.5,
+		MinimumCalls:         10,
+		Window:               30 * time.Second,
+		CoolDown:             15 * time.Second,
+		HalfOpenCalls:        3,
+	}
+}
+
+// point-in-time view of a circuit breaker
+type CircuitBreakerState struct {
+	State       CircuitState `json:"state"`
+	Calls       int          `json:"calls"`
+	Failures    int          `json:"failures"`
+	FailureRate float64      `json:"failure_rate"`
+	OpenedAt    *time.Time   `json:"opened_at,omitempty"`
+	// when an open breaker starts letting probe calls through
+	RetryAt *time.Time `json:"retry_at,omitempty"`
+}
+
+type CircuitBreaker struct {
+	settings CircuitBreakerSettings
+	mu       sync.Mutex
+	state    CircuitState
+	// counts for the current window while closed, or for the probes while half-open
+	windowStart time.Time
+	calls       int
+	failures    int
+	successes   int
+	openedAt    time.Time
+	// bumped whenever the counts are reset, so outcomes of calls allowed before the reset are not counted
+	generation uint64
+}
+
+func NewCircuitBreaker(settings CircuitBreakerSettings) *CircuitBreaker {
+	return &CircuitBreaker{settings: settings, state: CircuitClosed, windowStart: time.Now()}
+}
+
+// reports whether a call may go ahead, constants.ErrThirdPartyUnavailable when it may not;
+// every allowed call must be followed by Record with the returned generation
+func (b *CircuitBreaker) Allow() (uint64, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.currentState(time.Now()) {
+	case CircuitOpen:
+		return 0, constants.ErrThirdPartyUnavailable
+	case CircuitHalfOpen:
+		if b.calls >= b.settings.HalfOpenCalls {
+			return 0, constants.ErrThirdPartyUnavailable
+		}
+	}
+	b.calls++
+	return b.generation, nil
+}
+
+// records the outcome of a call let through by Allow
+func (b *CircuitBreaker) Record(generation uint64, failed bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := time.Now()
+	state := b.currentState(now)
+	if generation != b.generation {
+		// the call was allowed in an earlier window, or before the breaker opened or closed
+		return
+	}
+	switch state {
+	case CircuitClosed:
+		if failed {
+			b.failures++
+		}
+		if b.calls >= b.settings.MinimumCalls && b.failureRate() >= b.settings.FailureRateThreshold {
+			b.open(now)
+		}
+	case CircuitHalfOpen:
+		if failed {
+			b.open(now)
+			return
+		}
+		b.successes++
+		if b.successes >= b.settings.HalfOpenCalls {
+			b.reset(CircuitClosed, now)
+		}
+	}
+}
+
+func (b *CircuitBreaker) State() CircuitBreakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	state := CircuitBreakerState{
+		State:       b.currentState(time.Now()),
+		Calls:       b.calls,
+		Failures:    b.failures,
+		FailureRate: b.failureRate(),
+	}
+	if state.State != CircuitClosed {
+		openedAt, retryAt := b.openedAt, b.openedAt.Add(b.settings.CoolDown)
+		state.OpenedAt, state.RetryAt = &openedAt, &retryAt
+	}
+	return state
+}
+
+// moves on from open once the cool-down has passed and starts a new window when the last one ended,
+// callers must hold b.mu
+func (b *CircuitBreaker) currentState(now time.Time) CircuitState {
+	switch b.state {
+	case CircuitOpen:
+		if !now.Before(b.openedAt.Add(b.settings.CoolDown)) {
+			b.reset(CircuitHalfOpen, now)
+		}
+	case CircuitClosed:
+		if now.Sub(b.windowStart) >= b.settings.Window {
+			b.reset(CircuitClosed, now)
+		}
+	}
+	return b.state
+}
+
+func (b *CircuitBreaker) open(now time.Time) {
+	b.reset(CircuitOpen, now)
+	b.openedAt = now
+}
+
+func (b *CircuitBreaker) reset(state CircuitState, now time.Time) {
+	b.state = state
+	b.windowStart = now
+	b.calls, b.failures, b.successes = 0, 0, 0
+	b.generation++
+}
+
+func (b *CircuitBreaker) failureRate() float64 {
+	if b.calls == 0 {
+		return 0
+	}
+	return float64(b.failures) / float64(b.calls)
+}
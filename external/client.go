@@ -0,0 +1,45 @@
+package external
+
+import (
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// anything that can send a request to the third party, *http.Client and the mock client both do
+type HTTPDoer interface {
+	Do(req *http.Request) (*http.Response, error)
+}
+
+// where and how the third party is reached
+type ClientSettings struct {
+	// scheme and host of the partner API, paths such as /transactions are appended to it
+	BaseURL string
+	// upper bound for a whole call, response body included
+	Timeout time.Duration
+	// upper bound for opening a connection
+	ConnectTimeout time.Duration
+	// sent with every request, e.g. credentials issued by the partner
+	Headers map[string]string
+}
+
+func DefaultClientSettings() ClientSettings {
+	return ClientSettings{
+		BaseURL:        "http://third-party-system.com",
+		Timeout:        10 * time.Second,
+		ConnectTimeout: 3 * time.Second,
+	}
+}
+
+// builds a client for a real partner with the timeouts from settings
+func NewHTTPClient(settings ClientSettings) *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = (&net.Dialer{Timeout: settings.ConnectTimeout, KeepAlive: 30 * time.Second}).DialContext
+	transport.TLSHandshakeTimeout = settings.ConnectTimeout
+	return &http.Client{Transport: transport, Timeout: settings.Timeout}
+}
+
+func (s ClientSettings) url(path string) string {
+	return strings.TrimRight(s.BaseURL, "/") + path
+}
@@ -7,44 +7,71 @@ import (
 	"io"
 	"log"
 	"net/http"
+	"net/url"
+	"time"
 
 	"github.com/midedickson/simple-banking-app/constants"
 	"github.com/midedickson/simple-banking-app/dto"
-	mock_client "github.com/midedickson/simple-banking-app/mock"
 	"github.com/midedickson/simple-banking-app/models"
 )
 
 type External interface {
 	ForwardTransactionToThirdParty(transaction *models.Transaction) error
+	FetchTransactionDetailsFromThirdParty(reference string) (*dto.ForwardTransactionDTO, error)
+	CircuitBreakerState() CircuitBreakerState
 }
 
 type TransactionExternal struct {
-	client *mock_client.MockClient
+	client      HTTPDoer
+	settings    ClientSettings
+	retryPolicy RetryPolicy
+	breaker     *CircuitBreaker
 }
 
-func NewTransactionExternal(client *mock_client.MockClient) *TransactionExternal {
-	return &TransactionExternal{client: client}
+func NewTransactionExternal(client HTTPDoer, settings ClientSettings, retryPolicy RetryPolicy, breaker *CircuitBreaker) *TransactionExternal {
+	return &TransactionExternal{client: client, settings: settings, retryPolicy: retryPolicy, breaker: breaker}
 }
 
-func FetchTransactionDetailsFromThirdParty(reference string) (*dto.ForwardTransactionDTO, error) {
+func (e *TransactionExternal) CircuitBreakerState() CircuitBreakerState {
+	return e.breaker.State()
+}
+
+// whether a call outcome says something about the health of the third party,
+// a 4xx such as an unknown reference does not
+func (e *TransactionExternal) unhealthy(resp *http.Response, err error) bool {
+	if resp == nil {
+		return err != nil
+	}
+	return e.retryPolicy.retryableStatus(resp.StatusCode)
+}
+
+func (e *TransactionExternal) FetchTransactionDetailsFromThirdParty(reference string) (*dto.ForwardTransactionDTO, error) {
 	var transaction *dto.ForwardTransactionDTO
-	client := mock_client.CreateNewGETMockClient()
-	req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("http://third-party-system.com/transactions/%s", reference), nil)
+	req, err := e.newRequest(http.MethodGet, fmt.Sprintf("/transactions/%s", url.PathEscape(reference)), nil)
 	if err != nil {
 		log.Printf("failed to create request for third party: %s", err)
 		return nil, err
 	}
-	resp, err := client.Do(req)
+	generation, err := e.breaker.Allow()
+	if err != nil {
+		return nil, err
+	}
+	resp, err := e.client.Do(req)
+	e.breaker.Record(generation, e.unhealthy(resp, err))
 	if err != nil {
 		log.Printf("failed to send request to third party: %s", err)
 		return nil, err
 	}
+	if resp.Body != nil {
+		defer resp.Body.Close()
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, constants.ErrThirdPartyTransactionNotFound
+	}
 	if resp.StatusCode != http.StatusOK {
-		log.Printf("Failed to forward transaction to third party: %s", resp.Status)
-		return nil, constants.ErrThirdPartyFailure
+		log.Printf("Failed to fetch transaction from third party: %s", resp.Status)
+		return nil, fmt.Errorf("%w: status %d", constants.ErrThirdPartyFailure, resp.StatusCode)
 	}
-	log.Printf("Transaction forwarded successfully to third party: %+v", transaction)
-	defer resp.Body.Close()
 	bodyBytes, err := io.ReadAll(resp.Body)
 	if err != nil {
 		log.Printf("failed to parse transaction from third party: %s", err)
@@ -60,31 +87,80 @@ func FetchTransactionDetailsFromThirdParty(reference string) (*dto.ForwardTransa
 }
 
 func (e *TransactionExternal) ForwardTransactionToThirdParty(transaction *models.Transaction) error {
-	client := mock_client.CreateNewPOSTMockClient()
 	forwardTransactionDto := &dto.ForwardTransactionDTO{
-		Reference: transaction.Reference,
-		AccountID: transaction.AccountID,
-		Amount:    transaction.Amount,
+		Reference:  transaction.Reference,
+		AccountID:  transaction.AccountID,
+		Amount:     transaction.Amount,
+		Currency:   transaction.Currency,
+		ReversalOf: transaction.ReversalOf,
 	}
 	data, err := json.Marshal(forwardTransactionDto)
 	if err != nil {
 		log.Printf("failed to marshal transaction data foer third party: %s", err)
 		return err
 	}
-	req, err := http.NewRequest(http.MethodPost, "http://third-party-system.com/transactions", bytes.NewReader(data))
+	attempts := e.retryPolicy.MaxAttempts
+	if attempts < 1 {
+		attempts = 1
+	}
+	for attempt := 1; ; attempt++ {
+		retryable, err := e.forwardOnce(transaction.Reference, data)
+		if err == nil {
+			log.Printf("Transaction %s forwarded successfully to third party after %d attempt(s)", transaction.Reference, attempt)
+			return nil
+		}
+		if !retryable || attempt == attempts {
+			log.Printf("Giving up forwarding transaction %s to third party after %d attempt(s): %s", transaction.Reference, attempt, err)
+			return err
+		}
+		delay := e.retryPolicy.delay(attempt)
+		log.Printf("Retrying transaction %s in %s (attempt %d of %d failed): %s", transaction.Reference, delay, attempt, attempts, err)
+		time.Sleep(delay)
+	}
+}
+
+// sends the transaction once, reports whether a failure is worth retrying
+func (e *TransactionExternal) forwardOnce(reference string, data []byte) (bool, error) {
+	req, err := e.newRequest(http.MethodPost, "/transactions", bytes.NewReader(data))
 	if err != nil {
 		log.Printf("failed to create request for third party: %s", err)
-		return err
+		return false, err
 	}
-	resp, err := client.Do(req)
+	req.Header.Set("Content-Type", "application/json")
+	// the partner deduplicates on this key, which is what makes a retry safe
+	req.Header.Set("Idempotency-Key", reference)
+	// an open breaker ends the retries as well, there is no point waiting out the delays
+	generation, err := e.breaker.Allow()
+	if err != nil {
+		return false, err
+	}
+	resp, err := e.client.Do(req)
+	e.breaker.Record(generation, e.unhealthy(resp, err))
 	if err != nil {
 		log.Printf("failed to send request to third party: %s", err)
-		return err
+		return e.retryPolicy.retryableError(err), err
+	}
+	if resp.Body != nil {
+		defer resp.Body.Close()
 	}
 	if resp.StatusCode != http.StatusOK {
 		log.Printf("Failed to forward transaction to third party: %s", resp.Status)
-		return constants.ErrThirdPartyFailure
+		if !e.retryPolicy.retryableStatus(resp.StatusCode) {
+			// sending the same transaction again gets the same answer
+			return false, fmt.Errorf("%w: status %d", constants.ErrThirdPartyRejected, resp.StatusCode)
+		}
+		return true, fmt.Errorf("%w: status %d", constants.ErrThirdPartyFailure, resp.StatusCode)
+	}
+	return false, nil
+}
+
+func (e *TransactionExternal) newRequest(method string, path string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequest(method, e.settings.url(path), body)
+	if err != nil {
+		return nil, err
+	}
+	for name, value := range e.settings.Headers {
+		req.Header.Set(name, value)
 	}
-	log.Printf("Transaction forwarded successfully to third party: %+v", transaction)
-	return nil
+	return req, nil
 }
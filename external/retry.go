@@ -0,0 +1,69 @@
+package external
+
+import (
+	"math/rand"
+	"net/http"
+	"time"
+)
+
+// how calls to the third party are retried, it is safe to resend a transaction
+// because the partner deduplicates on its reference
+type RetryPolicy struct {
+	// total attempts including the first one, 1 disables retries
+	MaxAttempts int
+	// delay before the first retry, doubled on every retry up to MaxDelay
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	// fraction of each delay that is randomised, so retries from many requests do not line up
+	Jitter float64
+	// responses that are worth another attempt, anything else fails straight away
+	RetryableStatusCodes []int
+	// reports whether a transport error is worth another attempt, every error is when nil
+	RetryableError func(err error) bool
+}
+
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts: 3,
+		BaseDelay:   200 * time.Millisecond,
+		MaxDelay:    2 * time.Second,
+		Jitter:      0.2,
+		RetryableStatusCodes: []int{
+			http.StatusRequestTimeout,
+			http.StatusTooManyRequests,
+			http.StatusInternalServerError,
+			http.StatusBadGateway,
+			http.StatusServiceUnavailable,
+			http.StatusGatewayTimeout,
+		},
+	}
+}
+
+func (p RetryPolicy) retryableStatus(statusCode int) bool {
+	for _, retryable := range p.RetryableStatusCodes {
+		if statusCode == retryable {
+			return true
+		}
+	}
+	return false
+}
+
+func (p RetryPolicy) retryableError(err error) bool {
+	if p.RetryableError == nil {
+		return true
+	}
+	return p.RetryableError(err)
+}
+
+// delay before the given retry, counting from 1
+func (p RetryPolicy) delay(retry int) time.Duration {
+	delay := p.BaseDelay << (retry - 1)
+	if delay <= 0 || delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+	if p.Jitter > 0 {
+		// spread the delay evenly over [delay * (1 - jitter), delay * (1 + jitter)]
+		delay = time.Duration(float64(delay) * (1 + p.Jitter*(2*rand.Float64()-1)))
+	}
+	return delay
+}
@@ -0,0 +1,60 @@
+package fakepartner
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/midedickson/simple-banking-app/dto"
+	"github.com/midedickson/simple-banking-app/webhooks"
+)
+
+// confirms processed transactions to the bank in the background, signed with the shared secret
+type callbacks struct {
+	url    string
+	secret string
+	client *http.Client
+	wg     sync.WaitGroup
+}
+
+func newCallbacks(url string, secret string) *callbacks {
+	return &callbacks{url: url, secret: secret, client: &http.Client{Timeout: 5 * time.Second}}
+}
+
+func (c *callbacks) send(reference string, status string, reason string) {
+	if c.url == "" {
+		return
+	}
+	event := dto.PartnerWebhookDTO{EventID: uuid.NewString(), Reference: reference, Status: status, Reason: reason, CreatedAt: time.Now()}
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+		data, err := json.Marshal(event)
+		if err != nil {
+			log.Printf("fake partner: failed to marshal callback for %s: %s", reference, err)
+			return
+		}
+		req, err := http.NewRequest(http.MethodPost, c.url, bytes.NewReader(data))
+		if err != nil {
+			log.Printf("fake partner: failed to create callback for %s: %s", reference, err)
+			return
+		}
+		req.Header.Set("Content-Type", "application/json")
+		webhooks.SignRequest(req, c.secret, time.Now(), data)
+		resp, err := c.client.Do(req)
+		if err != nil {
+			log.Printf("fake partner: failed to send callback for %s: %s", reference, err)
+			return
+		}
+		resp.Body.Close()
+		log.Printf("fake partner: callback for %s answered %s", reference, resp.Status)
+	}()
+}
+
+func (c *callbacks) wait() {
+	c.wg.Wait()
+}
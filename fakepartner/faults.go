@@ -0,0 +1,120 @@
+package fakepartner
+
+import (
+	"context"
+	"encoding/json"
+	"math/rand"
+	"net/http"
+	"time"
+)
+
+// how the fake partner misbehaves, the zero value answers every request promptly and correctly
+type Faults struct {
+	// added to every request before it is answered
+	Latency time.Duration `json:"-"`
+	// requests are held this long and then answered with a 504, set it above the
+	// client timeout to make calls time out
+	Stall time.Duration `json:"-"`
+	// the next FailNext requests are refused with FailStatus without being processed
+	FailNext int `json:"fail_next"`
+	// share of requests refused with FailStatus without being processed, between 0 and 1
+	FailRate float64 `json:"fail_rate"`
+	// status used for refused requests, 500 when unset
+	FailStatus int `json:"fail_status"`
+	// the next AcceptThenFail transactions are stored but answered with FailStatus,
+	// so the client retries and the partner sees a duplicate
+	AcceptThenFail int `json:"accept_then_fail"`
+	// the next DeclineNext transactions are accepted but confirmed as failed
+	DeclineNext int `json:"decline_next"`
+	// accepted transactions are never confirmed through the callback URL
+	DropCallbacks bool `json:"drop_callbacks"`
+}
+
+func (f *Faults) failStatus() int {
+	if f.FailStatus == 0 {
+		return http.StatusInternalServerError
+	}
+	return f.FailStatus
+}
+
+// consumes one scripted failure, callers must hold the partner lock
+func (f *Faults) refuse() bool {
+	if f.FailNext > 0 {
+		f.FailNext--
+		return true
+	}
+	return f.FailRate > 0 && rand.Float64() < f.FailRate
+}
+
+// consumes one accept-then-fail, callers must hold the partner lock
+func (f *Faults) acceptThenFail() bool {
+	if f.AcceptThenFail > 0 {
+		f.AcceptThenFail--
+		return true
+	}
+	return false
+}
+
+// consumes one decline, callers must hold the partner lock
+func (f *Faults) decline() bool {
+	if f.DeclineNext > 0 {
+		f.DeclineNext--
+		return true
+	}
+	return false
+}
+
+// waits for d, returns false when the client gave up first
+func wait(ctx context.Context, d time.Duration) bool {
+	if d <= 0 {
+		return true
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// durations travel as strings such as "250ms" over PUT /_faults
+type faultsJSON struct {
+	Latency string `json:"latency,omitempty"`
+	Stall   string `json:"stall,omitempty"`
+	faultsAlias
+}
+
+type faultsAlias Faults
+
+func (f Faults) MarshalJSON() ([]byte, error) {
+	wire := faultsJSON{faultsAlias: faultsAlias(f)}
+	if f.Latency > 0 {
+		wire.Latency = f.Latency.String()
+	}
+	if f.Stall > 0 {
+		wire.Stall = f.Stall.String()
+	}
+	return json.Marshal(wire)
+}
+
+func (f *Faults) UnmarshalJSON(data []byte) error {
+	var wire faultsJSON
+	if err := json.Unmarshal(data, &wire); err != nil {
+		return err
+	}
+	*f = Faults(wire.faultsAlias)
+	var err error
+	if wire.Latency != "" {
+		if f.Latency, err = time.ParseDuration(wire.Latency); err != nil {
+			return err
+		}
+	}
+	if wire.Stall != "" {
+		if f.Stall, err = time.ParseDuration(wire.Stall); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,194 @@
+package fakepartner
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"sync"
+
+	"github.com/gorilla/mux"
+	"github.com/midedickson/simple-banking-app/constants"
+	"github.com/midedickson/simple-banking-app/dto"
+)
+
+// an in-memory stand-in for the third-party processor, it speaks the same HTTP API:
+// POST /transactions and GET /transactions/{reference}. Faults can be scripted from Go
+// with SetFaults or over HTTP with PUT /_faults.
+type Partner struct {
+	mu           sync.Mutex
+	faults       Faults
+	transactions map[string]*dto.ForwardTransactionDTO
+	// Idempotency-Key of every stored transaction, the reference when the header was missing
+	keys       map[string]string
+	received   int
+	duplicates int
+	callbacks  *callbacks
+	router     *mux.Router
+}
+
+// accepted transactions are confirmed to callbackURL with webhooks signed with callbackSecret,
+// callbackURL may be empty and they are then never confirmed
+func NewPartner(callbackURL string, callbackSecret string) *Partner {
+	p := &Partner{
+		transactions: make(map[string]*dto.ForwardTransactionDTO),
+		keys:         make(map[string]string),
+		callbacks:    newCallbacks(callbackURL, callbackSecret),
+		router:       mux.NewRouter(),
+	}
+	p.router.HandleFunc("/transactions", p.createTransaction).Methods("POST")
+	p.router.HandleFunc("/transactions/{reference}", p.fetchTransaction).Methods("GET")
+	p.router.HandleFunc("/_faults", p.fetchFaults).Methods("GET")
+	p.router.HandleFunc("/_faults", p.updateFaults).Methods("PUT")
+	return p
+}
+
+func (p *Partner) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	p.router.ServeHTTP(w, r)
+}
+
+func (p *Partner) SetFaults(faults Faults) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.faults = faults
+}
+
+func (p *Partner) Faults() Faults {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.faults
+}
+
+// the stored transaction with this reference, nil when the partner never accepted it
+func (p *Partner) Transaction(reference string) *dto.ForwardTransactionDTO {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.transactions[reference]
+}
+
+// transaction submissions received, duplicates included
+func (p *Partner) Received() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.received
+}
+
+// submissions that repeated an Idempotency-Key the partner had already stored
+func (p *Partner) Duplicates() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.duplicates
+}
+
+// waits for callbacks that are still being sent
+func (p *Partner) Close() {
+	p.callbacks.wait()
+}
+
+// applies latency, stalls and refusals, reports whether the request should be processed
+func (p *Partner) misbehave(w http.ResponseWriter, r *http.Request) bool {
+	p.mu.Lock()
+	faults := p.faults
+	refuse := p.faults.refuse()
+	p.mu.Unlock()
+	if !wait(r.Context(), faults.Latency) {
+		return false
+	}
+	if faults.Stall > 0 {
+		if wait(r.Context(), faults.Stall) {
+			writeJSON(w, http.StatusGatewayTimeout, map[string]string{"error": "request timed out"})
+		}
+		return false
+	}
+	if refuse {
+		writeJSON(w, faults.failStatus(), map[string]string{"error": "scripted failure"})
+		return false
+	}
+	return true
+}
+
+func (p *Partner) createTransaction(w http.ResponseWriter, r *http.Request) {
+	if ok := p.misbehave(w, r); !ok {
+		return
+	}
+	var transaction dto.ForwardTransactionDTO
+	if err := json.NewDecoder(r.Body).Decode(&transaction); err != nil || transaction.Reference == "" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid transaction"})
+		return
+	}
+	key := r.Header.Get("Idempotency-Key")
+	if key == "" {
+		key = transaction.Reference
+	}
+
+	p.mu.Lock()
+	p.received++
+	stored, duplicate := p.transactions[transaction.Reference]
+	if duplicate && p.keys[transaction.Reference] == key {
+		p.duplicates++
+		p.mu.Unlock()
+		log.Printf("fake partner: duplicate submission of %s", transaction.Reference)
+		writeJSON(w, http.StatusOK, stored)
+		return
+	}
+	if duplicate {
+		p.mu.Unlock()
+		writeJSON(w, http.StatusConflict, map[string]string{"error": "reference already used with another idempotency key"})
+		return
+	}
+	acceptThenFail := p.faults.acceptThenFail()
+	decline := p.faults.decline()
+	transaction.Status = constants.PartnerEventCompleted
+	if decline {
+		transaction.Status = constants.PartnerEventFailed
+	}
+	p.transactions[transaction.Reference] = &transaction
+	p.keys[transaction.Reference] = key
+	dropCallback := p.faults.DropCallbacks
+	failStatus := p.faults.failStatus()
+	p.mu.Unlock()
+
+	if dropCallback {
+		log.Printf("fake partner: dropping callback for %s", transaction.Reference)
+	} else if decline {
+		p.callbacks.send(transaction.Reference, constants.PartnerEventFailed, "declined by the partner")
+	} else {
+		p.callbacks.send(transaction.Reference, constants.PartnerEventCompleted, "")
+	}
+	if acceptThenFail {
+		writeJSON(w, failStatus, map[string]string{"error": "scripted failure after accepting the transaction"})
+		return
+	}
+	writeJSON(w, http.StatusOK, &transaction)
+}
+
+func (p *Partner) fetchTransaction(w http.ResponseWriter, r *http.Request) {
+	if ok := p.misbehave(w, r); !ok {
+		return
+	}
+	transaction := p.Transaction(mux.Vars(r)["reference"])
+	if transaction == nil {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "transaction not found"})
+		return
+	}
+	writeJSON(w, http.StatusOK, transaction)
+}
+
+func (p *Partner) fetchFaults(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, p.Faults())
+}
+
+func (p *Partner) updateFaults(w http.ResponseWriter, r *http.Request) {
+	var faults Faults
+	if err := json.NewDecoder(r.Body).Decode(&faults); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	p.SetFaults(faults)
+	writeJSON(w, http.StatusOK, faults)
+}
+
+func writeJSON(w http.ResponseWriter, statusCode int, data any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(data)
+}
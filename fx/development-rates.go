@@ -0,0 +1,12 @@
+package fx
+
+import "github.com/shopspring/decimal"
+
+// indicative mid rates used when no rates file is configured, for local development only
+var DevelopmentRates = map[string]decimal.Decimal{
+	"USD/NGN": decimal.RequireFromString("1500.00"),
+	"EUR/NGN": decimal.RequireFromString("1620.00"),
+	"GBP/NGN": decimal.RequireFromString("1900.00"),
+	"USD/GHS": decimal.RequireFromString("15.50"),
+	"USD/KES": decimal.RequireFromString("129.00"),
+}
@@ -0,0 +1,137 @@
+package fx
+
+import (
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/midedickson/simple-banking-app/constants"
+	"github.com/midedickson/simple-banking-app/models"
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+)
+
+// a rate offered to a customer, valid until ExpiresAt
+type Quote struct {
+	ID      string          `json:"quote_id"`
+	From    string          `json:"from"`
+	To      string          `json:"to"`
+	MidRate decimal.Decimal `json:"mid_rate"`
+	Spread  decimal.Decimal `json:"spread"`
+	// the rate applied to the customer, the mid rate less the spread
+	Rate      decimal.Decimal `json:"rate"`
+	ExpiresAt time.Time       `json:"expires_at"`
+}
+
+// Convert applies the quoted rate to an amount in the source currency,
+// rounding down to the destination currency's minor unit
+func (q *Quote) Convert(amount decimal.Decimal, exponent int32) decimal.Decimal {
+	return amount.Mul(q.Rate).RoundFloor(exponent)
+}
+
+// issues quotes from a rate provider and stores them until a transfer uses them;
+// quotes live in the database so every replica, and a restarted one, can execute them
+type Quoter struct {
+	DB       *gorm.DB
+	provider RateProvider
+	spread   decimal.Decimal
+	ttl      time.Duration
+}
+
+// spread is the fraction taken off the mid rate, e.g. 0.01 for 1%
+func NewQuoter(DB *gorm.DB, provider RateProvider, spread decimal.Decimal, ttl time.Duration) *Quoter {
+	return &Quoter{DB: DB, provider: provider, spread: spread, ttl: ttl}
+}
+
+func (q *Quoter) NewQuote(from string, to string) (*Quote, error) {
+	midRate, err := q.provider.Rate(from, to)
+	if err != nil {
+		return nil, err
+	}
+	if err := q.evictExpired(); err != nil {
+		return nil, err
+	}
+	quote := &Quote{
+		ID:        uuid.NewString(),
+		From:      from,
+		To:        to,
+		MidRate:   midRate,
+		Spread:    q.spread,
+		Rate:      midRate.Mul(decimal.NewFromInt(1).Sub(q.spread)).Round(rateScale),
+		ExpiresAt: time.Now().Add(q.ttl),
+	}
+	err = q.DB.Create(&models.FXQuote{
+		ID:        quote.ID,
+		From:      quote.From,
+		To:        quote.To,
+		MidRate:   quote.MidRate,
+		Spread:    quote.Spread,
+		Rate:      quote.Rate,
+		ExpiresAt: quote.ExpiresAt,
+	}).Error
+	if err != nil {
+		return nil, err
+	}
+	return quote, nil
+}
+
+// FetchQuote returns a quote a transfer can still execute at; it does not use the quote up,
+// ConsumeQuote does that together with the transfer
+func (q *Quoter) FetchQuote(id string) (*Quote, error) {
+	return findQuote(q.DB, id)
+}
+
+// ConsumeQuote marks a quote used by a transfer; call it inside the transfer's database
+// transaction so a transfer that rolls back leaves the quote available for a retry
+func ConsumeQuote(tx *gorm.DB, id string, transferID string) (*Quote, error) {
+	quote, err := findQuote(tx, id)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	result := tx.Model(&models.FXQuote{}).
+		Where("id = ? AND consumed_at IS NULL AND expires_at > ?", id, now).
+		Updates(map[string]interface{}{"consumed_at": now, "transfer_id": transferID})
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		// another transfer used the quote, or it expired, since the lookup
+		if _, err := findQuote(tx, id); err != nil {
+			return nil, err
+		}
+		return nil, constants.ErrQuoteExpired
+	}
+	return quote, nil
+}
+
+func findQuote(db *gorm.DB, id string) (*Quote, error) {
+	var stored models.FXQuote
+	if err := db.Where("id = ?", id).First(&stored).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, constants.ErrQuoteNotFound
+		}
+		return nil, err
+	}
+	if stored.ConsumedAt != nil {
+		return nil, constants.ErrQuoteUsed
+	}
+	if time.Now().After(stored.ExpiresAt) {
+		return nil, constants.ErrQuoteExpired
+	}
+	return &Quote{
+		ID:        stored.ID,
+		From:      stored.From,
+		To:        stored.To,
+		MidRate:   stored.MidRate,
+		Spread:    stored.Spread,
+		Rate:      stored.Rate,
+		ExpiresAt: stored.ExpiresAt,
+	}, nil
+}
+
+// drops quotes that expired without being used, used quotes are kept as the record
+// of the rate their transfer executed at
+func (q *Quoter) evictExpired() error {
+	return q.DB.Where("consumed_at IS NULL AND expires_at <= ?", time.Now()).Delete(&models.FXQuote{}).Error
+}
@@ -0,0 +1,75 @@
+package fx
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/midedickson/simple-banking-app/constants"
+	"github.com/shopspring/decimal"
+)
+
+// number of decimal places kept on derived (inverse) rates
+const rateScale = 8
+
+// source of mid-market exchange rates
+type RateProvider interface {
+	// Rate returns how many units of "to" one unit of "from" buys
+	Rate(from string, to string) (decimal.Decimal, error)
+}
+
+// in-memory rate provider keyed by "FROM/TO" pairs, e.g. "USD/NGN"
+type StaticRateProvider struct {
+	rates map[string]decimal.Decimal
+	mu    sync.RWMutex
+}
+
+func NewStaticRateProvider(rates map[string]decimal.Decimal) *StaticRateProvider {
+	p := &StaticRateProvider{rates: make(map[string]decimal.Decimal)}
+	for pair, rate := range rates {
+		p.rates[strings.ToUpper(pair)] = rate
+	}
+	return p
+}
+
+// NewFileRateProvider loads rates from a JSON file of the form {"USD/NGN": "1500.25"},
+// so rates can be maintained without network access
+func NewFileRateProvider(path string) (*StaticRateProvider, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var rates map[string]decimal.Decimal
+	if err := json.Unmarshal(data, &rates); err != nil {
+		return nil, fmt.Errorf("failed to parse rates file %s: %w", path, err)
+	}
+	return NewStaticRateProvider(rates), nil
+}
+
+func (p *StaticRateProvider) SetRate(from string, to string, rate decimal.Decimal) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.rates[pair(from, to)] = rate
+}
+
+func (p *StaticRateProvider) Rate(from string, to string) (decimal.Decimal, error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if strings.EqualFold(from, to) {
+		return decimal.NewFromInt(1), nil
+	}
+	if rate, ok := p.rates[pair(from, to)]; ok && rate.IsPositive() {
+		return rate, nil
+	}
+	// fall back to the inverse of the opposite pair
+	if rate, ok := p.rates[pair(to, from)]; ok && rate.IsPositive() {
+		return decimal.NewFromInt(1).DivRound(rate, rateScale), nil
+	}
+	return decimal.Zero, constants.ErrRateUnavailable
+}
+
+func pair(from string, to string) string {
+	return strings.ToUpper(from) + "/" + strings.ToUpper(to)
+}
@@ -0,0 +1,36 @@
+package holds
+
+import (
+	"log"
+	"time"
+)
+
+// releases holds that were neither captured nor voided in time
+type Expirer interface {
+	ExpireHolds(now time.Time) (int, error)
+}
+
+// every interval, expires the holds that ran out, until the returned stop function is called
+func StartExpirer(expirer Expirer, interval time.Duration) (stop func()) {
+	ticker := time.NewTicker(interval)
+	done := make(chan struct{})
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case now := <-ticker.C:
+				expired, err := expirer.ExpireHolds(now)
+				if err != nil {
+					log.Printf("failed to expire holds: %s", err)
+					continue
+				}
+				if expired > 0 {
+					log.Printf("expired %d holds", expired)
+				}
+			}
+		}
+	}()
+	return func() { close(done) }
+}
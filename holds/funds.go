@@ -0,0 +1,61 @@
+package holds
+
+import (
+	"github.com/midedickson/simple-banking-app/constants"
+	"github.com/midedickson/simple-banking-app/models"
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// LockAccount loads an account to change its funds. Amounts are stored as text, so new values are
+// worked out in Go rather than with SQL arithmetic; the row lock keeps every other writer, including
+// the outbox dispatcher, which does not share the repository's mutex, from changing the row in between.
+// SQLite has no row locks and lets only one transaction write at a time instead.
+func LockAccount(tx *gorm.DB, accountID int) (*models.UserAccount, error) {
+	var userAccount models.UserAccount
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&userAccount, accountID).Error; err != nil {
+		return nil, err
+	}
+	return &userAccount, nil
+}
+
+// SaveFunds writes back the balance and held amount of an account loaded with LockAccount, leaving the rest of the row alone
+func SaveFunds(tx *gorm.DB, userAccount *models.UserAccount) error {
+	return tx.Model(&models.UserAccount{}).Where("id = ?", userAccount.ID).Updates(map[string]interface{}{
+		"balance": userAccount.Balance,
+		"held":    userAccount.Held,
+	}).Error
+}
+
+// Reserve sets amount aside on an account, refusing what its available balance cannot cover
+func Reserve(tx *gorm.DB, accountID int, amount decimal.Decimal) error {
+	userAccount, err := LockAccount(tx, accountID)
+	if err != nil {
+		return err
+	}
+	if err := userAccount.Reserve(amount); err != nil {
+		return err
+	}
+	return SaveFunds(tx, userAccount)
+}
+
+// Release gives a reserved amount back to an account's available balance
+func Release(tx *gorm.DB, accountID int, amount decimal.Decimal) error {
+	userAccount, err := LockAccount(tx, accountID)
+	if err != nil {
+		return err
+	}
+	userAccount.Release(amount)
+	return SaveFunds(tx, userAccount)
+}
+
+// ReleaseDebit gives a failed debit's amount back to the account. A pending debit keeps its amount
+// held from the moment it is accepted, or from its capture, so it must be released in the same
+// database transaction that fails it.
+func ReleaseDebit(tx *gorm.DB, transaction *models.Transaction) error {
+	if transaction.Direction != constants.DirectionDebit {
+		return nil
+	}
+	return Release(tx, transaction.AccountID, transaction.Amount)
+}
@@ -0,0 +1,195 @@
+package idempotency
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/midedickson/simple-banking-app/constants"
+	"github.com/midedickson/simple-banking-app/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// idempotency store shared by every instance of the service through the database
+type DBIdempotencyStore struct {
+	DB    *gorm.DB
+	ttl   time.Duration
+	lease time.Duration
+}
+
+// keys live for ttl after they are created and are held for lease while processing,
+// zero keeps them forever
+func NewDBIdempotencyStore(DB *gorm.DB, ttl time.Duration, lease time.Duration) *DBIdempotencyStore {
+	return &DBIdempotencyStore{DB: DB, ttl: ttl, lease: lease}
+}
+
+func (s *DBIdempotencyStore) CreateNewIdempotencyKey() (string, error) {
+	maxRetries := 10
+	for i := 0; i < maxRetries; i++ {
+		newUUIDKey, err := uuid.NewUUID()
+		if err != nil {
+			return "", err
+		}
+		idempotencyKey := models.IdempotencyKey{Key: newUUIDKey.String(), Status: constants.WAITING, ExpiresAt: expiresAt(s.ttl, time.Now())}
+		// the primary key rejects a duplicate, so a collision is simply retried
+		result := s.DB.Where(models.IdempotencyKey{Key: idempotencyKey.Key}).FirstOrCreate(&idempotencyKey)
+		if result.Error != nil {
+			return "", result.Error
+		}
+		if result.RowsAffected == 1 {
+			return idempotencyKey.Key, nil
+		}
+	}
+	return "", fmt.Errorf("failed to generate unique idempotency key after %d attempts", maxRetries)
+}
+
+func (s *DBIdempotencyStore) RegisterIdempotencyKey(key string) (bool, error) {
+	now := time.Now()
+	// an expired key that has not been swept yet is free to be used again
+	err := s.DB.Where("key = ? AND expires_at <= ? AND status <> ?", key, now, constants.PROCESSING).Delete(&models.IdempotencyKey{}).Error
+	if err != nil {
+		return false, err
+	}
+	// concurrent first uses race on the primary key, only one insert goes through
+	idempotencyKey := models.IdempotencyKey{Key: key, Status: constants.WAITING, ExpiresAt: expiresAt(s.ttl, now)}
+	result := s.DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&idempotencyKey)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+func (s *DBIdempotencyStore) CheckIdempotencyKeyStatus(key string) (string, error) {
+	var idempotencyKey models.IdempotencyKey
+	err := s.DB.Where("key = ?", key).First(&idempotencyKey).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return "", fmt.Errorf("requested idempotency key %v not found", key)
+		}
+		return "", err
+	}
+	return idempotencyKey.Status, nil
+}
+
+func (s *DBIdempotencyStore) UpdateIdempotencyKeyStatus(key string, lease string, status string) error {
+	// a request whose lease ran out must not overwrite the outcome of the request that took the key over
+	result := s.DB.Model(&models.IdempotencyKey{}).Where("key = ? AND status = ? AND lease_owner = ?", key, constants.PROCESSING, lease).Update("status", status)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return s.leaseLost(key)
+	}
+	return nil
+}
+
+func (s *DBIdempotencyStore) ClaimIdempotencyKey(key string, expected string) (string, bool, error) {
+	lease := newLease()
+	result := s.DB.Model(&models.IdempotencyKey{}).Where("key = ? AND status = ?", key, expected).Updates(map[string]interface{}{
+		"status":           constants.PROCESSING,
+		"lease_owner":      lease,
+		"lease_expires_at": expiresAt(s.lease, time.Now()),
+	})
+	if result.Error != nil {
+		return "", false, result.Error
+	}
+	if result.RowsAffected == 1 {
+		return lease, true, nil
+	}
+	if _, err := s.CheckIdempotencyKeyStatus(key); err != nil {
+		return "", false, err
+	}
+	return "", false, nil
+}
+
+func (s *DBIdempotencyStore) RenewIdempotencyKeyLease(key string, lease string) (bool, error) {
+	result := s.DB.Model(&models.IdempotencyKey{}).Where("key = ? AND status = ? AND lease_owner = ?", key, constants.PROCESSING, lease).
+		Update("lease_expires_at", expiresAt(s.lease, time.Now()))
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+func (s *DBIdempotencyStore) KeepIdempotencyKeyLease(key string, lease string) (stop func()) {
+	return keepLease(key, s.lease, func() (bool, error) {
+		return s.RenewIdempotencyKeyLease(key, lease)
+	})
+}
+
+func (s *DBIdempotencyStore) ExpireIdempotencyKeyLeases(now time.Time) (int, error) {
+	result := s.DB.Model(&models.IdempotencyKey{}).Where("status = ? AND lease_expires_at <= ?", constants.PROCESSING, now).Updates(map[string]interface{}{
+		"status":      constants.CAN_RETRY,
+		"lease_owner": "",
+	})
+	if result.Error != nil {
+		return 0, result.Error
+	}
+	return int(result.RowsAffected), nil
+}
+
+func (s *DBIdempotencyStore) CompleteIdempotencyKey(key string, lease string, statusCode int, body []byte) error {
+	result := s.DB.Model(&models.IdempotencyKey{}).Where("key = ? AND status = ? AND lease_owner = ?", key, constants.PROCESSING, lease).Updates(map[string]interface{}{
+		"status":               constants.SUCCESS,
+		"response_status_code": statusCode,
+		"response_body":        body,
+	})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return s.leaseLost(key)
+	}
+	return nil
+}
+
+// tells a missing key apart from one whose lease has passed to another request
+func (s *DBIdempotencyStore) leaseLost(key string) error {
+	if _, err := s.CheckIdempotencyKeyStatus(key); err != nil {
+		return fmt.Errorf("requested idempotency key for update %v not found", key)
+	}
+	return ErrIdempotencyKeyLeaseLost
+}
+
+func (s *DBIdempotencyStore) FetchIdempotencyKeyResponse(key string) (int, []byte, error) {
+	var idempotencyKey models.IdempotencyKey
+	err := s.DB.Where("key = ?", key).First(&idempotencyKey).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return 0, nil, fmt.Errorf("requested idempotency key %v not found", key)
+		}
+		return 0, nil, err
+	}
+	return idempotencyKey.ResponseStatusCode, idempotencyKey.ResponseBody, nil
+}
+
+func (s *DBIdempotencyStore) BindIdempotencyKeyFingerprint(key string, fingerprint string) (bool, error) {
+	// only the first request sets the fingerprint, later ones are compared against it
+	result := s.DB.Model(&models.IdempotencyKey{}).Where("key = ? AND (fingerprint = '' OR fingerprint IS NULL)", key).Update("fingerprint", fingerprint)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	if result.RowsAffected == 1 {
+		return true, nil
+	}
+	var idempotencyKey models.IdempotencyKey
+	err := s.DB.Where("key = ?", key).First(&idempotencyKey).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return false, fmt.Errorf("requested idempotency key %v not found", key)
+		}
+		return false, err
+	}
+	return idempotencyKey.Fingerprint == fingerprint, nil
+}
+
+func (s *DBIdempotencyStore) SweepExpiredIdempotencyKeys(now time.Time) (int, error) {
+	// a key still being processed is kept, a retry must not start the request again
+	result := s.DB.Where("expires_at <= ? AND status <> ?", now, constants.PROCESSING).Delete(&models.IdempotencyKey{})
+	if result.Error != nil {
+		return 0, result.Error
+	}
+	return int(result.RowsAffected), nil
+}
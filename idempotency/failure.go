@@ -0,0 +1,43 @@
+package idempotency
+
+import (
+	"errors"
+
+	"github.com/midedickson/simple-banking-app/constants"
+)
+
+// failures that resending the same request can never fix
+var permanentFailures = []error{
+	constants.ErrInsufficientFunds,
+	constants.ErrInvalidAmount,
+	constants.ErrAmountPrecision,
+	constants.ErrUnsupportedCurrency,
+	constants.ErrCurrencyMismatch,
+	constants.ErrTransactionNotPending,
+	constants.ErrTransactionNotFound,
+	constants.ErrTransactionNotReversible,
+	constants.ErrReversalExceedsAmount,
+	constants.ErrHoldNotFound,
+	constants.ErrHoldNotActive,
+	constants.ErrCaptureExceedsHold,
+	constants.ErrThirdPartyRejected,
+	constants.ErrRateUnavailable,
+	constants.ErrQuoteNotFound,
+	constants.ErrQuoteExpired,
+	constants.ErrQuoteUsed,
+	constants.ErrQuoteMismatch,
+	// the books disagree with a balance, resending cannot fix that
+	constants.ErrUnbalancedEntry,
+	constants.ErrBalanceDrift,
+}
+
+// reports whether a request that failed with err may succeed when resent with the same key,
+// anything not known to be permanent (a third-party timeout, a locked database) is transient
+func IsTransientFailure(err error) bool {
+	for _, permanent := range permanentFailures {
+		if errors.Is(err, permanent) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,49 @@
+package idempotency
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+)
+
+// Fingerprint hashes the method, path and canonical body of a request.
+// JSON bodies are re-encoded with sorted keys and no insignificant whitespace,
+// so formatting differences do not change the fingerprint.
+// The request body is restored so handlers can still decode it.
+func Fingerprint(r *http.Request) (string, error) {
+	var body []byte
+	if r.Body != nil {
+		var err error
+		body, err = io.ReadAll(r.Body)
+		if err != nil {
+			return "", err
+		}
+		r.Body.Close()
+		r.Body = io.NopCloser(bytes.NewReader(body))
+	}
+	hash := sha256.New()
+	hash.Write([]byte(r.Method))
+	hash.Write([]byte{0})
+	hash.Write([]byte(r.URL.Path))
+	hash.Write([]byte{0})
+	hash.Write(canonicalBody(body))
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+func canonicalBody(body []byte) []byte {
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	// keep numbers as written, so 100.10 and 100.1 are compared by their text
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return body
+	}
+	canonical, err := json.Marshal(value)
+	if err != nil {
+		return body
+	}
+	return canonical
+}
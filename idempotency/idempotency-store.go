@@ -1,18 +1,58 @@
 package idempotency
 
-import "sync"
+import (
+	"sync"
+	"time"
+
+	"github.com/midedickson/simple-banking-app/models"
+)
 
 type IdempotencyStore interface {
 	CreateNewIdempotencyKey() (string, error)
+	// registers a key chosen by the client on its first use,
+	// reports whether the key was new
+	RegisterIdempotencyKey(key string) (bool, error)
 	CheckIdempotencyKeyStatus(key string) (string, error)
-	UpdateIdempotencyKeyStatus(key string, status string) error
+	// moves a processing key to status, only while the caller still holds the lease it claimed the key with
+	UpdateIdempotencyKeyStatus(key string, lease string, status string) error
+	// moves a key from expected to processing under a new lease and returns the lease,
+	// reports whether this caller made the transition
+	ClaimIdempotencyKey(key string, expected string) (string, bool, error)
+	// pushes back the deadline of a lease, reports whether the caller still holds it
+	RenewIdempotencyKeyLease(key string, lease string) (bool, error)
+	// renews a lease in the background until the returned stop function is called,
+	// so a request that runs longer than the lease keeps its claim
+	KeepIdempotencyKeyLease(key string, lease string) (stop func())
+	// releases processing keys whose lease ran out for a retry, reports how many were released
+	ExpireIdempotencyKeyLeases(now time.Time) (int, error)
+	// marks a key successful and keeps the response it produced for replay,
+	// only while the caller still holds the lease it claimed the key with
+	CompleteIdempotencyKey(key string, lease string, statusCode int, body []byte) error
+	FetchIdempotencyKeyResponse(key string) (int, []byte, error)
+	// records the request fingerprint on the first use of a key,
+	// reports whether later requests carry the same fingerprint
+	BindIdempotencyKeyFingerprint(key string, fingerprint string) (bool, error)
+	// removes keys that expired before now, reports how many were removed
+	SweepExpiredIdempotencyKeys(now time.Time) (int, error)
 }
 
 type KeyBasedIdempotencyStore struct {
-	keyTable map[string]string
+	keyTable map[string]*models.IdempotencyKey
+	ttl      time.Duration
+	lease    time.Duration
 	mu       sync.Mutex
 }
 
-func NewIdempotencyStore() *KeyBasedIdempotencyStore {
-	return &KeyBasedIdempotencyStore{keyTable: make(map[string]string), mu: sync.Mutex{}}
+// keys live for ttl after they are created and are held for lease while processing,
+// zero keeps them forever
+func NewIdempotencyStore(ttl time.Duration, lease time.Duration) *KeyBasedIdempotencyStore {
+	return &KeyBasedIdempotencyStore{keyTable: make(map[string]*models.IdempotencyKey), ttl: ttl, lease: lease, mu: sync.Mutex{}}
+}
+
+func expiresAt(ttl time.Duration, now time.Time) *time.Time {
+	if ttl <= 0 {
+		return nil
+	}
+	expiry := now.Add(ttl)
+	return &expiry
 }
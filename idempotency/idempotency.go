@@ -1,15 +1,17 @@
 package idempotency
 
 import (
+	"errors"
 	"fmt"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/midedickson/simple-banking-app/constants"
+	"github.com/midedickson/simple-banking-app/models"
 )
 
+// callers must hold s.mu
 func (s *KeyBasedIdempotencyStore) generateIdempotencyKey() (string, error) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
 	// generate an idempotency key
 	maxRetries := 10
 	for i := 0; i < maxRetries; i++ {
@@ -32,10 +34,22 @@ func (s *KeyBasedIdempotencyStore) CreateNewIdempotencyKey() (string, error) {
 	if err != nil {
 		return "", err
 	}
-	s.keyTable[key] = constants.WAITING
+	s.keyTable[key] = &models.IdempotencyKey{Key: key, Status: constants.WAITING, ExpiresAt: expiresAt(s.ttl, time.Now())}
 	return key, nil
 }
 
+func (s *KeyBasedIdempotencyStore) RegisterIdempotencyKey(key string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	// an expired key that has not been swept yet is free to be used again
+	if idempotencyKey, ok := s.keyTable[key]; ok && !(idempotencyKey.Expired(now) && idempotencyKey.Status != constants.PROCESSING) {
+		return false, nil
+	}
+	s.keyTable[key] = &models.IdempotencyKey{Key: key, Status: constants.WAITING, ExpiresAt: expiresAt(s.ttl, now)}
+	return true, nil
+}
+
 func (s *KeyBasedIdempotencyStore) ConfirmIdempotencyKeyAsProcessed(key string) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
@@ -45,20 +59,134 @@ func (s *KeyBasedIdempotencyStore) ConfirmIdempotencyKeyAsProcessed(key string)
 func (s *KeyBasedIdempotencyStore) CheckIdempotencyKeyStatus(key string) (string, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	status, ok := s.keyTable[key]
+	idempotencyKey, ok := s.keyTable[key]
 	if !ok {
 		return "", fmt.Errorf("requested idempotency key %v not found", key)
 	}
-	return status, nil
+	return idempotencyKey.Status, nil
 }
 
-func (s *KeyBasedIdempotencyStore) UpdateIdempotencyKeyStatus(key string, status string) error {
+func (s *KeyBasedIdempotencyStore) UpdateIdempotencyKeyStatus(key string, lease string, status string) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	if _, ok := s.keyTable[key]; ok {
-		s.keyTable[key] = status
-	} else {
-		return fmt.Errorf("requested idempotency key for update %v not found", key)
+	idempotencyKey, err := s.leasedKey(key, lease)
+	if err != nil {
+		return err
 	}
+	idempotencyKey.Status = status
 	return nil
 }
+
+func (s *KeyBasedIdempotencyStore) ClaimIdempotencyKey(key string, expected string) (string, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	idempotencyKey, ok := s.keyTable[key]
+	if !ok {
+		return "", false, fmt.Errorf("requested idempotency key for update %v not found", key)
+	}
+	if idempotencyKey.Status != expected {
+		return "", false, nil
+	}
+	lease := newLease()
+	idempotencyKey.Status = constants.PROCESSING
+	idempotencyKey.LeaseOwner = lease
+	idempotencyKey.LeaseExpiresAt = expiresAt(s.lease, time.Now())
+	return lease, true, nil
+}
+
+func (s *KeyBasedIdempotencyStore) RenewIdempotencyKeyLease(key string, lease string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	idempotencyKey, err := s.leasedKey(key, lease)
+	if errors.Is(err, ErrIdempotencyKeyLeaseLost) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	idempotencyKey.LeaseExpiresAt = expiresAt(s.lease, time.Now())
+	return true, nil
+}
+
+func (s *KeyBasedIdempotencyStore) KeepIdempotencyKeyLease(key string, lease string) (stop func()) {
+	return keepLease(key, s.lease, func() (bool, error) {
+		return s.RenewIdempotencyKeyLease(key, lease)
+	})
+}
+
+func (s *KeyBasedIdempotencyStore) ExpireIdempotencyKeyLeases(now time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	released := 0
+	for _, idempotencyKey := range s.keyTable {
+		if idempotencyKey.Status == constants.PROCESSING && idempotencyKey.LeaseExpired(now) {
+			idempotencyKey.Status = constants.CAN_RETRY
+			idempotencyKey.LeaseOwner = ""
+			released++
+		}
+	}
+	return released, nil
+}
+
+func (s *KeyBasedIdempotencyStore) CompleteIdempotencyKey(key string, lease string, statusCode int, body []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	idempotencyKey, err := s.leasedKey(key, lease)
+	if err != nil {
+		return err
+	}
+	idempotencyKey.Status = constants.SUCCESS
+	idempotencyKey.ResponseStatusCode = statusCode
+	idempotencyKey.ResponseBody = body
+	return nil
+}
+
+// returns a processing key held under lease, callers must hold s.mu
+func (s *KeyBasedIdempotencyStore) leasedKey(key string, lease string) (*models.IdempotencyKey, error) {
+	idempotencyKey, ok := s.keyTable[key]
+	if !ok {
+		return nil, fmt.Errorf("requested idempotency key for update %v not found", key)
+	}
+	// a request whose lease ran out must not overwrite the outcome of the request that took the key over
+	if idempotencyKey.Status != constants.PROCESSING || idempotencyKey.LeaseOwner != lease {
+		return nil, ErrIdempotencyKeyLeaseLost
+	}
+	return idempotencyKey, nil
+}
+
+func (s *KeyBasedIdempotencyStore) FetchIdempotencyKeyResponse(key string) (int, []byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	idempotencyKey, ok := s.keyTable[key]
+	if !ok {
+		return 0, nil, fmt.Errorf("requested idempotency key %v not found", key)
+	}
+	return idempotencyKey.ResponseStatusCode, idempotencyKey.ResponseBody, nil
+}
+
+func (s *KeyBasedIdempotencyStore) BindIdempotencyKeyFingerprint(key string, fingerprint string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	idempotencyKey, ok := s.keyTable[key]
+	if !ok {
+		return false, fmt.Errorf("requested idempotency key %v not found", key)
+	}
+	if idempotencyKey.Fingerprint == "" {
+		idempotencyKey.Fingerprint = fingerprint
+	}
+	return idempotencyKey.Fingerprint == fingerprint, nil
+}
+
+func (s *KeyBasedIdempotencyStore) SweepExpiredIdempotencyKeys(now time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	removed := 0
+	for key, idempotencyKey := range s.keyTable {
+		// a key still being processed is kept, a retry must not start the request again
+		if idempotencyKey.Expired(now) && idempotencyKey.Status != constants.PROCESSING {
+			delete(s.keyTable, key)
+			removed++
+		}
+	}
+	return removed, nil
+}
@@ -0,0 +1,18 @@
+package idempotency
+
+import (
+	"errors"
+	"regexp"
+)
+
+var ErrInvalidIdempotencyKey = errors.New("idempotency key must be 1 to 64 letters, digits, dashes or underscores")
+
+// accepts UUIDs, ULIDs and other opaque tokens that fit the key column
+var idempotencyKeyPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+func ValidateIdempotencyKey(key string) error {
+	if !idempotencyKeyPattern.MatchString(key) {
+		return ErrInvalidIdempotencyKey
+	}
+	return nil
+}
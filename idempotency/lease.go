@@ -0,0 +1,62 @@
+package idempotency
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var ErrIdempotencyKeyLeaseLost = errors.New("idempotency key lease is no longer held")
+
+// identifies this process on the leases it takes
+var leaseOwner = newLeaseOwner()
+
+// numbers the leases taken by this process, so two requests in the same process never share one
+var leaseSequence atomic.Int64
+
+func newLeaseOwner() string {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown"
+	}
+	return fmt.Sprintf("%s-%d-%s", hostname, os.Getpid(), uuid.NewString())
+}
+
+func newLease() string {
+	return fmt.Sprintf("%s-%d", leaseOwner, leaseSequence.Add(1))
+}
+
+// renews a lease every third of its length until the returned stop function is called
+// or the lease is lost; a lease without a deadline never runs out and is not renewed
+func keepLease(key string, lease time.Duration, renew func() (bool, error)) (stop func()) {
+	if lease <= 0 {
+		return func() {}
+	}
+	ticker := time.NewTicker(lease / 3)
+	done := make(chan struct{})
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				held, err := renew()
+				if err != nil {
+					log.Printf("failed to renew the lease on idempotency key %s: %s", key, err)
+					continue
+				}
+				if !held {
+					log.Printf("lease on idempotency key %s was lost while its request was running", key)
+					return
+				}
+			}
+		}
+	}()
+	return func() { close(done) }
+}
@@ -0,0 +1,38 @@
+package idempotency
+
+import (
+	"log"
+	"time"
+)
+
+// every interval, releases keys whose lease ran out and removes expired keys from the store,
+// until the returned stop function is called
+func StartSweeper(store IdempotencyStore, interval time.Duration) (stop func()) {
+	ticker := time.NewTicker(interval)
+	done := make(chan struct{})
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case now := <-ticker.C:
+				released, err := store.ExpireIdempotencyKeyLeases(now)
+				if err != nil {
+					log.Printf("failed to release expired idempotency key leases: %s", err)
+				} else if released > 0 {
+					log.Printf("released %d idempotency keys with expired leases for retry", released)
+				}
+				removed, err := store.SweepExpiredIdempotencyKeys(now)
+				if err != nil {
+					log.Printf("failed to sweep expired idempotency keys: %s", err)
+					continue
+				}
+				if removed > 0 {
+					log.Printf("swept %d expired idempotency keys", removed)
+				}
+			}
+		}
+	}()
+	return func() { close(done) }
+}
@@ -0,0 +1,16 @@
+package ledger
+
+import "fmt"
+
+// system ledger accounts, every movement of customer funds is balanced against one of these
+const (
+	// funds held with, or owed to, the third-party processor
+	SettlementAccount = "system:settlement"
+	// currency position taken on when converting between currencies
+	FXAccount = "system:fx"
+)
+
+// ledger account of a customer's UserAccount
+func UserAccount(userAccountID int) string {
+	return fmt.Sprintf("user:%d", userAccountID)
+}
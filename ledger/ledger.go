@@ -0,0 +1,87 @@
+package ledger
+
+import (
+	"fmt"
+
+	"github.com/midedickson/simple-banking-app/constants"
+	"github.com/midedickson/simple-banking-app/models"
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+)
+
+// Post records a journal entry with its postings.
+// tx should be the database transaction that also writes the business change,
+// so that the books and the balances are committed together.
+func Post(tx *gorm.DB, reference string, description string, postings ...models.Posting) (*models.JournalEntry, error) {
+	if len(postings) < 2 {
+		return nil, fmt.Errorf("journal entry %s needs at least two postings", reference)
+	}
+	// amounts in different currencies cannot offset each other
+	totals := map[string]decimal.Decimal{}
+	for _, posting := range postings {
+		if posting.Currency == "" {
+			return nil, fmt.Errorf("posting to %s in journal entry %s has no currency", posting.Account, reference)
+		}
+		totals[posting.Currency] = totals[posting.Currency].Add(posting.Amount)
+	}
+	for _, total := range totals {
+		if !total.IsZero() {
+			return nil, constants.ErrUnbalancedEntry
+		}
+	}
+	entry := &models.JournalEntry{
+		Reference:   reference,
+		Description: description,
+		Postings:    postings,
+	}
+	return entry, tx.Create(entry).Error
+}
+
+// Transfer builds the two postings that move amount from one ledger account to another.
+func Transfer(from string, to string, amount decimal.Decimal, currency string) []models.Posting {
+	return []models.Posting{
+		{Account: from, Amount: amount.Neg(), Currency: currency},
+		{Account: to, Amount: amount, Currency: currency},
+	}
+}
+
+// Balance derives the balance of a ledger account in a currency from its postings.
+func Balance(db *gorm.DB, account string, currency string) (decimal.Decimal, error) {
+	var amounts []decimal.Decimal
+	err := db.Model(&models.Posting{}).Where("account = ? AND currency = ?", account, currency).Pluck("amount", &amounts).Error
+	if err != nil {
+		return decimal.Zero, err
+	}
+	return sum(amounts), nil
+}
+
+// CheckBalance fails with constants.ErrBalanceDrift when balance differs from the balance derived from the account's postings.
+// tx should be the database transaction that posted the change, so a change that leaves them apart is rolled back.
+func CheckBalance(tx *gorm.DB, account string, currency string, balance decimal.Decimal) error {
+	derived, err := Balance(tx, account, currency)
+	if err != nil {
+		return err
+	}
+	if !derived.Equal(balance) {
+		return fmt.Errorf("%w: %s holds %s %s but its postings sum to %s", constants.ErrBalanceDrift, account, balance, currency, derived)
+	}
+	return nil
+}
+
+// TrialBalance sums every posting in a currency, balanced books always total zero.
+func TrialBalance(db *gorm.DB, currency string) (decimal.Decimal, error) {
+	var amounts []decimal.Decimal
+	err := db.Model(&models.Posting{}).Where("currency = ?", currency).Pluck("amount", &amounts).Error
+	if err != nil {
+		return decimal.Zero, err
+	}
+	return sum(amounts), nil
+}
+
+func sum(amounts []decimal.Decimal) decimal.Decimal {
+	total := decimal.Zero
+	for _, amount := range amounts {
+		total = total.Add(amount)
+	}
+	return total
+}
@@ -10,9 +10,9 @@ import (
 	"github.com/midedickson/simple-banking-app/controllers"
 	"github.com/midedickson/simple-banking-app/external"
 	"github.com/midedickson/simple-banking-app/idempotency"
-	mock_client "github.com/midedickson/simple-banking-app/mock"
 	"github.com/midedickson/simple-banking-app/repository"
 	"github.com/midedickson/simple-banking-app/routes"
+	"github.com/midedickson/simple-banking-app/settlement"
 )
 
 func init() {
@@ -27,10 +27,74 @@ func main() {
 	config.AutoMigrate()
 	r := mux.NewRouter()
 	storageRepository := repository.NewStorageRepository(config.DB)
-	mockClient := mock_client.CreateNewPOSTMockClient()
-	external := external.NewTransactionExternal(mockClient)
-	idempotencyStore := idempotency.NewIdempotencyStore()
-	controller := controllers.NewController(storageRepository, external, idempotencyStore)
+	if err := storageRepository.SeedUserAccounts(repository.Users); err != nil {
+		log.Fatalf("Error seeding user accounts: %v", err)
+	}
+	confirmation, err := config.ConfirmationMode()
+	if err != nil {
+		log.Fatalf("Error configuring third-party confirmation: %v", err)
+	}
+	webhookVerifier, err := config.NewWebhookVerifier(confirmation)
+	if err != nil {
+		log.Fatalf("Error configuring partner webhooks: %v", err)
+	}
+	clientSettings, err := config.NewClientSettings()
+	if err != nil {
+		log.Fatalf("Error configuring third-party client: %v", err)
+	}
+	client, err := config.NewThirdPartyClient(clientSettings, confirmation)
+	if err != nil {
+		log.Fatalf("Error configuring third-party client: %v", err)
+	}
+	retryPolicy, err := config.NewRetryPolicy()
+	if err != nil {
+		log.Fatalf("Error configuring third-party retries: %v", err)
+	}
+	circuitBreaker, err := config.NewCircuitBreaker()
+	if err != nil {
+		log.Fatalf("Error configuring third-party circuit breaker: %v", err)
+	}
+	external := external.NewTransactionExternal(client, clientSettings, retryPolicy, circuitBreaker)
+	idempotencyStore, err := config.NewIdempotencyStore()
+	if err != nil {
+		log.Fatalf("Error configuring idempotency store: %v", err)
+	}
+	sweepInterval, err := config.IdempotencySweepInterval()
+	if err != nil {
+		log.Fatalf("Error configuring idempotency store: %v", err)
+	}
+	stopSweeper := idempotency.StartSweeper(idempotencyStore, sweepInterval)
+	defer stopSweeper()
+	quoter, err := config.NewFXQuoter()
+	if err != nil {
+		log.Fatalf("Error configuring fx quotes: %v", err)
+	}
+	stopDispatcher, err := config.StartOutboxDispatcher(external, storageRepository, confirmation)
+	if err != nil {
+		log.Fatalf("Error starting outbox dispatcher: %v", err)
+	}
+	defer stopDispatcher()
+	reconciler, stopReconciliation, err := config.StartReconciliation(external)
+	if err != nil {
+		log.Fatalf("Error configuring reconciliation: %v", err)
+	}
+	defer stopReconciliation()
+	holdTTL, err := config.HoldTTL()
+	if err != nil {
+		log.Fatalf("Error configuring holds: %v", err)
+	}
+	stopHoldExpirer, err := config.StartHoldExpirer(storageRepository)
+	if err != nil {
+		log.Fatalf("Error configuring holds: %v", err)
+	}
+	defer stopHoldExpirer()
+	controller := controllers.NewController(storageRepository, external, idempotencyStore, controllers.Options{
+		Quoter:             quoter,
+		WebhookVerifier:    webhookVerifier,
+		Reconciler:         reconciler,
+		SettlementImporter: settlement.NewImporter(config.DB),
+		HoldTTL:            holdTTL,
+	})
 	routes.ConnectRoutes(r, controller)
 	log.Println("Starting Simple Banking Server...")
 	log.Fatal(http.ListenAndServe(":8080", r))
@@ -1,16 +1,10 @@
 package mock_client
 
 import (
-	"bytes"
-	"encoding/json"
-	"errors"
-	"io"
-	"log"
 	"net/http"
-	"strings"
+	"net/http/httptest"
 
-	"github.com/midedickson/simple-banking-app/dto"
-	"github.com/midedickson/simple-banking-app/repository"
+	"github.com/midedickson/simple-banking-app/fakepartner"
 )
 
 type MockClient struct {
@@ -21,40 +15,21 @@ func (m *MockClient) Do(req *http.Request) (*http.Response, error) {
 	return m.DoFunc(req)
 }
 
-func CreateNewPOSTMockClient() *MockClient {
+// serves requests from handler in-process, without opening a connection
+func NewHandlerMockClient(handler http.Handler) *MockClient {
 	return &MockClient{
 		DoFunc: func(req *http.Request) (*http.Response, error) {
-			var forwardTransactionDTO dto.ForwardTransactionDTO
-			err := json.NewDecoder(req.Body).Decode(&forwardTransactionDTO)
-			if err != nil {
-				return &http.Response{StatusCode: http.StatusBadRequest}, err
-			}
-			repository.ExternalTransactions = append(repository.ExternalTransactions, &forwardTransactionDTO)
-			return &http.Response{StatusCode: http.StatusOK, Body: req.Body}, nil
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, req)
+			resp := recorder.Result()
+			resp.Request = req
+			return resp, nil
 		},
 	}
 }
 
-func CreateNewGETMockClient() *MockClient {
-	return &MockClient{
-		DoFunc: func(req *http.Request) (*http.Response, error) {
-			urlPath := req.URL.Path
-			parts := strings.Split(urlPath, "/")
-			if len(parts) != 2 {
-				return &http.Response{StatusCode: http.StatusBadRequest}, errors.New("invalid request path")
-			}
-			reference := parts[1]
-			for _, transaction := range repository.ExternalTransactions {
-				if transaction.Reference == reference {
-					data, err := json.Marshal(transaction)
-					if err != nil {
-						log.Printf("failed to marshal transaction data from third party: %s", err)
-						return &http.Response{StatusCode: http.StatusBadRequest}, err
-					}
-					return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(bytes.NewReader(data))}, nil
-				}
-			}
-			return &http.Response{StatusCode: http.StatusNotFound}, errors.New("transaction not found")
-		},
-	}
+// stands in for the whole third-party API with an in-memory fake partner, which confirms
+// transactions to callbackURL when it is set
+func CreateNewMockClient(callbackURL string, callbackSecret string) *MockClient {
+	return NewHandlerMockClient(fakepartner.NewPartner(callbackURL, callbackSecret))
 }
@@ -0,0 +1,22 @@
+package models
+
+import (
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// a rate offered to a customer, kept until a transfer executes at it or it expires
+type FXQuote struct {
+	ID        string          `gorm:"primaryKey;size:36"`
+	From      string          `gorm:"size:3;not null"`
+	To        string          `gorm:"size:3;not null"`
+	MidRate   decimal.Decimal `gorm:"type:text;not null"`
+	Spread    decimal.Decimal `gorm:"type:text;not null"`
+	Rate      decimal.Decimal `gorm:"type:text;not null"`
+	ExpiresAt time.Time       `gorm:"not null;index"`
+	// set in the same database transaction as the transfer that used the quote
+	ConsumedAt *time.Time
+	TransferID string `gorm:"size:64"`
+	CreatedAt  time.Time
+}
@@ -0,0 +1,23 @@
+package models
+
+import (
+	"time"
+
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+)
+
+// funds reserved on an account for a later capture; the reservation lowers the available
+// balance but leaves the ledger balance alone until the capture settles
+type Hold struct {
+	gorm.Model
+	Reference string          `gorm:"size:64;uniqueIndex;not null" json:"reference"`
+	AccountID int             `gorm:"index;not null" json:"account_id"`
+	Amount    decimal.Decimal `gorm:"type:text;not null" json:"amount"`
+	Currency  string          `gorm:"size:3;not null" json:"currency"`
+	// set once the hold is captured, the rest of the hold is released
+	CapturedAmount decimal.Decimal `gorm:"type:text;not null;default:0" json:"captured_amount"`
+	// constants.HoldActive, HoldCaptured, HoldVoided or HoldExpired
+	Status    string    `gorm:"not null;index" json:"status"`
+	ExpiresAt time.Time `gorm:"not null;index" json:"expires_at"`
+}
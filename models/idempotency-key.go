@@ -0,0 +1,30 @@
+package models
+
+import "time"
+
+// persisted state of an idempotency key
+type IdempotencyKey struct {
+	Key    string `gorm:"primaryKey;size:64" json:"key"`
+	Status string `gorm:"not null;index" json:"status"`
+	// hash of the method, path and body of the first request that used the key
+	Fingerprint string `gorm:"size:64" json:"fingerprint"`
+	// the original response, replayed when the key is used again after success
+	ResponseStatusCode int    `json:"response_status_code"`
+	ResponseBody       []byte `json:"-"`
+	// instance processing the key and when its claim runs out, a key whose lease
+	// runs out before the request finishes is released for a retry
+	LeaseOwner     string     `gorm:"size:128" json:"lease_owner,omitempty"`
+	LeaseExpiresAt *time.Time `gorm:"index" json:"lease_expires_at,omitempty"`
+	// keys without an expiry are kept until they are removed by hand
+	ExpiresAt *time.Time `gorm:"index" json:"expires_at,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+}
+
+func (k *IdempotencyKey) Expired(now time.Time) bool {
+	return k.ExpiresAt != nil && !now.Before(*k.ExpiresAt)
+}
+
+func (k *IdempotencyKey) LeaseExpired(now time.Time) bool {
+	return k.LeaseExpiresAt != nil && !now.Before(*k.LeaseExpiresAt)
+}
@@ -0,0 +1,24 @@
+package models
+
+import (
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+)
+
+// a balanced set of postings recorded for a single business event
+type JournalEntry struct {
+	gorm.Model
+	// reference of the transaction or transfer that produced the entry
+	Reference   string    `gorm:"index" json:"reference"`
+	Description string    `json:"description"`
+	Postings    []Posting `json:"postings"`
+}
+
+// a single movement on a ledger account, positive amounts increase the account's balance
+type Posting struct {
+	gorm.Model
+	JournalEntryID uint            `gorm:"index" json:"journal_entry_id"`
+	Account        string          `gorm:"index" json:"account"`
+	Amount         decimal.Decimal `gorm:"type:text;not null" json:"amount"`
+	Currency       string          `gorm:"size:3;not null" json:"currency"`
+}
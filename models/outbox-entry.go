@@ -0,0 +1,21 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// a transaction waiting to be delivered to the third party, written in the same
+// database transaction as the transaction itself so neither exists without the other
+type OutboxEntry struct {
+	gorm.Model
+	TransactionID uint   `gorm:"not null;index" json:"transaction_id"`
+	Reference     string `gorm:"not null" json:"reference"`
+	Status        string `gorm:"not null;index;default:pending" json:"status"`
+	Attempts      int    `gorm:"not null;default:0" json:"attempts"`
+	// the entry is not picked up again before this time, pushed back on every attempt
+	NextAttemptAt time.Time  `gorm:"not null;index" json:"next_attempt_at"`
+	LastError     string     `json:"last_error,omitempty"`
+	DeliveredAt   *time.Time `json:"delivered_at,omitempty"`
+}
@@ -0,0 +1,41 @@
+package models
+
+import (
+	"time"
+
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+)
+
+// the outcome of comparing our transactions in a time window against the partner's records
+type ReconciliationReport struct {
+	gorm.Model
+	WindowStart time.Time `gorm:"not null" json:"window_start"`
+	WindowEnd   time.Time `gorm:"not null" json:"window_end"`
+	// where the partner's records came from, constants.ReconciliationSourcePartnerAPI or constants.ReconciliationSourceImport
+	Source string `gorm:"not null" json:"source"`
+	Status string `gorm:"not null;index" json:"status"`
+	// why a failed run stopped
+	Error          string                `json:"error,omitempty"`
+	Matched        int                   `json:"matched"`
+	MissingRemote  int                   `json:"missing_remote"`
+	MissingLocal   int                   `json:"missing_local"`
+	AmountMismatch int                   `json:"amount_mismatch"`
+	StatusMismatch int                   `json:"status_mismatch"`
+	Items          []*ReconciliationItem `gorm:"foreignKey:ReportID" json:"items,omitempty"`
+}
+
+// one transaction compared in a reconciliation report
+type ReconciliationItem struct {
+	ID        uint   `gorm:"primaryKey" json:"-"`
+	ReportID  uint   `gorm:"not null;index" json:"-"`
+	Reference string `gorm:"not null;index" json:"reference"`
+	Result    string `gorm:"not null;index" json:"result"`
+	// nil on the side that has no record of the transaction
+	LocalAmount    *decimal.Decimal `gorm:"type:text" json:"local_amount,omitempty"`
+	RemoteAmount   *decimal.Decimal `gorm:"type:text" json:"remote_amount,omitempty"`
+	LocalCurrency  string           `gorm:"size:3" json:"local_currency,omitempty"`
+	RemoteCurrency string           `gorm:"size:3" json:"remote_currency,omitempty"`
+	LocalStatus    string           `json:"local_status,omitempty"`
+	RemoteStatus   string           `json:"remote_status,omitempty"`
+}
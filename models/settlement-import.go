@@ -0,0 +1,59 @@
+package models
+
+import (
+	"time"
+
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+)
+
+// a partner settlement file as it was received, kept so it can be matched again later
+type SettlementImport struct {
+	gorm.Model
+	// constants.SettlementFormatCSV or constants.SettlementFormatCamt053
+	Format   string `gorm:"not null" json:"format"`
+	FileName string `json:"file_name,omitempty"`
+	// sha256 of the content, the same file is only imported once
+	Checksum    string `gorm:"size:64;uniqueIndex;not null" json:"checksum"`
+	Content     []byte `gorm:"not null" json:"-"`
+	StatementID string `json:"statement_id,omitempty"`
+	Status      string `gorm:"not null" json:"status"`
+	// why the file could not be parsed
+	Error      string             `json:"error,omitempty"`
+	EntryCount int                `json:"entry_count"`
+	Matched    int                `json:"matched"`
+	Suspended  int                `json:"suspended"`
+	Runs       int                `json:"runs"`
+	LastRunAt  time.Time          `json:"last_run_at"`
+	Entries    []*SettlementEntry `gorm:"foreignKey:ImportID" json:"entries,omitempty"`
+}
+
+// one statement entry and the transaction it was matched to
+type SettlementEntry struct {
+	ID          uint            `gorm:"primaryKey" json:"-"`
+	ImportID    uint            `gorm:"not null;index" json:"-"`
+	Line        int             `gorm:"not null" json:"line"`
+	Reference   string          `gorm:"index" json:"reference"`
+	Amount      decimal.Decimal `gorm:"type:text;not null" json:"amount"`
+	Currency    string          `gorm:"size:3" json:"currency"`
+	Direction   string          `json:"direction,omitempty"`
+	BookingDate *time.Time      `json:"booking_date,omitempty"`
+	// nil when the entry went to the suspense queue
+	TransactionID *uint  `json:"transaction_id,omitempty"`
+	Result        string `gorm:"not null" json:"result"`
+}
+
+// a statement entry ops has to look at, because it could not be matched to a transaction
+type SuspenseItem struct {
+	gorm.Model
+	ImportID  uint            `gorm:"not null;uniqueIndex:idx_suspense_import_line" json:"import_id"`
+	Line      int             `gorm:"not null;uniqueIndex:idx_suspense_import_line" json:"line"`
+	Reference string          `gorm:"index" json:"reference"`
+	Amount    decimal.Decimal `gorm:"type:text;not null" json:"amount"`
+	Currency  string          `gorm:"size:3" json:"currency"`
+	// constants.SuspenseUnknownReference and friends
+	Reason     string     `gorm:"not null" json:"reason"`
+	Status     string     `gorm:"not null;index;default:open" json:"status"`
+	Note       string     `json:"note,omitempty"`
+	ResolvedAt *time.Time `json:"resolved_at,omitempty"`
+}
@@ -1,14 +1,36 @@
 package models
 
 import (
+	"time"
+
+	"github.com/shopspring/decimal"
 	"gorm.io/gorm"
 )
 
 type Transaction struct {
-	gorm.Model
-	AccountID int     `gorm:"account_id" json:"account_id"`
-	Reference string  `gorm:"reference" json:"reference"`
-	Amount    float64 `gorm:"amount" json:"amount"`
-	Direction string  `gorm:"direction" json:"direction"`
-	Status    string  `gorm:"status" json:"status"`
+	// the fields of gorm.Model, spelled out so created_at can be indexed with the account for history listings
+	ID        uint      `gorm:"primarykey"`
+	CreatedAt time.Time `gorm:"index;index:idx_transactions_account_created,priority:2"`
+	UpdatedAt time.Time
+	DeletedAt gorm.DeletedAt `gorm:"index"`
+
+	AccountID int    `gorm:"index:idx_transactions_account_created,priority:1" json:"account_id"`
+	Reference string `gorm:"reference" json:"reference"`
+	// amounts are stored as text throughout, a numeric column in sqlite would round them through a float
+	Amount    decimal.Decimal `gorm:"type:text;not null" json:"amount"`
+	Currency  string          `gorm:"size:3;not null;default:NGN" json:"currency"`
+	Direction string          `gorm:"direction" json:"direction"`
+	Status    string          `gorm:"status" json:"status"`
+	// shared by the debit and credit legs of an internal transfer
+	TransferID string `gorm:"index" json:"transfer_id,omitempty"`
+	// recorded on cross-currency transfer legs for audit
+	FXRate          *decimal.Decimal `gorm:"type:text" json:"fx_rate,omitempty"`
+	CounterAmount   *decimal.Decimal `gorm:"type:text" json:"counter_amount,omitempty"`
+	CounterCurrency string           `gorm:"size:3" json:"counter_currency,omitempty"`
+	// reference of the hold an authorization, capture, void or expiry belongs to
+	HoldReference string `gorm:"index;size:64" json:"hold_reference,omitempty"`
+	// reference of the transaction this one reverses, set on refunds
+	ReversalOf string `gorm:"index;size:64" json:"reversal_of,omitempty"`
+	// key of the request that created the transaction, used to find its outcome when the request is retried
+	IdempotencyKey string `gorm:"index;size:64" json:"-"`
 }
@@ -2,7 +2,7 @@ package models
 
 import (
 	"log"
-	"sync"
+	"time"
 
 	"github.com/midedickson/simple-banking-app/constants"
 	"github.com/shopspring/decimal"
@@ -11,32 +11,57 @@ import (
 // user account details
 
 type UserAccount struct {
-	mu      sync.Mutex
-	ID      int             `json:"account_id"`
-	Balance decimal.Decimal `json:"balance"`
+	ID       int             `gorm:"primaryKey" json:"account_id"`
+	Balance  decimal.Decimal `gorm:"type:text;not null" json:"balance"`
+	Currency string          `gorm:"size:3;not null;default:NGN" json:"currency"`
+	// reserved by active holds, part of the balance but not available to spend
+	Held      decimal.Decimal `gorm:"type:text;not null;default:0" json:"held"`
+	Status    string          `gorm:"not null;default:active" json:"status"`
+	CreatedAt time.Time       `json:"created_at"`
+	UpdatedAt time.Time       `json:"updated_at"`
 }
 
-func (u *UserAccount) Credit(amount float64) error {
-	u.mu.Lock()
-	defer u.mu.Unlock()
+// the balance that can be spent right now
+func (u *UserAccount) AvailableBalance() decimal.Decimal {
+	return u.Balance.Sub(u.Held)
+}
+
+// Credit and Debit only mutate the loaded row; callers are expected to persist
+// the account in the same database transaction as the ledger entry.
+func (u *UserAccount) Credit(amount decimal.Decimal) error {
 	log.Printf("Account Balance before credit: %v", u.Balance)
 	log.Printf("Crediting: %v", amount)
-	u.Balance = u.Balance.Add(decimal.NewFromFloatWithExponent(amount, -2))
+	u.Balance = u.Balance.Add(amount)
 	log.Printf("Account Balance after credit: %v", u.Balance)
 
 	return nil
 }
 
-func (u *UserAccount) Debit(amount float64) error {
-	u.mu.Lock()
-	defer u.mu.Unlock()
+func (u *UserAccount) Debit(amount decimal.Decimal) error {
 	log.Printf("Account Balance before debit: %v", u.Balance)
 	log.Printf("Debiting: %v", amount)
-	if u.Balance.LessThan(decimal.NewFromFloatWithExponent(amount, -2)) {
+	// funds reserved by holds cannot be spent
+	if u.AvailableBalance().LessThan(amount) {
 		log.Println("Debit Refused, Insufficient Funds")
 		return constants.ErrInsufficientFunds
 	}
-	u.Balance = u.Balance.Sub(decimal.NewFromFloatWithExponent(amount, -2))
+	u.Balance = u.Balance.Sub(amount)
 	log.Printf("Account Balance after debit: %v", u.Balance)
 	return nil
 }
+
+// Reserve and Release move funds in and out of holds without touching the balance.
+func (u *UserAccount) Reserve(amount decimal.Decimal) error {
+	if u.AvailableBalance().LessThan(amount) {
+		log.Println("Hold Refused, Insufficient Funds")
+		return constants.ErrInsufficientFunds
+	}
+	u.Held = u.Held.Add(amount)
+	log.Printf("Held on account %d after reserving %v: %v", u.ID, amount, u.Held)
+	return nil
+}
+
+func (u *UserAccount) Release(amount decimal.Decimal) {
+	u.Held = decimal.Max(u.Held.Sub(amount), decimal.Zero)
+	log.Printf("Held on account %d after releasing %v: %v", u.ID, amount, u.Held)
+}
@@ -0,0 +1,11 @@
+package models
+
+import "time"
+
+// a partner webhook that has been applied, kept so a redelivered event is not applied twice
+type WebhookEvent struct {
+	EventID    string    `gorm:"primaryKey;size:128" json:"event_id"`
+	Reference  string    `gorm:"not null;index" json:"reference"`
+	Status     string    `gorm:"not null" json:"status"`
+	ReceivedAt time.Time `gorm:"not null" json:"received_at"`
+}
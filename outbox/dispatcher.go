@@ -0,0 +1,213 @@
+package outbox
+
+import (
+	"errors"
+	"log"
+	"time"
+
+	"github.com/midedickson/simple-banking-app/constants"
+	"github.com/midedickson/simple-banking-app/dto"
+	"github.com/midedickson/simple-banking-app/holds"
+	"github.com/midedickson/simple-banking-app/idempotency"
+	"github.com/midedickson/simple-banking-app/models"
+	"gorm.io/gorm"
+)
+
+const (
+	batchSize = 20
+	// an entry being delivered is hidden from other dispatchers for this long
+	claimTimeout = time.Minute
+	baseBackoff  = time.Second
+	maxBackoff   = 5 * time.Minute
+)
+
+// the part of the third-party client the dispatcher delivers through, satisfied by external.External
+type Forwarder interface {
+	ForwardTransactionToThirdParty(transaction *models.Transaction) error
+	FetchTransactionDetailsFromThirdParty(reference string) (*dto.ForwardTransactionDTO, error)
+}
+
+// the part of the repository the dispatcher needs once a transaction is delivered
+type Settler interface {
+	SettleTransaction(transaction *models.Transaction) error
+}
+
+// delivers queued transactions to the third party, settling them once delivered when it has a settler;
+// without one they stay pending until the partner confirms them with a webhook
+type Dispatcher struct {
+	DB          *gorm.DB
+	external    Forwarder
+	settler     Settler
+	maxAttempts int
+}
+
+func NewDispatcher(DB *gorm.DB, external Forwarder, settler Settler, maxAttempts int) *Dispatcher {
+	return &Dispatcher{DB: DB, external: external, settler: settler, maxAttempts: maxAttempts}
+}
+
+// dispatches due entries every interval until the returned stop function is called
+func (d *Dispatcher) Start(interval time.Duration) (stop func()) {
+	ticker := time.NewTicker(interval)
+	done := make(chan struct{})
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case now := <-ticker.C:
+				if _, err := d.DispatchDue(now); err != nil {
+					log.Printf("failed to dispatch outbox entries: %s", err)
+				}
+			}
+		}
+	}()
+	return func() { close(done) }
+}
+
+// delivers the entries due at now, reports how many were delivered
+func (d *Dispatcher) DispatchDue(now time.Time) (int, error) {
+	var entries []*models.OutboxEntry
+	err := d.DB.Where("status = ? AND next_attempt_at <= ?", constants.OutboxPending, now).Order("id asc").Limit(batchSize).Find(&entries).Error
+	if err != nil {
+		return 0, err
+	}
+	delivered := 0
+	for _, entry := range entries {
+		claimed, err := d.claim(entry, now)
+		if err != nil {
+			return delivered, err
+		}
+		if !claimed {
+			continue
+		}
+		if err := d.deliver(entry); err != nil {
+			log.Printf("failed to deliver transaction %s (attempt %d): %s", entry.Reference, entry.Attempts, err)
+			d.retryLater(entry, now, err)
+			if errors.Is(err, constants.ErrThirdPartyUnavailable) {
+				// the rest of the batch would fail the same way
+				break
+			}
+			continue
+		}
+		delivered++
+	}
+	return delivered, nil
+}
+
+// counts the attempt and hides the entry from other dispatchers while it is delivered,
+// the attempt count doubles as a version so only one dispatcher wins the claim
+func (d *Dispatcher) claim(entry *models.OutboxEntry, now time.Time) (bool, error) {
+	result := d.DB.Model(&models.OutboxEntry{}).
+		Where("id = ? AND status = ? AND attempts = ?", entry.ID, constants.OutboxPending, entry.Attempts).
+		Updates(map[string]interface{}{
+			"attempts":        entry.Attempts + 1,
+			"next_attempt_at": now.Add(claimTimeout),
+		})
+	if result.Error != nil {
+		return false, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return false, nil
+	}
+	entry.Attempts++
+	return true, nil
+}
+
+func (d *Dispatcher) deliver(entry *models.OutboxEntry) error {
+	var transaction models.Transaction
+	if err := d.DB.First(&transaction, entry.TransactionID).Error; err != nil {
+		return err
+	}
+	if transaction.Status != "pending" {
+		// settled before the entry could be marked delivered
+		return d.markDelivered(entry)
+	}
+	// an earlier attempt may have reached the third party before failing,
+	// only send the transaction again if the third party has no record of it
+	forwarded := false
+	if entry.Attempts > 1 {
+		if _, err := d.external.FetchTransactionDetailsFromThirdParty(transaction.Reference); err == nil {
+			forwarded = true
+		}
+	}
+	if !forwarded {
+		if err := d.external.ForwardTransactionToThirdParty(&transaction); err != nil {
+			return err
+		}
+	}
+	if d.settler == nil {
+		return d.markDelivered(entry)
+	}
+	err := d.settler.SettleTransaction(&transaction)
+	if err != nil && !errors.Is(err, constants.ErrTransactionNotPending) {
+		return err
+	}
+	return d.markDelivered(entry)
+}
+
+func (d *Dispatcher) markDelivered(entry *models.OutboxEntry) error {
+	now := time.Now()
+	return d.DB.Model(entry).Updates(map[string]interface{}{
+		"status":       constants.OutboxDelivered,
+		"delivered_at": &now,
+		"last_error":   "",
+	}).Error
+}
+
+// schedules another attempt with exponential backoff, or gives up on the entry and
+// fails its transaction when the error is permanent or the attempts are used up
+func (d *Dispatcher) retryLater(entry *models.OutboxEntry, now time.Time, cause error) {
+	if errors.Is(cause, constants.ErrThirdPartyUnavailable) {
+		// the call never left while the circuit breaker was open, so the attempt does not count
+		entry.Attempts--
+		err := d.DB.Model(entry).Updates(map[string]interface{}{
+			"attempts":        entry.Attempts,
+			"next_attempt_at": now.Add(backoff(1)),
+			"last_error":      cause.Error(),
+		}).Error
+		if err != nil {
+			log.Printf("failed to reschedule outbox entry %d: %s", entry.ID, err)
+		}
+		return
+	}
+	if idempotency.IsTransientFailure(cause) && entry.Attempts < d.maxAttempts {
+		err := d.DB.Model(entry).Updates(map[string]interface{}{
+			"next_attempt_at": now.Add(backoff(entry.Attempts)),
+			"last_error":      cause.Error(),
+		}).Error
+		if err != nil {
+			log.Printf("failed to reschedule outbox entry %d: %s", entry.ID, err)
+		}
+		return
+	}
+	err := d.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(entry).Updates(map[string]interface{}{
+			"status":     constants.OutboxFailed,
+			"last_error": cause.Error(),
+		}).Error
+		if err != nil {
+			return err
+		}
+		result := tx.Model(&models.Transaction{}).Where("id = ? AND status = ?", entry.TransactionID, "pending").Update("status", constants.FAILED)
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+		var transaction models.Transaction
+		if err := tx.First(&transaction, entry.TransactionID).Error; err != nil {
+			return err
+		}
+		return holds.ReleaseDebit(tx, &transaction)
+	})
+	if err != nil {
+		log.Printf("failed to give up on outbox entry %d: %s", entry.ID, err)
+	}
+}
+
+func backoff(attempts int) time.Duration {
+	delay := baseBackoff << (attempts - 1)
+	if delay <= 0 || delay > maxBackoff {
+		return maxBackoff
+	}
+	return delay
+}
@@ -0,0 +1,21 @@
+package outbox
+
+import (
+	"time"
+
+	"github.com/midedickson/simple-banking-app/constants"
+	"github.com/midedickson/simple-banking-app/models"
+	"gorm.io/gorm"
+)
+
+// queues a transaction for delivery to the third party, tx must be the
+// database transaction that creates it
+func Enqueue(tx *gorm.DB, transaction *models.Transaction) error {
+	entry := models.OutboxEntry{
+		TransactionID: transaction.ID,
+		Reference:     transaction.Reference,
+		Status:        constants.OutboxPending,
+		NextAttemptAt: time.Now(),
+	}
+	return tx.Create(&entry).Error
+}
@@ -0,0 +1,72 @@
+package reconciliation
+
+import (
+	"github.com/midedickson/simple-banking-app/constants"
+	"github.com/midedickson/simple-banking-app/dto"
+	"github.com/midedickson/simple-banking-app/models"
+)
+
+// classifies one transaction, local or remote may be nil but not both
+func compare(local *models.Transaction, remote *dto.ForwardTransactionDTO) *models.ReconciliationItem {
+	item := &models.ReconciliationItem{}
+	if local != nil {
+		amount := local.Amount
+		item.Reference, item.LocalAmount, item.LocalCurrency, item.LocalStatus = local.Reference, &amount, local.Currency, local.Status
+	}
+	if remote != nil {
+		amount := remote.Amount
+		item.Reference, item.RemoteAmount, item.RemoteCurrency, item.RemoteStatus = remote.Reference, &amount, remote.Currency, remoteStatus(remote)
+	}
+	switch {
+	case remote == nil && local.Status == constants.FAILED:
+		// a transaction that failed before the partner processed it agrees with the partner having nothing
+		item.Result = constants.ReconciliationMatched
+	case remote == nil:
+		item.Result = constants.ReconciliationMissingRemote
+	case local == nil:
+		item.Result = constants.ReconciliationMissingLocal
+	case !local.Amount.Equal(remote.Amount) || local.Currency != remote.Currency:
+		item.Result = constants.ReconciliationAmountMismatch
+	case expectedRemoteStatus(local.Status) != item.RemoteStatus:
+		item.Result = constants.ReconciliationStatusMismatch
+	default:
+		item.Result = constants.ReconciliationMatched
+	}
+	return item
+}
+
+// partners that do not report a status only keep transactions they processed
+func remoteStatus(remote *dto.ForwardTransactionDTO) string {
+	if remote.Status == "" {
+		return constants.PartnerEventCompleted
+	}
+	return remote.Status
+}
+
+// what the partner should report for a local status, a pending transaction is still
+// waiting for the partner's confirmation and matches neither outcome
+func expectedRemoteStatus(localStatus string) string {
+	switch localStatus {
+	case constants.SUCCESS:
+		return constants.PartnerEventCompleted
+	case constants.FAILED:
+		return constants.PartnerEventFailed
+	default:
+		return ""
+	}
+}
+
+func count(report *models.ReconciliationReport, item *models.ReconciliationItem) {
+	switch item.Result {
+	case constants.ReconciliationMatched:
+		report.Matched++
+	case constants.ReconciliationMissingRemote:
+		report.MissingRemote++
+	case constants.ReconciliationMissingLocal:
+		report.MissingLocal++
+	case constants.ReconciliationAmountMismatch:
+		report.AmountMismatch++
+	case constants.ReconciliationStatusMismatch:
+		report.StatusMismatch++
+	}
+}
@@ -0,0 +1,175 @@
+package reconciliation
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/midedickson/simple-banking-app/constants"
+	"github.com/midedickson/simple-banking-app/dto"
+	"github.com/midedickson/simple-banking-app/models"
+	"gorm.io/gorm"
+)
+
+var ErrInvalidWindow = errors.New("reconciliation window must end after it starts")
+var ErrReportNotFound = errors.New("reconciliation report not found")
+
+// the part of the third-party client reconciliation reads from, satisfied by external.External
+type Fetcher interface {
+	FetchTransactionDetailsFromThirdParty(reference string) (*dto.ForwardTransactionDTO, error)
+}
+
+// compares our transactions against the partner's records and persists the outcome as a report
+type Engine struct {
+	DB      *gorm.DB
+	fetcher Fetcher
+}
+
+func NewEngine(DB *gorm.DB, fetcher Fetcher) *Engine {
+	return &Engine{DB: DB, fetcher: fetcher}
+}
+
+// reconciles the transactions created in [from, to) by fetching each one from the partner,
+// this cannot find transactions that only the partner has
+func (e *Engine) RunAgainstPartner(from time.Time, to time.Time) (*models.ReconciliationReport, error) {
+	report := &models.ReconciliationReport{WindowStart: from, WindowEnd: to, Source: constants.ReconciliationSourcePartnerAPI}
+	locals, err := e.localTransactions(from, to)
+	if err != nil {
+		return nil, err
+	}
+	var items []*models.ReconciliationItem
+	for _, local := range locals {
+		remote, err := e.fetcher.FetchTransactionDetailsFromThirdParty(local.Reference)
+		if err != nil && !errors.Is(err, constants.ErrThirdPartyTransactionNotFound) {
+			// a partial report would show transactions that were never compared as matched or missing
+			return e.fail(report, fmt.Errorf("failed to fetch %s from the partner: %w", local.Reference, err))
+		}
+		items = append(items, compare(local, remote))
+	}
+	return e.complete(report, items)
+}
+
+// reconciles the transactions created in [from, to) against records exported by the partner,
+// records for references we do not know are reported as missing locally
+func (e *Engine) RunAgainstImport(from time.Time, to time.Time, records []*dto.ForwardTransactionDTO) (*models.ReconciliationReport, error) {
+	report := &models.ReconciliationReport{WindowStart: from, WindowEnd: to, Source: constants.ReconciliationSourceImport}
+	locals, err := e.localTransactions(from, to)
+	if err != nil {
+		return nil, err
+	}
+	remotes := make(map[string]*dto.ForwardTransactionDTO, len(records))
+	for _, record := range records {
+		remotes[record.Reference] = record
+	}
+	var items []*models.ReconciliationItem
+	seen := make(map[string]bool, len(locals))
+	for _, local := range locals {
+		seen[local.Reference] = true
+		items = append(items, compare(local, remotes[local.Reference]))
+	}
+	for _, record := range records {
+		if seen[record.Reference] {
+			continue
+		}
+		seen[record.Reference] = true
+		// the partner may have booked a transaction on the other side of the window edge
+		local, err := e.localTransaction(record.Reference)
+		if err != nil {
+			return e.fail(report, err)
+		}
+		items = append(items, compare(local, record))
+	}
+	return e.complete(report, items)
+}
+
+func (e *Engine) FetchReport(id uint) (*models.ReconciliationReport, error) {
+	var report models.ReconciliationReport
+	err := e.DB.Preload("Items", func(db *gorm.DB) *gorm.DB { return db.Order("id asc") }).First(&report, id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrReportNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &report, nil
+}
+
+// transactions sent to the partner; transfer legs stay inside the bank and hold steps other than the capture move no funds
+func (e *Engine) localTransactions(from time.Time, to time.Time) ([]*models.Transaction, error) {
+	if !to.After(from) {
+		return nil, ErrInvalidWindow
+	}
+	var transactions []*models.Transaction
+	err := forwarded(e.DB).Where("created_at >= ? AND created_at < ?", from, to).Order("id asc").Find(&transactions).Error
+	return transactions, err
+}
+
+func forwarded(db *gorm.DB) *gorm.DB {
+	return db.Where("(transfer_id = '' OR transfer_id IS NULL) AND direction IN ?", []string{constants.DirectionCredit, constants.DirectionDebit})
+}
+
+func (e *Engine) localTransaction(reference string) (*models.Transaction, error) {
+	var transaction models.Transaction
+	err := forwarded(e.DB).Where("reference = ?", reference).First(&transaction).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &transaction, nil
+}
+
+func (e *Engine) complete(report *models.ReconciliationReport, items []*models.ReconciliationItem) (*models.ReconciliationReport, error) {
+	report.Status = constants.ReconciliationCompleted
+	for _, item := range items {
+		count(report, item)
+	}
+	report.Items = items
+	if err := e.DB.Create(report).Error; err != nil {
+		return nil, err
+	}
+	log.Printf("reconciliation report %d: %d matched, %d missing remote, %d missing local, %d amount mismatches, %d status mismatches",
+		report.ID, report.Matched, report.MissingRemote, report.MissingLocal, report.AmountMismatch, report.StatusMismatch)
+	return report, nil
+}
+
+// records the failed run so it shows up next to the completed ones, and returns the cause
+func (e *Engine) fail(report *models.ReconciliationReport, cause error) (*models.ReconciliationReport, error) {
+	report.Status = constants.ReconciliationFailed
+	report.Error = cause.Error()
+	if err := e.DB.Create(report).Error; err != nil {
+		log.Printf("failed to record failed reconciliation: %s", err)
+	}
+	return report, cause
+}
+
+// reconciles the previous interval every interval until the returned stop function is called,
+// each window ends lag before the tick so transactions still waiting for confirmation are left out
+func (e *Engine) Start(interval time.Duration, lag time.Duration) (stop func()) {
+	ticker := time.NewTicker(interval)
+	done := make(chan struct{})
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case now := <-ticker.C:
+				to := now.Add(-lag)
+				if _, err := e.RunAgainstPartner(to.Add(-interval), to); err != nil {
+					log.Printf("failed to reconcile transactions: %s", err)
+				}
+			}
+		}
+	}()
+	return func() { close(done) }
+}
+
+// the most recent reports without their items, newest first
+func (e *Engine) FetchRecentReports(limit int) ([]*models.ReconciliationReport, error) {
+	var reports []*models.ReconciliationReport
+	err := e.DB.Order("id desc").Limit(limit).Find(&reports).Error
+	return reports, err
+}
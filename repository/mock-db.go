@@ -1,17 +1,15 @@
 package repository
 
 import (
-	"github.com/midedickson/simple-banking-app/dto"
+	"github.com/midedickson/simple-banking-app/constants"
 	"github.com/midedickson/simple-banking-app/models"
 	"github.com/shopspring/decimal"
 )
 
-// fake db of users
+// seed accounts, created in the database on first start
 var Users []*models.UserAccount = []*models.UserAccount{
-	{ID: 1, Balance: decimal.NewFromFloat(400.0)},
-	{ID: 2, Balance: decimal.NewFromFloat(400.0)},
-	{ID: 3, Balance: decimal.NewFromFloat(400.0)},
+	{ID: 1, Balance: decimal.NewFromFloat(400.0), Currency: constants.DefaultCurrency, Status: constants.AccountStatusActive},
+	{ID: 2, Balance: decimal.NewFromFloat(400.0), Currency: constants.DefaultCurrency, Status: constants.AccountStatusActive},
+	{ID: 3, Balance: decimal.NewFromFloat(400.0), Currency: constants.DefaultCurrency, Status: constants.AccountStatusActive},
+	{ID: 4, Balance: decimal.NewFromFloat(400.0), Currency: "USD", Status: constants.AccountStatusActive},
 }
-
-// fake db of external trasnactions
-var ExternalTransactions []*dto.ForwardTransactionDTO = []*dto.ForwardTransactionDTO{}
@@ -1,6 +1,8 @@
 package repository
 
 import (
+	"time"
+
 	"github.com/midedickson/simple-banking-app/dto"
 	"github.com/midedickson/simple-banking-app/models"
 )
@@ -9,7 +11,28 @@ type Repository interface {
 	GenerateTransactionReference() string
 	CreateTransaction(createTransactionDTO *dto.CreateDBTransactionDTO) (*models.Transaction, error)
 	UpdateTransactionStatus(transaction *models.Transaction, status string) error
+	SettleTransaction(transaction *models.Transaction) error
+	// settles or fails the transaction a partner webhook reports on, constants.ErrDuplicateWebhookEvent
+	// when the event was applied before
+	ApplyWebhookEvent(event *models.WebhookEvent) (*models.Transaction, error)
+	CreateTransfer(createTransferDTO *dto.CreateDBTransferDTO) (*dto.TransferDTO, error)
+	// creates the compensating transaction for a full or partial refund and queues it for delivery
+	CreateReversal(createReversalDTO *dto.CreateDBReversalDTO) (*models.Transaction, error)
+	// reserves funds on an account without debiting them
+	AuthorizeHold(createHoldDTO *dto.CreateDBHoldDTO) (*dto.HoldDTO, error)
+	// releases an active hold and queues a debit for the captured amount
+	CaptureHold(captureHoldDTO *dto.CaptureDBHoldDTO) (*dto.HoldDTO, error)
+	// releases an active hold without debiting anything
+	VoidHold(reference string, idempotencyKey string) (*dto.HoldDTO, error)
+	// releases active holds that expired by now, reports how many
+	ExpireHolds(now time.Time) (int, error)
+	FetchHoldByReference(reference string) *models.Hold
 	FetchTransactionDetailsByReference(reference string) *models.Transaction
+	FetchRecentTransactionsByAccountID(accountID int, limit int) ([]*models.Transaction, error)
+	// up to filter.Limit transactions of an account matching the filter, ordered by creation time and ID
+	FetchTransactionHistory(filter *dto.TransactionHistoryFilter) ([]*models.Transaction, error)
+	// transactions created by the request with the given idempotency key
+	FetchTransactionsByIdempotencyKey(key string) ([]*models.Transaction, error)
 	FindAccountById(userAccountId int) *models.UserAccount
 }
 
@@ -1,18 +1,30 @@
 package repository
 
 import (
+	"errors"
 	"fmt"
 	"log"
 	"math/rand"
+	"strings"
+	"sync"
 	"time"
 
+	"github.com/midedickson/simple-banking-app/constants"
 	"github.com/midedickson/simple-banking-app/dto"
+	"github.com/midedickson/simple-banking-app/fx"
+	"github.com/midedickson/simple-banking-app/holds"
+	"github.com/midedickson/simple-banking-app/ledger"
 	"github.com/midedickson/simple-banking-app/models"
+	"github.com/midedickson/simple-banking-app/outbox"
+	"github.com/shopspring/decimal"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type StorageRepository struct {
 	DB *gorm.DB
+	// serialises balance updates so concurrent settlements cannot read the same balance
+	mu sync.Mutex
 }
 
 func NewStorageRepository(DB *gorm.DB) *StorageRepository {
@@ -37,29 +49,73 @@ func (r *StorageRepository) GenerateTransactionReference() string {
 	return transactionID
 }
 
-func (r *StorageRepository) FindAccountById(userAccountId int) *models.UserAccount {
-	// todo: implement logic to find the account based on UserAccountId
-	// iterate through the users slice and find the account with matching UserAccountId
-	for _, user := range Users {
-		if user.ID == userAccountId {
-			return user
+func (r *StorageRepository) SeedUserAccounts(accounts []*models.UserAccount) error {
+	// only create accounts that do not exist yet, so restarts keep their balances
+	for _, account := range accounts {
+		if account.Currency == "" {
+			account.Currency = constants.DefaultCurrency
+		}
+		err := r.DB.Transaction(func(tx *gorm.DB) error {
+			openingBalance := account.Balance
+			result := tx.FirstOrCreate(account, models.UserAccount{ID: account.ID})
+			if result.Error != nil || result.RowsAffected == 0 || openingBalance.IsZero() {
+				return result.Error
+			}
+			// fund new accounts from settlement so the books agree with the opening balance
+			_, err := ledger.Post(tx, fmt.Sprintf("OPEN-%d", account.ID), "opening balance",
+				ledger.Transfer(ledger.SettlementAccount, ledger.UserAccount(account.ID), openingBalance, account.Currency)...)
+			if err != nil {
+				return err
+			}
+			return ledger.CheckBalance(tx, ledger.UserAccount(account.ID), account.Currency, account.Balance)
+		})
+		if err != nil {
+			return err
 		}
 	}
-
-	// if no account found, return nil
 	return nil
 }
 
+func (r *StorageRepository) FindAccountById(userAccountId int) *models.UserAccount {
+	var userAccount models.UserAccount
+	result := r.DB.First(&userAccount, userAccountId)
+	if result.Error != nil {
+		if result.Error != gorm.ErrRecordNotFound {
+			log.Println("Error fetching user account:", result.Error)
+		}
+		return nil // No account found, return nil
+	}
+	return &userAccount
+}
+
 func (r *StorageRepository) CreateTransaction(createTransactionDTO *dto.CreateDBTransactionDTO) (*models.Transaction, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
 	transaction := models.Transaction{
-		AccountID: createTransactionDTO.AccountID,
-		Reference: r.GenerateTransactionReference(),
-		Amount:    createTransactionDTO.Amount,
-		Status:    "pending",
-		Direction: createTransactionDTO.Direction,
+		AccountID:      createTransactionDTO.AccountID,
+		Reference:      r.GenerateTransactionReference(),
+		Amount:         createTransactionDTO.Amount,
+		Currency:       createTransactionDTO.Currency,
+		Status:         "pending",
+		Direction:      createTransactionDTO.Direction,
+		IdempotencyKey: createTransactionDTO.IdempotencyKey,
 	}
-
-	return &transaction, r.DB.Create(&transaction).Error
+	// the outbox entry is written with the transaction, so a crash cannot leave
+	// a transaction that is never delivered to the third party
+	err := r.DB.Transaction(func(tx *gorm.DB) error {
+		// a debit keeps its amount held until it settles or fails, so the funds the partner
+		// is told to move cannot be spent by another debit or a transfer in the meantime
+		if transaction.Direction == constants.DirectionDebit {
+			if err := holds.Reserve(tx, transaction.AccountID, transaction.Amount); err != nil {
+				return err
+			}
+		}
+		if err := tx.Create(&transaction).Error; err != nil {
+			return err
+		}
+		return outbox.Enqueue(tx, &transaction)
+	})
+	return &transaction, err
 }
 
 func (r *StorageRepository) UpdateTransactionStatus(transaction *models.Transaction, status string) error {
@@ -67,6 +123,452 @@ func (r *StorageRepository) UpdateTransactionStatus(transaction *models.Transact
 	return r.DB.Save(&transaction).Error
 }
 
+func (r *StorageRepository) SettleTransaction(transaction *models.Transaction) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	// apply the balance effect and mark the transaction successful in one database transaction,
+	// so the ledger and the account balance never drift apart
+	return r.DB.Transaction(func(tx *gorm.DB) error {
+		return settle(tx, transaction)
+	})
+}
+
+func settle(tx *gorm.DB, transaction *models.Transaction) error {
+	userAccount, err := holds.LockAccount(tx, transaction.AccountID)
+	if err != nil {
+		return err
+	}
+	var postings []models.Posting
+	switch transaction.Direction {
+	case constants.DirectionCredit:
+		err = userAccount.Credit(transaction.Amount)
+		postings = ledger.Transfer(ledger.SettlementAccount, ledger.UserAccount(userAccount.ID), transaction.Amount, userAccount.Currency)
+	case constants.DirectionDebit:
+		// a debit spends the funds held for it since it was accepted
+		userAccount.Release(transaction.Amount)
+		err = userAccount.Debit(transaction.Amount)
+		postings = ledger.Transfer(ledger.UserAccount(userAccount.ID), ledger.SettlementAccount, transaction.Amount, userAccount.Currency)
+	default:
+		err = fmt.Errorf("unknown transaction direction %q", transaction.Direction)
+	}
+	if err != nil {
+		return err
+	}
+	if err := holds.SaveFunds(tx, userAccount); err != nil {
+		return err
+	}
+	if _, err := ledger.Post(tx, transaction.Reference, transaction.Direction, postings...); err != nil {
+		return err
+	}
+	// the stored balance must agree with the books, a drift stops the settlement instead of growing
+	if err := ledger.CheckBalance(tx, ledger.UserAccount(userAccount.ID), userAccount.Currency, userAccount.Balance); err != nil {
+		return err
+	}
+	// only a pending transaction can settle, so settling twice rolls back instead of moving the funds again
+	result := tx.Model(&models.Transaction{}).Where("id = ? AND status = ?", transaction.ID, "pending").Update("status", constants.SUCCESS)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return constants.ErrTransactionNotPending
+	}
+	transaction.Status = constants.SUCCESS
+	return nil
+}
+
+func (r *StorageRepository) ApplyWebhookEvent(event *models.WebhookEvent) (*models.Transaction, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var transaction models.Transaction
+	// the event is recorded with its effect, so a redelivered event either finds it recorded or finds nothing applied
+	err := r.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("reference = ?", event.Reference).First(&transaction).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return constants.ErrTransactionNotFound
+			}
+			return err
+		}
+		result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(event)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return constants.ErrDuplicateWebhookEvent
+		}
+		if transaction.Status != "pending" {
+			log.Printf("webhook event %s reports %s for transaction %s which is already %s", event.EventID, event.Status, transaction.Reference, transaction.Status)
+			return nil
+		}
+		if event.Status == constants.PartnerEventCompleted {
+			err := settle(tx, &transaction)
+			if !errors.Is(err, constants.ErrInsufficientFunds) {
+				return err
+			}
+			// the debit's amount was held since it was accepted, so this only happens when the account
+			// no longer agrees with its holds; the transaction fails and the settlement import puts
+			// the partner's entry for it in suspense
+			log.Printf("confirmed debit %s cannot settle: %s", transaction.Reference, err)
+		}
+		// the dispatcher may have given up on the transaction meanwhile, its amount is released only once
+		result = tx.Model(&models.Transaction{}).Where("id = ? AND status = ?", transaction.ID, "pending").Update("status", constants.FAILED)
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+		transaction.Status = constants.FAILED
+		return holds.ReleaseDebit(tx, &transaction)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &transaction, nil
+}
+
+func (r *StorageRepository) CreateTransfer(createTransferDTO *dto.CreateDBTransferDTO) (*dto.TransferDTO, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	transfer := &dto.TransferDTO{
+		TransferID: fmt.Sprintf("%s-%d-%d", "TRF", time.Now().UnixNano(), rand.Int63()),
+	}
+	debitReference, creditReference := r.GenerateTransactionReference(), r.GenerateTransactionReference()
+	// both legs and both balance updates are written in one database transaction,
+	// so a failure at any point leaves neither account changed
+	err := r.DB.Transaction(func(tx *gorm.DB) error {
+		sourceAccount, destinationAccount, err := lockTransferAccounts(tx, createTransferDTO.SourceAccountID, createTransferDTO.DestinationAccountID)
+		if err != nil {
+			return err
+		}
+		isConversion := sourceAccount.Currency != destinationAccount.Currency
+		if isConversion && createTransferDTO.FXRate == nil {
+			return constants.ErrCurrencyMismatch
+		}
+		// a conversion executes at a quote, which it uses up, so no rate is booked without one
+		if isConversion {
+			if createTransferDTO.QuoteID == "" {
+				return constants.ErrQuoteNotFound
+			}
+			quote, err := fx.ConsumeQuote(tx, createTransferDTO.QuoteID, transfer.TransferID)
+			if err != nil {
+				return err
+			}
+			if quote.From != sourceAccount.Currency || quote.To != destinationAccount.Currency || !quote.Rate.Equal(*createTransferDTO.FXRate) {
+				return constants.ErrQuoteMismatch
+			}
+		}
+		if err := sourceAccount.Debit(createTransferDTO.Amount); err != nil {
+			return err
+		}
+		if err := destinationAccount.Credit(createTransferDTO.DestinationAmount); err != nil {
+			return err
+		}
+		if err := holds.SaveFunds(tx, sourceAccount); err != nil {
+			return err
+		}
+		if err := holds.SaveFunds(tx, destinationAccount); err != nil {
+			return err
+		}
+		postings := ledger.Transfer(ledger.UserAccount(sourceAccount.ID), ledger.UserAccount(destinationAccount.ID), createTransferDTO.Amount, sourceAccount.Currency)
+		if isConversion {
+			// route the conversion through the fx position so each currency balances on its own
+			postings = append(
+				ledger.Transfer(ledger.UserAccount(sourceAccount.ID), ledger.FXAccount, createTransferDTO.Amount, sourceAccount.Currency),
+				ledger.Transfer(ledger.FXAccount, ledger.UserAccount(destinationAccount.ID), createTransferDTO.DestinationAmount, destinationAccount.Currency)...,
+			)
+		}
+		if _, err := ledger.Post(tx, transfer.TransferID, "transfer", postings...); err != nil {
+			return err
+		}
+		for _, account := range []*models.UserAccount{sourceAccount, destinationAccount} {
+			if err := ledger.CheckBalance(tx, ledger.UserAccount(account.ID), account.Currency, account.Balance); err != nil {
+				return err
+			}
+		}
+		transfer.Debit = &models.Transaction{
+			AccountID:      sourceAccount.ID,
+			Reference:      debitReference,
+			Amount:         createTransferDTO.Amount,
+			Currency:       sourceAccount.Currency,
+			Direction:      constants.DirectionDebit,
+			Status:         constants.SUCCESS,
+			TransferID:     transfer.TransferID,
+			IdempotencyKey: createTransferDTO.IdempotencyKey,
+		}
+		transfer.Credit = &models.Transaction{
+			AccountID:      destinationAccount.ID,
+			Reference:      creditReference,
+			Amount:         createTransferDTO.DestinationAmount,
+			Currency:       destinationAccount.Currency,
+			Direction:      constants.DirectionCredit,
+			Status:         constants.SUCCESS,
+			TransferID:     transfer.TransferID,
+			IdempotencyKey: createTransferDTO.IdempotencyKey,
+		}
+		if isConversion {
+			transfer.Debit.FXRate, transfer.Credit.FXRate = createTransferDTO.FXRate, createTransferDTO.FXRate
+			transfer.Debit.CounterAmount, transfer.Debit.CounterCurrency = &createTransferDTO.DestinationAmount, destinationAccount.Currency
+			transfer.Credit.CounterAmount, transfer.Credit.CounterCurrency = &createTransferDTO.Amount, sourceAccount.Currency
+		}
+		if err := tx.Create(transfer.Debit).Error; err != nil {
+			return err
+		}
+		return tx.Create(transfer.Credit).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return transfer, nil
+}
+
+// locks both accounts of a transfer in ID order, so two transfers in opposite directions cannot deadlock
+func lockTransferAccounts(tx *gorm.DB, sourceAccountID int, destinationAccountID int) (*models.UserAccount, *models.UserAccount, error) {
+	firstID, secondID := sourceAccountID, destinationAccountID
+	if secondID < firstID {
+		firstID, secondID = secondID, firstID
+	}
+	first, err := holds.LockAccount(tx, firstID)
+	if err != nil {
+		return nil, nil, err
+	}
+	second, err := holds.LockAccount(tx, secondID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if first.ID != sourceAccountID {
+		first, second = second, first
+	}
+	return first, second, nil
+}
+
+func (r *StorageRepository) CreateReversal(createReversalDTO *dto.CreateDBReversalDTO) (*models.Transaction, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	reversal := &models.Transaction{
+		Reference:      r.GenerateTransactionReference(),
+		Status:         "pending",
+		ReversalOf:     createReversalDTO.Reference,
+		IdempotencyKey: createReversalDTO.IdempotencyKey,
+	}
+	// the refunded total is checked and the reversal written in one database transaction,
+	// so concurrent refunds cannot together exceed the original amount
+	err := r.DB.Transaction(func(tx *gorm.DB) error {
+		var original models.Transaction
+		if err := tx.Where("reference = ?", createReversalDTO.Reference).First(&original).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return constants.ErrTransactionNotFound
+			}
+			return err
+		}
+		// transfer legs never reach the third party, reversals are not reversed again and hold steps other than the capture move no funds
+		isCreditOrDebit := original.Direction == constants.DirectionCredit || original.Direction == constants.DirectionDebit
+		if original.Status != constants.SUCCESS || !isCreditOrDebit || original.TransferID != "" || original.ReversalOf != "" {
+			return constants.ErrTransactionNotReversible
+		}
+		// pending reversals count too, a failed one gives its amount back;
+		// the amounts are summed here rather than in SQL, which would add them up as floats
+		var amounts []decimal.Decimal
+		err := tx.Model(&models.Transaction{}).Where("reversal_of = ? AND status <> ?", original.Reference, constants.FAILED).
+			Pluck("amount", &amounts).Error
+		if err != nil {
+			return err
+		}
+		reversed := decimal.Zero
+		for _, amount := range amounts {
+			reversed = reversed.Add(amount)
+		}
+		remaining := original.Amount.Sub(reversed)
+		amount := remaining
+		if createReversalDTO.Amount != nil {
+			amount = *createReversalDTO.Amount
+		}
+		if !remaining.IsPositive() || amount.GreaterThan(remaining) {
+			return constants.ErrReversalExceedsAmount
+		}
+		reversal.AccountID, reversal.Amount, reversal.Currency = original.AccountID, amount, original.Currency
+		reversal.Direction = constants.DirectionCredit
+		if original.Direction == constants.DirectionCredit {
+			reversal.Direction = constants.DirectionDebit
+			// taking a credit back is a debit, its amount is held until it settles like any other debit
+			if err := holds.Reserve(tx, original.AccountID, amount); err != nil {
+				return err
+			}
+		}
+		if err := tx.Create(reversal).Error; err != nil {
+			return err
+		}
+		return outbox.Enqueue(tx, reversal)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return reversal, nil
+}
+
+func (r *StorageRepository) AuthorizeHold(createHoldDTO *dto.CreateDBHoldDTO) (*dto.HoldDTO, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	hold := &models.Hold{
+		Reference: fmt.Sprintf("%s-%d-%d", "HLD", time.Now().UnixNano(), rand.Int63()),
+		AccountID: createHoldDTO.AccountID,
+		Amount:    createHoldDTO.Amount,
+		Currency:  createHoldDTO.Currency,
+		Status:    constants.HoldActive,
+		ExpiresAt: createHoldDTO.ExpiresAt,
+	}
+	authorization := holdTransaction(hold, r.GenerateTransactionReference(), constants.DirectionAuthorization, hold.Amount, createHoldDTO.IdempotencyKey)
+	err := r.DB.Transaction(func(tx *gorm.DB) error {
+		if err := holds.Reserve(tx, createHoldDTO.AccountID, hold.Amount); err != nil {
+			return err
+		}
+		if err := tx.Create(hold).Error; err != nil {
+			return err
+		}
+		return tx.Create(authorization).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &dto.HoldDTO{Hold: hold, Transaction: authorization}, nil
+}
+
+func (r *StorageRepository) CaptureHold(captureHoldDTO *dto.CaptureDBHoldDTO) (*dto.HoldDTO, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var hold models.Hold
+	var capture *models.Transaction
+	captureReference := r.GenerateTransactionReference()
+	// the uncaptured rest of the hold is released and the captured amount becomes a pending debit,
+	// forwarded like any other debit; it stays held until the debit settles or fails
+	err := r.DB.Transaction(func(tx *gorm.DB) error {
+		if err := activeHold(tx, captureHoldDTO.Reference, &hold); err != nil {
+			return err
+		}
+		amount := hold.Amount
+		if captureHoldDTO.Amount != nil {
+			amount = *captureHoldDTO.Amount
+		}
+		if amount.GreaterThan(hold.Amount) {
+			return constants.ErrCaptureExceedsHold
+		}
+		if err := closeHold(tx, &hold, constants.HoldCaptured, amount); err != nil {
+			return err
+		}
+		capture = holdTransaction(&hold, captureReference, constants.DirectionDebit, amount, captureHoldDTO.IdempotencyKey)
+		capture.Status = "pending"
+		if err := tx.Create(capture).Error; err != nil {
+			return err
+		}
+		return outbox.Enqueue(tx, capture)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &dto.HoldDTO{Hold: &hold, Transaction: capture}, nil
+}
+
+func (r *StorageRepository) VoidHold(reference string, idempotencyKey string) (*dto.HoldDTO, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var hold models.Hold
+	var void *models.Transaction
+	voidReference := r.GenerateTransactionReference()
+	err := r.DB.Transaction(func(tx *gorm.DB) error {
+		if err := activeHold(tx, reference, &hold); err != nil {
+			return err
+		}
+		if err := closeHold(tx, &hold, constants.HoldVoided, decimal.Zero); err != nil {
+			return err
+		}
+		void = holdTransaction(&hold, voidReference, constants.DirectionVoid, hold.Amount, idempotencyKey)
+		return tx.Create(void).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &dto.HoldDTO{Hold: &hold, Transaction: void}, nil
+}
+
+func (r *StorageRepository) ExpireHolds(now time.Time) (int, error) {
+	var holds []*models.Hold
+	if err := r.DB.Where("status = ? AND expires_at <= ?", constants.HoldActive, now).Order("id asc").Find(&holds).Error; err != nil {
+		return 0, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	expired := 0
+	for _, hold := range holds {
+		expiryReference := r.GenerateTransactionReference()
+		err := r.DB.Transaction(func(tx *gorm.DB) error {
+			if err := closeHold(tx, hold, constants.HoldExpired, decimal.Zero); err != nil {
+				return err
+			}
+			return tx.Create(holdTransaction(hold, expiryReference, constants.DirectionExpiry, hold.Amount, "")).Error
+		})
+		// a hold captured or voided since it was listed is left alone
+		if errors.Is(err, constants.ErrHoldNotActive) {
+			continue
+		}
+		if err != nil {
+			return expired, err
+		}
+		expired++
+	}
+	return expired, nil
+}
+
+// loads a hold that can still be captured or voided; a hold past its expiry is treated as expired
+// even before the expirer gets to it
+func activeHold(tx *gorm.DB, reference string, hold *models.Hold) error {
+	if err := tx.Where("reference = ?", reference).First(hold).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return constants.ErrHoldNotFound
+		}
+		return err
+	}
+	if hold.Status != constants.HoldActive || !time.Now().Before(hold.ExpiresAt) {
+		return constants.ErrHoldNotActive
+	}
+	return nil
+}
+
+// moves an active hold to status and gives back the part of its reservation that was not captured
+func closeHold(tx *gorm.DB, hold *models.Hold, status string, capturedAmount decimal.Decimal) error {
+	// only an active hold can close, so a hold is never released twice
+	result := tx.Model(&models.Hold{}).Where("id = ? AND status = ?", hold.ID, constants.HoldActive).
+		Updates(map[string]interface{}{"status": status, "captured_amount": capturedAmount})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return constants.ErrHoldNotActive
+	}
+	hold.Status, hold.CapturedAmount = status, capturedAmount
+	return holds.Release(tx, hold.AccountID, hold.Amount.Sub(capturedAmount))
+}
+
+// the record of one step taken on a hold
+func holdTransaction(hold *models.Hold, reference string, direction string, amount decimal.Decimal, idempotencyKey string) *models.Transaction {
+	return &models.Transaction{
+		AccountID:      hold.AccountID,
+		Reference:      reference,
+		Amount:         amount,
+		Currency:       hold.Currency,
+		Direction:      direction,
+		Status:         constants.SUCCESS,
+		HoldReference:  hold.Reference,
+		IdempotencyKey: idempotencyKey,
+	}
+}
+
+func (r *StorageRepository) FetchHoldByReference(reference string) *models.Hold {
+	var hold models.Hold
+	if err := r.DB.Where("reference = ?", reference).First(&hold).Error; err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			log.Println("Error fetching hold:", err)
+		}
+		return nil
+	}
+	return &hold
+}
+
 func (r *StorageRepository) FetchTransactionDetailsByReference(reference string) *models.Transaction {
 	var transaction models.Transaction
 	result := r.DB.Where("reference =?", reference).First(&transaction)
@@ -81,3 +583,70 @@ func (r *StorageRepository) FetchTransactionDetailsByReference(reference string)
 	}
 	return nil // No transaction found, return nil
 }
+
+func (r *StorageRepository) FetchRecentTransactionsByAccountID(accountID int, limit int) ([]*models.Transaction, error) {
+	transactions := []*models.Transaction{}
+	err := r.DB.Where("account_id = ?", accountID).Order("created_at desc, id desc").Limit(limit).Find(&transactions).Error
+	return transactions, err
+}
+
+func (r *StorageRepository) FetchTransactionHistory(filter *dto.TransactionHistoryFilter) ([]*models.Transaction, error) {
+	query := r.DB.Where("account_id = ?", filter.AccountID)
+	if filter.Direction != "" {
+		query = query.Where("direction = ?", filter.Direction)
+	}
+	if filter.Status != "" {
+		query = query.Where("status = ?", filter.Status)
+	}
+	if filter.From != nil {
+		query = query.Where("created_at >= ?", *filter.From)
+	}
+	if filter.To != nil {
+		query = query.Where("created_at < ?", *filter.To)
+	}
+	if filter.MinAmount != nil {
+		query = query.Where(amountKeySQL+" >= ?", amountKey(*filter.MinAmount))
+	}
+	if filter.MaxAmount != nil {
+		query = query.Where(amountKeySQL+" <= ?", amountKey(*filter.MaxAmount))
+	}
+	// the ID breaks ties between transactions created at the same instant, so pages never overlap or skip
+	comparison, order := "<", "created_at desc, id desc"
+	if filter.Ascending {
+		comparison, order = ">", "created_at asc, id asc"
+	}
+	if filter.After != nil {
+		query = query.Where(fmt.Sprintf("(created_at %[1]s ? OR (created_at = ? AND id %[1]s ?))", comparison),
+			filter.After.CreatedAt, filter.After.CreatedAt, filter.After.ID)
+	}
+	transactions := []*models.Transaction{}
+	err := query.Order(order).Limit(filter.Limit).Find(&transactions).Error
+	return transactions, err
+}
+
+// digits kept on either side of the decimal point when comparing amounts
+const (
+	amountKeyIntegerDigits  = 30
+	amountKeyFractionDigits = 18
+)
+
+// Amounts are stored as text, and CAST(amount AS NUMERIC) would compare them as floating point.
+// Both sides are compared as fixed-width digit strings instead, the integer part padded with zeros
+// on the left and the fraction on the right, which sort exactly like the non-negative amounts they hold.
+var amountKeySQL = fmt.Sprintf(
+	"replace(printf('%%%[1]ds', CASE WHEN instr(amount, '.') > 0 THEN substr(amount, 1, instr(amount, '.') - 1) ELSE amount END), ' ', '0') || "+
+		"replace(printf('%%-%[2]ds', CASE WHEN instr(amount, '.') > 0 THEN substr(amount, instr(amount, '.') + 1) ELSE '' END), ' ', '0')",
+	amountKeyIntegerDigits, amountKeyFractionDigits,
+)
+
+// the key amountKeySQL builds for a stored amount; filter amounts past the last kept decimal place are rounded
+func amountKey(amount decimal.Decimal) string {
+	integer, fraction, _ := strings.Cut(amount.StringFixed(amountKeyFractionDigits), ".")
+	return strings.Repeat("0", amountKeyIntegerDigits-len(integer)) + integer + fraction
+}
+
+func (r *StorageRepository) FetchTransactionsByIdempotencyKey(key string) ([]*models.Transaction, error) {
+	transactions := []*models.Transaction{}
+	err := r.DB.Where("idempotency_key = ?", key).Order("id asc").Find(&transactions).Error
+	return transactions, err
+}
@@ -9,7 +9,25 @@ func ConnectRoutes(r *mux.Router, controller *controllers.Controller) {
 	r.HandleFunc("/", controller.Hello).Methods("GET")
 	r.HandleFunc("/transaction/credit", controller.CreateCreditTransaction).Methods("POST")
 	r.HandleFunc("/transaction/debit", controller.CreateDebitTransaction).Methods("POST")
+	r.HandleFunc("/transfer", controller.CreateTransfer).Methods("POST")
+	r.HandleFunc("/hold", controller.CreateHold).Methods("POST")
+	r.HandleFunc("/hold/{reference}", controller.FetchHold).Methods("GET")
+	r.HandleFunc("/hold/{reference}/capture", controller.CaptureHold).Methods("POST")
+	r.HandleFunc("/hold/{reference}/void", controller.VoidHold).Methods("POST")
+	r.HandleFunc("/fx/quote", controller.CreateFXQuote).Methods("POST")
 	r.HandleFunc("/idempotency", controller.RequestNewIdempotencyKey).Methods("GET")
 	r.HandleFunc("/transaction/{reference}", controller.FetchTransactionDetails).Methods("GET")
+	r.HandleFunc("/transaction/{reference}/reverse", controller.ReverseTransaction).Methods("POST")
 	r.HandleFunc("/account/{id}", controller.FetchUserAccountDetails).Methods("GET")
+	r.HandleFunc("/account/{id}/transactions", controller.FetchAccountTransactions).Methods("GET")
+	r.HandleFunc("/third-party/status", controller.FetchThirdPartyStatus).Methods("GET")
+	r.HandleFunc("/webhooks/partner", controller.ReceivePartnerWebhook).Methods("POST")
+	r.HandleFunc("/reconciliation", controller.CreateReconciliationReport).Methods("POST")
+	r.HandleFunc("/reconciliation", controller.FetchReconciliationReports).Methods("GET")
+	r.HandleFunc("/reconciliation/{id}", controller.FetchReconciliationReport).Methods("GET")
+	r.HandleFunc("/settlement/imports", controller.CreateSettlementImport).Methods("POST")
+	r.HandleFunc("/settlement/imports/{id}", controller.FetchSettlementImport).Methods("GET")
+	r.HandleFunc("/settlement/imports/{id}/rerun", controller.RerunSettlementImport).Methods("POST")
+	r.HandleFunc("/settlement/suspense", controller.FetchSuspenseItems).Methods("GET")
+	r.HandleFunc("/settlement/suspense/{id}/resolve", controller.ResolveSuspenseItem).Methods("POST")
 }
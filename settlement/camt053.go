@@ -0,0 +1,137 @@
+package settlement
+
+import (
+	"encoding/xml"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/midedickson/simple-banking-app/constants"
+	"github.com/shopspring/decimal"
+)
+
+// the parts of an ISO 20022 camt.053 bank-to-customer statement the importer reads
+type camt053Document struct {
+	Statements []struct {
+		ID      string         `xml:"Id"`
+		Entries []camt053Entry `xml:"Ntry"`
+	} `xml:"BkToCstmrStmt>Stmt"`
+}
+
+type camt053Entry struct {
+	Reference    string        `xml:"NtryRef"`
+	Amount       camt053Amount `xml:"Amt"`
+	CreditDebit  string        `xml:"CdtDbtInd"`
+	BookingDate  camt053Date   `xml:"BookgDt"`
+	Transactions []struct {
+		EndToEndID string         `xml:"Refs>EndToEndId"`
+		Amount     *camt053Amount `xml:"AmtDtls>TxAmt>Amt"`
+	} `xml:"NtryDtls>TxDtls"`
+}
+
+type camt053Amount struct {
+	Value    string `xml:",chardata"`
+	Currency string `xml:"Ccy,attr"`
+}
+
+type camt053Date struct {
+	Date     string `xml:"Dt"`
+	DateTime string `xml:"DtTm"`
+}
+
+// parses a camt.053 statement, a batched entry yields one statement entry per transaction in it;
+// our transaction reference travels as the end-to-end ID, or the entry reference when there is none
+func ParseCamt053(content []byte) (*Statement, error) {
+	var document camt053Document
+	if err := xml.Unmarshal(content, &document); err != nil {
+		return nil, fmt.Errorf("failed to parse camt.053 statement: %w", err)
+	}
+	if len(document.Statements) == 0 {
+		return nil, fmt.Errorf("camt.053 document has no statement")
+	}
+	statement := &Statement{}
+	var ids []string
+	line := 0
+	for _, stmt := range document.Statements {
+		ids = append(ids, stmt.ID)
+		for _, ntry := range stmt.Entries {
+			entries, err := parseCamt053Entry(ntry)
+			if err != nil {
+				return nil, fmt.Errorf("entry %d: %w", line+1, err)
+			}
+			for _, entry := range entries {
+				line++
+				entry.Line = line
+				statement.Entries = append(statement.Entries, entry)
+			}
+		}
+	}
+	statement.ID = strings.Join(ids, ",")
+	return statement, nil
+}
+
+func parseCamt053Entry(ntry camt053Entry) ([]*StatementEntry, error) {
+	var direction string
+	switch ntry.CreditDebit {
+	case "CRDT":
+		direction = constants.DirectionCredit
+	case "DBIT":
+		direction = constants.DirectionDebit
+	default:
+		return nil, fmt.Errorf("invalid CdtDbtInd %q", ntry.CreditDebit)
+	}
+	bookingDate, err := ntry.BookingDate.parse()
+	if err != nil {
+		return nil, err
+	}
+	if len(ntry.Transactions) == 0 {
+		amount, currency, err := ntry.Amount.parse()
+		if err != nil {
+			return nil, err
+		}
+		return []*StatementEntry{{Reference: ntry.Reference, Amount: amount, Currency: currency, Direction: direction, BookingDate: bookingDate}}, nil
+	}
+	var entries []*StatementEntry
+	for _, tx := range ntry.Transactions {
+		txAmount := ntry.Amount
+		if tx.Amount != nil {
+			txAmount = *tx.Amount
+		}
+		amount, currency, err := txAmount.parse()
+		if err != nil {
+			return nil, err
+		}
+		reference := tx.EndToEndID
+		if reference == "" || reference == "NOTPROVIDED" {
+			reference = ntry.Reference
+		}
+		entries = append(entries, &StatementEntry{Reference: reference, Amount: amount, Currency: currency, Direction: direction, BookingDate: bookingDate})
+	}
+	return entries, nil
+}
+
+func (a camt053Amount) parse() (decimal.Decimal, string, error) {
+	amount, err := decimal.NewFromString(strings.TrimSpace(a.Value))
+	if err != nil {
+		return decimal.Zero, "", fmt.Errorf("invalid amount %q", a.Value)
+	}
+	return amount, strings.ToUpper(a.Currency), nil
+}
+
+func (d camt053Date) parse() (*time.Time, error) {
+	switch {
+	case d.Date != "":
+		date, err := time.Parse(time.DateOnly, d.Date)
+		if err != nil {
+			return nil, fmt.Errorf("invalid booking date %q", d.Date)
+		}
+		return &date, nil
+	case d.DateTime != "":
+		dateTime, err := time.Parse(time.RFC3339, d.DateTime)
+		if err != nil {
+			return nil, fmt.Errorf("invalid booking date %q", d.DateTime)
+		}
+		return &dateTime, nil
+	}
+	return nil, nil
+}
@@ -0,0 +1,87 @@
+package settlement
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/midedickson/simple-banking-app/constants"
+	"github.com/shopspring/decimal"
+)
+
+// columns a CSV statement must have, direction and booking_date are optional
+var requiredCSVColumns = []string{"reference", "amount", "currency"}
+
+// parses a CSV statement with a header row naming its columns:
+// reference, amount, currency and optionally direction (credit or debit) and booking_date (YYYY-MM-DD)
+func ParseCSV(content []byte) (*Statement, error) {
+	reader := csv.NewReader(bytes.NewReader(content))
+	reader.TrimLeadingSpace = true
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CSV header: %w", err)
+	}
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	for _, name := range requiredCSVColumns {
+		if _, ok := columns[name]; !ok {
+			return nil, fmt.Errorf("CSV header is missing the %q column", name)
+		}
+	}
+	statement := &Statement{}
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		line, _ := reader.FieldPos(0)
+		entry, err := parseCSVRecord(record, columns)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		entry.Line = line
+		statement.Entries = append(statement.Entries, entry)
+	}
+	return statement, nil
+}
+
+func parseCSVRecord(record []string, columns map[string]int) (*StatementEntry, error) {
+	field := func(name string) string {
+		if i, ok := columns[name]; ok && i < len(record) {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+	amount, err := decimal.NewFromString(field("amount"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid amount %q", field("amount"))
+	}
+	entry := &StatementEntry{
+		Reference: field("reference"),
+		Amount:    amount,
+		Currency:  strings.ToUpper(field("currency")),
+	}
+	switch direction := strings.ToLower(field("direction")); direction {
+	case "", constants.DirectionCredit, constants.DirectionDebit:
+		entry.Direction = direction
+	default:
+		return nil, fmt.Errorf("invalid direction %q", direction)
+	}
+	if rawDate := field("booking_date"); rawDate != "" {
+		bookingDate, err := time.Parse(time.DateOnly, rawDate)
+		if err != nil {
+			return nil, fmt.Errorf("invalid booking_date %q", rawDate)
+		}
+		entry.BookingDate = &bookingDate
+	}
+	return entry, nil
+}
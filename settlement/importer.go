@@ -0,0 +1,220 @@
+package settlement
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/midedickson/simple-banking-app/constants"
+	"github.com/midedickson/simple-banking-app/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var ErrDuplicateImport = errors.New("settlement file has already been imported")
+var ErrImportNotFound = errors.New("settlement import not found")
+var ErrSuspenseItemNotFound = errors.New("suspense item not found")
+var ErrInvalidStatement = errors.New("settlement file could not be parsed")
+
+// stores partner settlement files and matches their entries to our transactions,
+// entries that cannot be matched are queued in suspense for ops
+type Importer struct {
+	DB *gorm.DB
+}
+
+func NewImporter(DB *gorm.DB) *Importer {
+	return &Importer{DB: DB}
+}
+
+// stores the file and matches it; a file that cannot be parsed is stored as failed and returned with ErrInvalidStatement.
+// Importing the same content twice returns the first import with ErrDuplicateImport.
+func (i *Importer) Import(format string, fileName string, content []byte) (*models.SettlementImport, error) {
+	if format != constants.SettlementFormatCSV && format != constants.SettlementFormatCamt053 {
+		return nil, ErrUnsupportedFormat
+	}
+	checksum := sha256.Sum256(content)
+	settlementImport := &models.SettlementImport{
+		Format:   format,
+		FileName: fileName,
+		Checksum: hex.EncodeToString(checksum[:]),
+		Content:  content,
+		Status:   constants.SettlementImportFailed,
+	}
+	result := i.DB.Clauses(clause.OnConflict{DoNothing: true}).Create(settlementImport)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		var existing models.SettlementImport
+		if err := i.DB.Where("checksum = ?", settlementImport.Checksum).First(&existing).Error; err != nil {
+			return nil, err
+		}
+		return &existing, ErrDuplicateImport
+	}
+	return i.run(settlementImport)
+}
+
+// matches a stored file again from its original content, e.g. after missing transactions were booked;
+// suspense items ops already resolved are kept
+func (i *Importer) Rerun(id uint) (*models.SettlementImport, error) {
+	var settlementImport models.SettlementImport
+	if err := i.DB.First(&settlementImport, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrImportNotFound
+		}
+		return nil, err
+	}
+	return i.run(&settlementImport)
+}
+
+func (i *Importer) run(settlementImport *models.SettlementImport) (*models.SettlementImport, error) {
+	statement, parseErr := Parse(settlementImport.Format, settlementImport.Content)
+	err := i.DB.Transaction(func(tx *gorm.DB) error {
+		// the previous run's outcome is replaced, so a re-run against the same data gives the same result
+		if err := tx.Where("import_id = ?", settlementImport.ID).Delete(&models.SettlementEntry{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Where("import_id = ? AND status = ?", settlementImport.ID, constants.SuspenseOpen).Delete(&models.SuspenseItem{}).Error; err != nil {
+			return err
+		}
+		settlementImport.Runs++
+		settlementImport.LastRunAt = time.Now()
+		settlementImport.EntryCount, settlementImport.Matched, settlementImport.Suspended = 0, 0, 0
+		settlementImport.Entries = nil
+		if parseErr != nil {
+			settlementImport.Status, settlementImport.Error = constants.SettlementImportFailed, parseErr.Error()
+			return tx.Omit("Entries").Save(settlementImport).Error
+		}
+		settlementImport.Status, settlementImport.Error, settlementImport.StatementID = constants.SettlementImportCompleted, "", statement.ID
+		seen := make(map[string]bool, len(statement.Entries))
+		for _, statementEntry := range statement.Entries {
+			entry, reason, err := match(tx, settlementImport.ID, statementEntry, seen)
+			if err != nil {
+				return err
+			}
+			if err := tx.Create(entry).Error; err != nil {
+				return err
+			}
+			settlementImport.Entries = append(settlementImport.Entries, entry)
+			settlementImport.EntryCount++
+			if reason == "" {
+				settlementImport.Matched++
+				continue
+			}
+			settlementImport.Suspended++
+			if err := suspend(tx, settlementImport.ID, entry, reason); err != nil {
+				return err
+			}
+		}
+		return tx.Omit("Entries").Save(settlementImport).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("settlement import %d (run %d): %d entries, %d matched, %d suspended",
+		settlementImport.ID, settlementImport.Runs, settlementImport.EntryCount, settlementImport.Matched, settlementImport.Suspended)
+	if parseErr != nil {
+		return settlementImport, fmt.Errorf("%w: %v", ErrInvalidStatement, parseErr)
+	}
+	return settlementImport, nil
+}
+
+// matches one statement entry by reference, reports the suspense reason when it does not match
+func match(tx *gorm.DB, importID uint, statementEntry *StatementEntry, seen map[string]bool) (*models.SettlementEntry, string, error) {
+	entry := &models.SettlementEntry{
+		ImportID:    importID,
+		Line:        statementEntry.Line,
+		Reference:   statementEntry.Reference,
+		Amount:      statementEntry.Amount,
+		Currency:    statementEntry.Currency,
+		Direction:   statementEntry.Direction,
+		BookingDate: statementEntry.BookingDate,
+		Result:      constants.SettlementEntrySuspended,
+	}
+	if statementEntry.Reference == "" {
+		return entry, constants.SuspenseMissingReference, nil
+	}
+	if seen[statementEntry.Reference] {
+		return entry, constants.SuspenseDuplicateEntry, nil
+	}
+	seen[statementEntry.Reference] = true
+	var transaction models.Transaction
+	err := tx.Where("reference = ?", statementEntry.Reference).First(&transaction).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return entry, constants.SuspenseUnknownReference, nil
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	if !transaction.Amount.Equal(statementEntry.Amount) || transaction.Currency != statementEntry.Currency {
+		return entry, constants.SuspenseAmountMismatch, nil
+	}
+	if statementEntry.Direction != "" && statementEntry.Direction != transaction.Direction {
+		return entry, constants.SuspenseDirectionMismatch, nil
+	}
+	if transaction.Status != constants.SUCCESS {
+		return entry, constants.SuspenseStatusMismatch, nil
+	}
+	entry.TransactionID, entry.Result = &transaction.ID, constants.SettlementEntryMatched
+	return entry, "", nil
+}
+
+// queues the entry for ops, unless an item ops already resolved covers the same line
+func suspend(tx *gorm.DB, importID uint, entry *models.SettlementEntry, reason string) error {
+	item := &models.SuspenseItem{
+		ImportID:  importID,
+		Line:      entry.Line,
+		Reference: entry.Reference,
+		Amount:    entry.Amount,
+		Currency:  entry.Currency,
+		Reason:    reason,
+		Status:    constants.SuspenseOpen,
+	}
+	return tx.Clauses(clause.OnConflict{DoNothing: true}).Create(item).Error
+}
+
+func (i *Importer) FetchImport(id uint) (*models.SettlementImport, error) {
+	var settlementImport models.SettlementImport
+	err := i.DB.Preload("Entries", func(db *gorm.DB) *gorm.DB { return db.Order("line asc") }).First(&settlementImport, id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrImportNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &settlementImport, nil
+}
+
+// suspense items with the given status, oldest first; every item when status is empty
+func (i *Importer) FetchSuspenseItems(status string) ([]*models.SuspenseItem, error) {
+	query := i.DB.Order("id asc")
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	var items []*models.SuspenseItem
+	err := query.Find(&items).Error
+	return items, err
+}
+
+// closes a suspense item once ops has dealt with it, resolving an item twice keeps the first note
+func (i *Importer) ResolveSuspenseItem(id uint, note string) (*models.SuspenseItem, error) {
+	var item models.SuspenseItem
+	if err := i.DB.First(&item, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrSuspenseItemNotFound
+		}
+		return nil, err
+	}
+	if item.Status == constants.SuspenseResolved {
+		return &item, nil
+	}
+	now := time.Now()
+	item.Status, item.Note, item.ResolvedAt = constants.SuspenseResolved, note, &now
+	if err := i.DB.Save(&item).Error; err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
@@ -0,0 +1,43 @@
+package settlement
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/midedickson/simple-banking-app/constants"
+	"github.com/shopspring/decimal"
+)
+
+var ErrUnsupportedFormat = errors.New("unsupported settlement file format")
+
+// one line of a partner settlement statement, whatever file format it came in
+type StatementEntry struct {
+	// position of the entry in the file, the CSV line number or the camt.053 entry number
+	Line      int
+	Reference string
+	Amount    decimal.Decimal
+	Currency  string
+	// constants.DirectionCredit or constants.DirectionDebit, empty when the file does not say
+	Direction   string
+	BookingDate *time.Time
+}
+
+// a parsed settlement file
+type Statement struct {
+	// the partner's identifier for the statement, empty when the format has none
+	ID      string
+	Entries []*StatementEntry
+}
+
+// parses a statement in the given format, constants.SettlementFormatCSV or constants.SettlementFormatCamt053
+func Parse(format string, content []byte) (*Statement, error) {
+	switch format {
+	case constants.SettlementFormatCSV:
+		return ParseCSV(content)
+	case constants.SettlementFormatCamt053:
+		return ParseCamt053(content)
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnsupportedFormat, format)
+	}
+}
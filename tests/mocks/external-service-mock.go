@@ -1,6 +1,8 @@
 package mocks
 
 import (
+	"github.com/midedickson/simple-banking-app/dto"
+	"github.com/midedickson/simple-banking-app/external"
 	"github.com/midedickson/simple-banking-app/models"
 	"github.com/stretchr/testify/mock"
 )
@@ -14,3 +16,16 @@ func (m *MockExternal) ForwardTransactionToThirdParty(transaction *models.Transa
 	args := m.Called(transaction)
 	return args.Error(0)
 }
+
+func (m *MockExternal) FetchTransactionDetailsFromThirdParty(reference string) (*dto.ForwardTransactionDTO, error) {
+	args := m.Called(reference)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*dto.ForwardTransactionDTO), args.Error(1)
+}
+
+func (m *MockExternal) CircuitBreakerState() external.CircuitBreakerState {
+	args := m.Called()
+	return args.Get(0).(external.CircuitBreakerState)
+}
@@ -1,6 +1,10 @@
 package mocks
 
-import "github.com/stretchr/testify/mock"
+import (
+	"time"
+
+	"github.com/stretchr/testify/mock"
+)
 
 // Mock the repository
 type MockIdempotencyStore struct {
@@ -12,13 +16,61 @@ func (m *MockIdempotencyStore) CreateNewIdempotencyKey() (string, error) {
 	return args.String(0), args.Error(1)
 }
 
+func (m *MockIdempotencyStore) RegisterIdempotencyKey(key string) (bool, error) {
+	args := m.Called(key)
+	return args.Bool(0), args.Error(1)
+}
+
 func (m *MockIdempotencyStore) CheckIdempotencyKeyStatus(key string) (string, error) {
 	args := m.Called(key)
 
 	return args.Get(0).(string), args.Error(1)
 }
 
-func (m *MockIdempotencyStore) UpdateIdempotencyKeyStatus(key string, status string) error {
-	args := m.Called(key, status)
+func (m *MockIdempotencyStore) UpdateIdempotencyKeyStatus(key string, lease string, status string) error {
+	args := m.Called(key, lease, status)
+	return args.Error(0)
+}
+
+func (m *MockIdempotencyStore) ClaimIdempotencyKey(key string, expected string) (string, bool, error) {
+	args := m.Called(key, expected)
+	return args.String(0), args.Bool(1), args.Error(2)
+}
+
+func (m *MockIdempotencyStore) RenewIdempotencyKeyLease(key string, lease string) (bool, error) {
+	args := m.Called(key, lease)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockIdempotencyStore) KeepIdempotencyKeyLease(key string, lease string) (stop func()) {
+	args := m.Called(key, lease)
+	return args.Get(0).(func())
+}
+
+func (m *MockIdempotencyStore) ExpireIdempotencyKeyLeases(now time.Time) (int, error) {
+	args := m.Called(now)
+	return args.Int(0), args.Error(1)
+}
+
+func (m *MockIdempotencyStore) CompleteIdempotencyKey(key string, lease string, statusCode int, body []byte) error {
+	args := m.Called(key, lease, statusCode, body)
 	return args.Error(0)
 }
+
+func (m *MockIdempotencyStore) FetchIdempotencyKeyResponse(key string) (int, []byte, error) {
+	args := m.Called(key)
+	if args.Get(1) == nil {
+		return args.Int(0), nil, args.Error(2)
+	}
+	return args.Int(0), args.Get(1).([]byte), args.Error(2)
+}
+
+func (m *MockIdempotencyStore) BindIdempotencyKeyFingerprint(key string, fingerprint string) (bool, error) {
+	args := m.Called(key, fingerprint)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockIdempotencyStore) SweepExpiredIdempotencyKeys(now time.Time) (int, error) {
+	args := m.Called(now)
+	return args.Int(0), args.Error(1)
+}
@@ -1,6 +1,8 @@
 package mocks
 
 import (
+	"time"
+
 	"github.com/midedickson/simple-banking-app/dto"
 	"github.com/midedickson/simple-banking-app/models"
 	"github.com/stretchr/testify/mock"
@@ -29,6 +31,19 @@ func (m *MockRepo) UpdateTransactionStatus(transaction *models.Transaction, stat
 	return args.Error(0)
 }
 
+func (m *MockRepo) SettleTransaction(transaction *models.Transaction) error {
+	args := m.Called(transaction)
+	return args.Error(0)
+}
+
+func (m *MockRepo) ApplyWebhookEvent(event *models.WebhookEvent) (*models.Transaction, error) {
+	args := m.Called(event)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.Transaction), args.Error(1)
+}
+
 func (m *MockRepo) FetchTransactionDetailsByReference(reference string) *models.Transaction {
 	args := m.Called(reference)
 	if args.Get(0) == nil {
@@ -41,3 +56,71 @@ func (m *MockRepo) GenerateTransactionReference() string {
 	args := m.Called()
 	return args.String(0)
 }
+
+func (m *MockRepo) FetchRecentTransactionsByAccountID(accountID int, limit int) ([]*models.Transaction, error) {
+	args := m.Called(accountID, limit)
+	return args.Get(0).([]*models.Transaction), args.Error(1)
+}
+
+func (m *MockRepo) FetchTransactionHistory(filter *dto.TransactionHistoryFilter) ([]*models.Transaction, error) {
+	args := m.Called(filter)
+	return args.Get(0).([]*models.Transaction), args.Error(1)
+}
+
+func (m *MockRepo) CreateTransfer(createTransferDTO *dto.CreateDBTransferDTO) (*dto.TransferDTO, error) {
+	args := m.Called(createTransferDTO)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*dto.TransferDTO), args.Error(1)
+}
+
+func (m *MockRepo) CreateReversal(createReversalDTO *dto.CreateDBReversalDTO) (*models.Transaction, error) {
+	args := m.Called(createReversalDTO)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.Transaction), args.Error(1)
+}
+
+func (m *MockRepo) AuthorizeHold(createHoldDTO *dto.CreateDBHoldDTO) (*dto.HoldDTO, error) {
+	args := m.Called(createHoldDTO)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*dto.HoldDTO), args.Error(1)
+}
+
+func (m *MockRepo) CaptureHold(captureHoldDTO *dto.CaptureDBHoldDTO) (*dto.HoldDTO, error) {
+	args := m.Called(captureHoldDTO)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*dto.HoldDTO), args.Error(1)
+}
+
+func (m *MockRepo) VoidHold(reference string, idempotencyKey string) (*dto.HoldDTO, error) {
+	args := m.Called(reference, idempotencyKey)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*dto.HoldDTO), args.Error(1)
+}
+
+func (m *MockRepo) ExpireHolds(now time.Time) (int, error) {
+	args := m.Called(now)
+	return args.Int(0), args.Error(1)
+}
+
+func (m *MockRepo) FetchHoldByReference(reference string) *models.Hold {
+	args := m.Called(reference)
+	if args.Get(0) == nil {
+		return nil
+	}
+	return args.Get(0).(*models.Hold)
+}
+
+func (m *MockRepo) FetchTransactionsByIdempotencyKey(key string) ([]*models.Transaction, error) {
+	args := m.Called(key)
+	return args.Get(0).([]*models.Transaction), args.Error(1)
+}
@@ -0,0 +1,155 @@
+package controllers_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/midedickson/simple-banking-app/controllers"
+	"github.com/midedickson/simple-banking-app/dto"
+	"github.com/midedickson/simple-banking-app/models"
+	"github.com/midedickson/simple-banking-app/tests/mocks"
+	"github.com/midedickson/simple-banking-app/utils"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestFetchUserAccountDetails(t *testing.T) {
+	mockRepo := new(mocks.MockRepo)
+	mockExternal := new(mocks.MockExternal)
+	mockIdempotencyStore := new(mocks.MockIdempotencyStore)
+	ctrl := controllers.NewController(mockRepo, mockExternal, mockIdempotencyStore, controllers.Options{})
+
+	handler := http.HandlerFunc(ctrl.FetchUserAccountDetails)
+
+	t.Run("account found", func(t *testing.T) {
+		account := &models.UserAccount{
+			ID:       123,
+			Balance:  decimal.NewFromFloat(1000.0),
+			Currency: "NGN",
+			Status:   "active",
+		}
+		transactions := []*models.Transaction{
+			{AccountID: 123, Reference: "TRX-1", Amount: decimal.NewFromInt(100), Direction: "credit", Status: "success"},
+		}
+		mockRepo.On("FindAccountById", 123).Return(account)
+		mockRepo.On("FetchRecentTransactionsByAccountID", 123, 5).Return(transactions, nil)
+
+		req, _ := http.NewRequest("GET", "/account/123?limit=5", nil)
+		req = mux.SetURLVars(req, map[string]string{"id": "123"})
+		rr := httptest.NewRecorder()
+
+		handler.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Contains(t, rr.Body.String(), `"available_balance":"1000"`)
+		assert.Contains(t, rr.Body.String(), `"reference":"TRX-1"`)
+		mockRepo.AssertExpectations(t)
+	})
+
+	t.Run("account not found", func(t *testing.T) {
+		mockRepo.On("FindAccountById", 999).Return(nil)
+
+		req, _ := http.NewRequest("GET", "/account/999", nil)
+		req = mux.SetURLVars(req, map[string]string{"id": "999"})
+		rr := httptest.NewRecorder()
+
+		handler.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+		mockRepo.AssertExpectations(t)
+	})
+
+	t.Run("invalid account ID", func(t *testing.T) {
+		req, _ := http.NewRequest("GET", "/account/abc", nil)
+		req = mux.SetURLVars(req, map[string]string{"id": "abc"})
+		rr := httptest.NewRecorder()
+
+		handler.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+}
+
+func TestFetchAccountTransactions(t *testing.T) {
+	mockRepo := new(mocks.MockRepo)
+	ctrl := controllers.NewController(mockRepo, new(mocks.MockExternal), new(mocks.MockIdempotencyStore), controllers.Options{})
+	handler := http.HandlerFunc(ctrl.FetchAccountTransactions)
+	mockRepo.On("FindAccountById", 123).Return(&models.UserAccount{ID: 123, Currency: "NGN"})
+	mockRepo.On("FindAccountById", 999).Return(nil)
+	createdAt := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	fetch := func(accountID string, query string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("GET", "/account/"+accountID+"/transactions?"+query, nil)
+		req = mux.SetURLVars(req, map[string]string{"id": accountID})
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	t.Run("a full page links to the next one", func(t *testing.T) {
+		transactions := []*models.Transaction{
+			{ID: 3, CreatedAt: createdAt, AccountID: 123, Reference: "TRX-3"},
+			{ID: 2, CreatedAt: createdAt, AccountID: 123, Reference: "TRX-2"},
+			{ID: 1, CreatedAt: createdAt, AccountID: 123, Reference: "TRX-1"},
+		}
+		minAmount := decimal.NewFromInt(10)
+		mockRepo.On("FetchTransactionHistory", mock.MatchedBy(func(f *dto.TransactionHistoryFilter) bool {
+			return f.AccountID == 123 && f.Limit == 3 && f.Direction == "debit" && f.Status == "success" &&
+				f.MinAmount.Equal(minAmount) && f.MaxAmount == nil && f.Ascending && f.After == nil
+		})).Return(transactions, nil)
+
+		rr := fetch("123", "limit=2&direction=debit&status=success&min_amount=10&order=asc")
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		var response struct {
+			Data dto.TransactionPageDTO `json:"data"`
+		}
+		assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+		assert.Len(t, response.Data.Transactions, 2)
+		cursor, err := utils.DecodeTransactionCursor(response.Data.NextCursor)
+		assert.NoError(t, err)
+		assert.Equal(t, uint(2), cursor.ID)
+		assert.True(t, cursor.CreatedAt.Equal(createdAt))
+	})
+
+	t.Run("the last page has no cursor", func(t *testing.T) {
+		cursor := utils.EncodeTransactionCursor(dto.TransactionCursor{CreatedAt: createdAt, ID: 2})
+		mockRepo.On("FetchTransactionHistory", mock.MatchedBy(func(f *dto.TransactionHistoryFilter) bool {
+			return f.AccountID == 123 && f.Limit == 21 && f.After != nil && f.After.ID == 2
+		})).Return([]*models.Transaction{{ID: 1, CreatedAt: createdAt, AccountID: 123, Reference: "TRX-1"}}, nil)
+
+		rr := fetch("123", "cursor="+cursor)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.NotContains(t, rr.Body.String(), "next_cursor")
+	})
+
+	t.Run("invalid filters", func(t *testing.T) {
+		for _, query := range []string{
+			"direction=sideways",
+			"status=done",
+			"from=yesterday",
+			"from=2024-06-02T00:00:00Z&to=2024-06-01T00:00:00Z",
+			"min_amount=-1",
+			"min_amount=50&max_amount=10",
+			"order=random",
+			"limit=0",
+			"cursor=not-a-cursor",
+		} {
+			rr := fetch("123", query)
+
+			assert.Equal(t, http.StatusBadRequest, rr.Code, query)
+		}
+	})
+
+	t.Run("account not found", func(t *testing.T) {
+		rr := fetch("999", "")
+
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+	})
+}
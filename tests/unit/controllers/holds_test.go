@@ -0,0 +1,119 @@
+package controllers_test
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/midedickson/simple-banking-app/constants"
+	"github.com/midedickson/simple-banking-app/controllers"
+	"github.com/midedickson/simple-banking-app/dto"
+	"github.com/midedickson/simple-banking-app/external"
+	"github.com/midedickson/simple-banking-app/models"
+	"github.com/midedickson/simple-banking-app/tests/mocks"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestHolds(t *testing.T) {
+	mockRepo := new(mocks.MockRepo)
+	mockExternal := new(mocks.MockExternal)
+	mockIdempotencyStore := new(mocks.MockIdempotencyStore)
+	mockIdempotencyStore.On("KeepIdempotencyKeyLease", mock.Anything, "test-lease").Return(func() {}).Maybe()
+	ctrl := controllers.NewController(mockRepo, mockExternal, mockIdempotencyStore, controllers.Options{HoldTTL: time.Hour})
+	mockIdempotencyStore.On("RegisterIdempotencyKey", mock.Anything).Return(false, nil)
+	mockIdempotencyStore.On("BindIdempotencyKeyFingerprint", mock.Anything, mock.Anything).Return(true, nil)
+	mockExternal.On("CircuitBreakerState").Return(external.CircuitBreakerState{State: external.CircuitClosed}).Maybe()
+	mockRepo.On("FindAccountById", 1).Return(&models.UserAccount{ID: 1, Balance: decimal.NewFromInt(400), Currency: "NGN"})
+	hold := &models.Hold{Reference: "HLD-1", AccountID: 1, Amount: decimal.NewFromInt(150), Currency: "NGN", Status: constants.HoldActive}
+	mockRepo.On("FetchHoldByReference", "HLD-1").Return(hold)
+	mockRepo.On("FetchHoldByReference", "HLD-unknown").Return(nil)
+
+	send := func(handler http.HandlerFunc, path string, reference string, key string, body string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("POST", path, bytes.NewBufferString(body))
+		req = mux.SetURLVars(req, map[string]string{"reference": reference})
+		req.Header.Set("X-Idempotency-Key", key)
+		mockIdempotencyStore.On("CheckIdempotencyKeyStatus", key).Return(constants.WAITING, nil)
+		mockIdempotencyStore.On("ClaimIdempotencyKey", key, constants.WAITING).Return("test-lease", true, nil)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	t.Run("placing a hold", func(t *testing.T) {
+		held := &dto.HoldDTO{Hold: hold, Transaction: &models.Transaction{Direction: constants.DirectionAuthorization, HoldReference: "HLD-1"}}
+		mockRepo.On("AuthorizeHold", mock.MatchedBy(func(d *dto.CreateDBHoldDTO) bool {
+			return d.AccountID == 1 && d.Amount.Equal(decimal.NewFromInt(150)) && d.Currency == "NGN" && d.IdempotencyKey == "hold-key" &&
+				d.ExpiresAt.After(time.Now().Add(59*time.Minute))
+		})).Return(held, nil)
+		mockIdempotencyStore.On("CompleteIdempotencyKey", "hold-key", "test-lease", http.StatusOK, mock.Anything).Return(nil)
+
+		rr := send(ctrl.CreateHold, "/hold", "", "hold-key", `{"account_id": 1, "amount": 150}`)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Contains(t, rr.Body.String(), `"hold_reference":"HLD-1"`)
+	})
+
+	t.Run("a hold larger than the available balance", func(t *testing.T) {
+		mockRepo.On("AuthorizeHold", mock.MatchedBy(func(d *dto.CreateDBHoldDTO) bool { return d.IdempotencyKey == "large-hold-key" })).Return(nil, constants.ErrInsufficientFunds)
+		mockIdempotencyStore.On("UpdateIdempotencyKeyStatus", "large-hold-key", "test-lease", constants.FAILED).Return(nil)
+
+		rr := send(ctrl.CreateHold, "/hold", "", "large-hold-key", `{"account_id": 1, "amount": 500}`)
+
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+		mockIdempotencyStore.AssertExpectations(t)
+	})
+
+	t.Run("partial capture", func(t *testing.T) {
+		amount := decimal.NewFromInt(100)
+		captured := &dto.HoldDTO{Hold: hold, Transaction: &models.Transaction{Direction: constants.DirectionDebit, Amount: amount, Status: "pending"}}
+		mockRepo.On("CaptureHold", &dto.CaptureDBHoldDTO{Reference: "HLD-1", Amount: &amount, IdempotencyKey: "capture-key"}).Return(captured, nil)
+		mockIdempotencyStore.On("CompleteIdempotencyKey", "capture-key", "test-lease", http.StatusAccepted, mock.Anything).Return(nil)
+
+		rr := send(ctrl.CaptureHold, "/hold/HLD-1/capture", "HLD-1", "capture-key", `{"amount": 100}`)
+
+		assert.Equal(t, http.StatusAccepted, rr.Code)
+	})
+
+	t.Run("capture larger than the hold", func(t *testing.T) {
+		amount := decimal.NewFromInt(200)
+		mockRepo.On("CaptureHold", &dto.CaptureDBHoldDTO{Reference: "HLD-1", Amount: &amount, IdempotencyKey: "excess-capture-key"}).Return(nil, constants.ErrCaptureExceedsHold)
+		mockIdempotencyStore.On("UpdateIdempotencyKeyStatus", "excess-capture-key", "test-lease", constants.FAILED).Return(nil)
+
+		rr := send(ctrl.CaptureHold, "/hold/HLD-1/capture", "HLD-1", "excess-capture-key", `{"amount": 200}`)
+
+		assert.Equal(t, http.StatusUnprocessableEntity, rr.Code)
+	})
+
+	t.Run("capturing an unknown hold", func(t *testing.T) {
+		mockIdempotencyStore.On("UpdateIdempotencyKeyStatus", "unknown-capture-key", "test-lease", constants.FAILED).Return(nil)
+
+		rr := send(ctrl.CaptureHold, "/hold/HLD-unknown/capture", "HLD-unknown", "unknown-capture-key", "")
+
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+	})
+
+	t.Run("voiding a hold that is no longer active", func(t *testing.T) {
+		mockRepo.On("VoidHold", "HLD-1", "void-key").Return(nil, constants.ErrHoldNotActive)
+		mockIdempotencyStore.On("UpdateIdempotencyKeyStatus", "void-key", "test-lease", constants.FAILED).Return(nil)
+
+		rr := send(ctrl.VoidHold, "/hold/HLD-1/void", "HLD-1", "void-key", "")
+
+		assert.Equal(t, http.StatusConflict, rr.Code)
+		mockIdempotencyStore.AssertExpectations(t)
+	})
+
+	t.Run("fetching a hold", func(t *testing.T) {
+		req, _ := http.NewRequest("GET", "/hold/HLD-unknown", nil)
+		req = mux.SetURLVars(req, map[string]string{"reference": "HLD-unknown"})
+		rr := httptest.NewRecorder()
+
+		http.HandlerFunc(ctrl.FetchHold).ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+	})
+}
@@ -0,0 +1,80 @@
+package controllers_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/midedickson/simple-banking-app/controllers"
+	"github.com/midedickson/simple-banking-app/dto"
+	"github.com/midedickson/simple-banking-app/models"
+	"github.com/midedickson/simple-banking-app/reconciliation"
+	"github.com/midedickson/simple-banking-app/tests/mocks"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func TestReconciliationReports(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(fmt.Sprintf("file:%s?mode=memory&cache=shared", t.Name())), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&models.Transaction{}, &models.ReconciliationReport{}, &models.ReconciliationItem{}); err != nil {
+		t.Fatal(err)
+	}
+	mockExternal := new(mocks.MockExternal)
+	ctrl := controllers.NewController(new(mocks.MockRepo), mockExternal, new(mocks.MockIdempotencyStore), controllers.Options{Reconciler: reconciliation.NewEngine(db, mockExternal)})
+	from, to := time.Now().Add(-time.Hour), time.Now().Add(time.Hour)
+
+	t.Run("imported records are reconciled and the report can be fetched", func(t *testing.T) {
+		body, _ := json.Marshal(dto.CreateReconciliationDTO{From: from, To: to, Records: []*dto.ForwardTransactionDTO{
+			{Reference: "TRX-partner-only", AccountID: 1, Amount: decimal.NewFromInt(60), Currency: "NGN"},
+		}})
+		req, _ := http.NewRequest("POST", "/reconciliation", bytes.NewBuffer(body))
+		rr := httptest.NewRecorder()
+
+		http.HandlerFunc(ctrl.CreateReconciliationReport).ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Contains(t, rr.Body.String(), `"missing_local":1`)
+
+		req, _ = http.NewRequest("GET", "/reconciliation/1", nil)
+		req = mux.SetURLVars(req, map[string]string{"id": "1"})
+		rr = httptest.NewRecorder()
+
+		http.HandlerFunc(ctrl.FetchReconciliationReport).ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Contains(t, rr.Body.String(), "TRX-partner-only")
+	})
+
+	t.Run("window must end after it starts", func(t *testing.T) {
+		body, _ := json.Marshal(dto.CreateReconciliationDTO{From: to, To: from})
+		req, _ := http.NewRequest("POST", "/reconciliation", bytes.NewBuffer(body))
+		rr := httptest.NewRecorder()
+
+		http.HandlerFunc(ctrl.CreateReconciliationReport).ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+
+	t.Run("report not found", func(t *testing.T) {
+		req, _ := http.NewRequest("GET", "/reconciliation/99", nil)
+		req = mux.SetURLVars(req, map[string]string{"id": "99"})
+		rr := httptest.NewRecorder()
+
+		http.HandlerFunc(ctrl.FetchReconciliationReport).ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+	})
+}
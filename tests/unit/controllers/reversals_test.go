@@ -0,0 +1,118 @@
+package controllers_test
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/midedickson/simple-banking-app/constants"
+	"github.com/midedickson/simple-banking-app/controllers"
+	"github.com/midedickson/simple-banking-app/dto"
+	"github.com/midedickson/simple-banking-app/external"
+	"github.com/midedickson/simple-banking-app/models"
+	"github.com/midedickson/simple-banking-app/tests/mocks"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestReverseTransaction(t *testing.T) {
+	mockRepo := new(mocks.MockRepo)
+	mockExternal := new(mocks.MockExternal)
+	mockIdempotencyStore := new(mocks.MockIdempotencyStore)
+	mockIdempotencyStore.On("KeepIdempotencyKeyLease", mock.Anything, "test-lease").Return(func() {}).Maybe()
+	ctrl := controllers.NewController(mockRepo, mockExternal, mockIdempotencyStore, controllers.Options{})
+	handler := http.HandlerFunc(ctrl.ReverseTransaction)
+	mockIdempotencyStore.On("RegisterIdempotencyKey", mock.Anything).Return(false, nil)
+	mockIdempotencyStore.On("BindIdempotencyKeyFingerprint", mock.Anything, mock.Anything).Return(true, nil)
+	mockRepo.On("FetchTransactionDetailsByReference", "TRX-debit").Return(&models.Transaction{Reference: "TRX-debit", Amount: decimal.NewFromInt(100), Currency: "NGN", Direction: constants.DirectionDebit, Status: constants.SUCCESS})
+	mockRepo.On("FetchTransactionDetailsByReference", "TRX-unknown").Return(nil)
+	circuitState := mockExternal.On("CircuitBreakerState").Return(external.CircuitBreakerState{State: external.CircuitClosed})
+
+	reverse := func(reference string, key string, body string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("POST", "/transaction/"+reference+"/reverse", bytes.NewBufferString(body))
+		req = mux.SetURLVars(req, map[string]string{"reference": reference})
+		req.Header.Set("X-Idempotency-Key", key)
+		mockIdempotencyStore.On("CheckIdempotencyKeyStatus", key).Return(constants.WAITING, nil)
+		mockIdempotencyStore.On("ClaimIdempotencyKey", key, constants.WAITING).Return("test-lease", true, nil)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	t.Run("partial refund creates a linked reversal", func(t *testing.T) {
+		amount := decimal.RequireFromString("40.50")
+		reversal := &models.Transaction{Reference: "TRX-reversal", ReversalOf: "TRX-debit", Amount: amount, Direction: constants.DirectionCredit, Status: "pending"}
+		mockRepo.On("CreateReversal", &dto.CreateDBReversalDTO{Reference: "TRX-debit", Amount: &amount, IdempotencyKey: "partial-key"}).Return(reversal, nil)
+		mockIdempotencyStore.On("CompleteIdempotencyKey", "partial-key", "test-lease", http.StatusAccepted, mock.Anything).Return(nil)
+
+		rr := reverse("TRX-debit", "partial-key", `{"amount": "40.50"}`)
+
+		assert.Equal(t, http.StatusAccepted, rr.Code)
+		assert.Contains(t, rr.Body.String(), `"reversal_of":"TRX-debit"`)
+		mockIdempotencyStore.AssertExpectations(t)
+	})
+
+	t.Run("an empty body reverses the rest", func(t *testing.T) {
+		reversal := &models.Transaction{Reference: "TRX-rest", ReversalOf: "TRX-debit", Amount: decimal.RequireFromString("59.50"), Status: "pending"}
+		mockRepo.On("CreateReversal", &dto.CreateDBReversalDTO{Reference: "TRX-debit", IdempotencyKey: "full-key"}).Return(reversal, nil)
+		mockIdempotencyStore.On("CompleteIdempotencyKey", "full-key", "test-lease", http.StatusAccepted, mock.Anything).Return(nil)
+
+		rr := reverse("TRX-debit", "full-key", "")
+
+		assert.Equal(t, http.StatusAccepted, rr.Code)
+	})
+
+	t.Run("refunding more than is left", func(t *testing.T) {
+		amount := decimal.NewFromInt(80)
+		mockRepo.On("CreateReversal", &dto.CreateDBReversalDTO{Reference: "TRX-debit", Amount: &amount, IdempotencyKey: "excess-key"}).Return(nil, constants.ErrReversalExceedsAmount)
+		mockIdempotencyStore.On("UpdateIdempotencyKeyStatus", "excess-key", "test-lease", constants.FAILED).Return(nil)
+
+		rr := reverse("TRX-debit", "excess-key", `{"amount": 80}`)
+
+		assert.Equal(t, http.StatusUnprocessableEntity, rr.Code)
+		mockIdempotencyStore.AssertExpectations(t)
+	})
+
+	t.Run("amount with too many decimal places", func(t *testing.T) {
+		mockIdempotencyStore.On("UpdateIdempotencyKeyStatus", "precision-key", "test-lease", constants.FAILED).Return(nil)
+
+		rr := reverse("TRX-debit", "precision-key", `{"amount": "10.001"}`)
+
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+		mockRepo.AssertNotCalled(t, "CreateReversal", mock.MatchedBy(func(d *dto.CreateDBReversalDTO) bool { return d.IdempotencyKey == "precision-key" }))
+	})
+
+	t.Run("unknown transaction", func(t *testing.T) {
+		mockIdempotencyStore.On("UpdateIdempotencyKeyStatus", "unknown-key", "test-lease", constants.FAILED).Return(nil)
+
+		rr := reverse("TRX-unknown", "unknown-key", "")
+
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+	})
+
+	t.Run("transaction that cannot be reversed", func(t *testing.T) {
+		mockRepo.On("CreateReversal", &dto.CreateDBReversalDTO{Reference: "TRX-debit", IdempotencyKey: "pending-key"}).Return(nil, constants.ErrTransactionNotReversible)
+		mockIdempotencyStore.On("UpdateIdempotencyKeyStatus", "pending-key", "test-lease", constants.FAILED).Return(nil)
+
+		rr := reverse("TRX-debit", "pending-key", "")
+
+		assert.Equal(t, http.StatusConflict, rr.Code)
+	})
+
+	t.Run("third party unavailable leaves the key retryable", func(t *testing.T) {
+		retryAt := time.Now().Add(30 * time.Second)
+		circuitState.Unset()
+		mockExternal.On("CircuitBreakerState").Return(external.CircuitBreakerState{State: external.CircuitOpen, RetryAt: &retryAt})
+		mockIdempotencyStore.On("UpdateIdempotencyKeyStatus", "open-key", "test-lease", constants.CAN_RETRY).Return(nil)
+
+		rr := reverse("TRX-debit", "open-key", "")
+
+		assert.Equal(t, http.StatusServiceUnavailable, rr.Code)
+		mockRepo.AssertNotCalled(t, "CreateReversal", mock.MatchedBy(func(d *dto.CreateDBReversalDTO) bool { return d.IdempotencyKey == "open-key" }))
+		mockIdempotencyStore.AssertExpectations(t)
+	})
+}
@@ -0,0 +1,99 @@
+package controllers_test
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/midedickson/simple-banking-app/controllers"
+	"github.com/midedickson/simple-banking-app/models"
+	"github.com/midedickson/simple-banking-app/settlement"
+	"github.com/midedickson/simple-banking-app/tests/mocks"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func TestSettlementImports(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(fmt.Sprintf("file:%s?mode=memory&cache=shared", t.Name())), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&models.Transaction{}, &models.SettlementImport{}, &models.SettlementEntry{}, &models.SuspenseItem{}); err != nil {
+		t.Fatal(err)
+	}
+	ctrl := controllers.NewController(new(mocks.MockRepo), new(mocks.MockExternal), new(mocks.MockIdempotencyStore), controllers.Options{SettlementImporter: settlement.NewImporter(db)})
+	statement := "reference,amount,currency\nTRX-partner-only,60,NGN\n"
+
+	t.Run("an unmatched entry is queued in suspense and can be resolved", func(t *testing.T) {
+		req, _ := http.NewRequest("POST", "/settlement/imports?filename=eod.csv", bytes.NewBufferString(statement))
+		req.Header.Set("Content-Type", "text/csv")
+		rr := httptest.NewRecorder()
+
+		http.HandlerFunc(ctrl.CreateSettlementImport).ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Contains(t, rr.Body.String(), `"suspended":1`)
+
+		req, _ = http.NewRequest("GET", "/settlement/suspense?status=open", nil)
+		rr = httptest.NewRecorder()
+
+		http.HandlerFunc(ctrl.FetchSuspenseItems).ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Contains(t, rr.Body.String(), `"reason":"unknown_reference"`)
+
+		req, _ = http.NewRequest("POST", "/settlement/suspense/1/resolve", bytes.NewBufferString(`{"note":"booked manually"}`))
+		req = mux.SetURLVars(req, map[string]string{"id": "1"})
+		rr = httptest.NewRecorder()
+
+		http.HandlerFunc(ctrl.ResolveSuspenseItem).ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Contains(t, rr.Body.String(), `"status":"resolved"`)
+	})
+
+	t.Run("the same file is refused a second time", func(t *testing.T) {
+		req, _ := http.NewRequest("POST", "/settlement/imports?format=csv", bytes.NewBufferString(statement))
+		rr := httptest.NewRecorder()
+
+		http.HandlerFunc(ctrl.CreateSettlementImport).ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusConflict, rr.Code)
+	})
+
+	t.Run("format must be known", func(t *testing.T) {
+		req, _ := http.NewRequest("POST", "/settlement/imports", bytes.NewBufferString(statement))
+		rr := httptest.NewRecorder()
+
+		http.HandlerFunc(ctrl.CreateSettlementImport).ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+
+	t.Run("a file that cannot be parsed is stored as failed", func(t *testing.T) {
+		req, _ := http.NewRequest("POST", "/settlement/imports?format=camt053", bytes.NewBufferString("<Document>"))
+		rr := httptest.NewRecorder()
+
+		http.HandlerFunc(ctrl.CreateSettlementImport).ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusUnprocessableEntity, rr.Code)
+		assert.Contains(t, rr.Body.String(), `"status":"failed"`)
+	})
+
+	t.Run("import not found", func(t *testing.T) {
+		req, _ := http.NewRequest("POST", "/settlement/imports/99/rerun", nil)
+		req = mux.SetURLVars(req, map[string]string{"id": "99"})
+		rr := httptest.NewRecorder()
+
+		http.HandlerFunc(ctrl.RerunSettlementImport).ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+	})
+}
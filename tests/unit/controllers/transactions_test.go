@@ -7,51 +7,83 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
+	"github.com/gorilla/mux"
 	"github.com/midedickson/simple-banking-app/constants"
 	"github.com/midedickson/simple-banking-app/controllers"
 	"github.com/midedickson/simple-banking-app/dto"
+	"github.com/midedickson/simple-banking-app/external"
 	"github.com/midedickson/simple-banking-app/models"
 	"github.com/midedickson/simple-banking-app/tests/mocks"
 	"github.com/shopspring/decimal"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
 )
 
 func TestCreateDebitTransaction(t *testing.T) {
 	mockRepo := new(mocks.MockRepo)
 	mockExternal := new(mocks.MockExternal)
 	mockIdempotencyStore := new(mocks.MockIdempotencyStore)
-	ctrl := controllers.NewController(mockRepo, mockExternal, mockIdempotencyStore)
+	mockIdempotencyStore.On("KeepIdempotencyKeyLease", mock.Anything, "test-lease").Return(func() {}).Maybe()
+	ctrl := controllers.NewController(mockRepo, mockExternal, mockIdempotencyStore, controllers.Options{})
 	handler := http.HandlerFunc(ctrl.CreateDebitTransaction)
+	mockIdempotencyStore.On("RegisterIdempotencyKey", mock.Anything).Return(false, nil)
+	mockExternal.On("CircuitBreakerState").Return(external.CircuitBreakerState{State: external.CircuitClosed}).Maybe()
+
+	t.Run("malformed idempotency key", func(t *testing.T) {
+		body, _ := json.Marshal(dto.CreateTransactionDTO{AccountID: 123, Amount: decimal.NewFromInt(100)})
+		req, _ := http.NewRequest("POST", "/transactions/debit", bytes.NewBuffer(body))
+		req.Header.Set("X-Idempotency-Key", "not a key!")
+		rr := httptest.NewRecorder()
+
+		handler.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusUnprocessableEntity, rr.Code)
+		mockIdempotencyStore.AssertNotCalled(t, "RegisterIdempotencyKey", "not a key!")
+	})
+
+	t.Run("missing idempotency key", func(t *testing.T) {
+		body, _ := json.Marshal(dto.CreateTransactionDTO{AccountID: 123, Amount: decimal.NewFromInt(100)})
+		req, _ := http.NewRequest("POST", "/transactions/debit", bytes.NewBuffer(body))
+		rr := httptest.NewRecorder()
+
+		handler.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+		mockIdempotencyStore.AssertNotCalled(t, "RegisterIdempotencyKey", "")
+	})
 
 	t.Run("successful debit transaction", func(t *testing.T) {
 		transactionDTO := dto.CreateTransactionDTO{
 			AccountID: 123,
-			Amount:    100.0,
+			Amount:    decimal.NewFromInt(100),
 		}
 		account := &models.UserAccount{
-			ID:      123,
-			Balance: decimal.NewFromFloat(1000.0),
+			ID:       123,
+			Balance:  decimal.NewFromFloat(1000.0),
+			Currency: "NGN",
 		}
 		createDBTransactionDTO := dto.CreateDBTransactionDTO{
-			AccountID: transactionDTO.AccountID,
-			Amount:    transactionDTO.Amount,
-			Direction: "debit",
+			AccountID:      transactionDTO.AccountID,
+			Amount:         transactionDTO.Amount,
+			Direction:      "debit",
+			Currency:       "NGN",
+			IdempotencyKey: "12345",
 		}
 		transaction := &models.Transaction{
 			AccountID: 123,
-			Amount:    100.0,
+			Amount:    decimal.NewFromInt(100),
 			Direction: "debit",
 			Status:    "pending",
 		}
 
 		mockIdempotencyStore.On("CheckIdempotencyKeyStatus", "12345").Return(constants.WAITING, nil)
-		mockIdempotencyStore.On("UpdateIdempotencyKeyStatus", "12345", constants.PROCESSING).Return(nil)
+		mockIdempotencyStore.On("BindIdempotencyKeyFingerprint", "12345", mock.Anything).Return(true, nil)
+		mockIdempotencyStore.On("ClaimIdempotencyKey", "12345", constants.WAITING).Return("test-lease", true, nil)
 		mockRepo.On("FindAccountById", 123).Return(account)
 		mockRepo.On("CreateTransaction", &createDBTransactionDTO).Return(transaction, nil)
-		mockExternal.On("ForwardTransactionToThirdParty", transaction).Return(nil)
-		mockRepo.On("UpdateTransactionStatus", transaction, "success").Return(nil)
-		mockIdempotencyStore.On("UpdateIdempotencyKeyStatus", "12345", constants.SUCCESS).Return(nil)
+		mockIdempotencyStore.On("CompleteIdempotencyKey", "12345", "test-lease", http.StatusAccepted, mock.Anything).Return(nil)
 
 		body, _ := json.Marshal(transactionDTO)
 		req, _ := http.NewRequest("POST", "/transactions/debit", bytes.NewBuffer(body))
@@ -60,51 +92,33 @@ func TestCreateDebitTransaction(t *testing.T) {
 
 		handler.ServeHTTP(rr, req)
 
-		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, http.StatusAccepted, rr.Code)
 		mockRepo.AssertExpectations(t)
 		mockExternal.AssertExpectations(t)
 		mockIdempotencyStore.AssertExpectations(t)
 	})
 
-	t.Run("forward debit transaction error", func(t *testing.T) {
+	t.Run("debit larger than the available balance", func(t *testing.T) {
 		transactionDTO := dto.CreateTransactionDTO{
-			AccountID: 124,
-			Amount:    100.0,
-		}
-		account := &models.UserAccount{
-			ID:      124,
-			Balance: decimal.NewFromFloat(1000.0),
+			AccountID: 127,
+			Amount:    decimal.NewFromInt(500),
 		}
-		createDBTransactionDTO := dto.CreateDBTransactionDTO{
-			AccountID: transactionDTO.AccountID,
-			Amount:    transactionDTO.Amount,
-			Direction: "debit",
-		}
-		transaction := &models.Transaction{
-			AccountID: createDBTransactionDTO.AccountID,
-			Amount:    createDBTransactionDTO.Amount,
-			Direction: "debit",
-			Status:    "pending",
-		}
-		mockIdempotencyStore.On("CheckIdempotencyKeyStatus", "12345").Return(constants.WAITING, nil)
-		mockIdempotencyStore.On("UpdateIdempotencyKeyStatus", "12345", constants.PROCESSING).Return(nil)
-
-		mockRepo.On("FindAccountById", 124).Return(account)
-		mockRepo.On("CreateTransaction", &createDBTransactionDTO).Return(transaction, nil)
-		mockExternal.On("ForwardTransactionToThirdParty", transaction).Return(constants.ErrThirdPartyFailure)
-		mockRepo.On("UpdateTransactionStatus", transaction, "failed").Return(nil).Once()
-		mockIdempotencyStore.On("UpdateIdempotencyKeyStatus", "12345", constants.FAILED).Return(nil)
+		mockIdempotencyStore.On("CheckIdempotencyKeyStatus", "overdraft-key").Return(constants.WAITING, nil)
+		mockIdempotencyStore.On("BindIdempotencyKeyFingerprint", "overdraft-key", mock.Anything).Return(true, nil)
+		mockIdempotencyStore.On("ClaimIdempotencyKey", "overdraft-key", constants.WAITING).Return("test-lease", true, nil)
+		mockRepo.On("FindAccountById", 127).Return(&models.UserAccount{ID: 127, Balance: decimal.NewFromInt(400), Currency: "NGN"})
+		mockRepo.On("CreateTransaction", mock.MatchedBy(func(d *dto.CreateDBTransactionDTO) bool { return d.AccountID == 127 })).Return((*models.Transaction)(nil), constants.ErrInsufficientFunds)
+		mockIdempotencyStore.On("UpdateIdempotencyKeyStatus", "overdraft-key", "test-lease", constants.FAILED).Return(nil)
 
 		body, _ := json.Marshal(transactionDTO)
 		req, _ := http.NewRequest("POST", "/transactions/debit", bytes.NewBuffer(body))
-		req.Header.Set("X-Idempotency-Key", "12345")
+		req.Header.Set("X-Idempotency-Key", "overdraft-key")
 		rr := httptest.NewRecorder()
 
 		handler.ServeHTTP(rr, req)
 
-		assert.Equal(t, http.StatusInternalServerError, rr.Code)
-		mockRepo.AssertExpectations(t)
-		mockExternal.AssertExpectations(t)
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+		assert.Contains(t, rr.Body.String(), "Insufficient funds")
 		mockIdempotencyStore.AssertExpectations(t)
 	})
 
@@ -112,16 +126,19 @@ func TestCreateDebitTransaction(t *testing.T) {
 
 		transactionDTO := dto.CreateTransactionDTO{
 			AccountID: 125,
-			Amount:    100.0,
+			Amount:    decimal.NewFromInt(100),
 		}
 		account := &models.UserAccount{
-			ID:      125,
-			Balance: decimal.NewFromFloat(1000.0),
+			ID:       125,
+			Balance:  decimal.NewFromFloat(1000.0),
+			Currency: "NGN",
 		}
 		createDBTransactionDTO := &dto.CreateDBTransactionDTO{
-			AccountID: transactionDTO.AccountID,
-			Amount:    transactionDTO.Amount,
-			Direction: "debit",
+			AccountID:      transactionDTO.AccountID,
+			Amount:         transactionDTO.Amount,
+			Direction:      "debit",
+			Currency:       "NGN",
+			IdempotencyKey: "12345",
 		}
 		transaction := &models.Transaction{
 			AccountID: createDBTransactionDTO.AccountID,
@@ -130,11 +147,12 @@ func TestCreateDebitTransaction(t *testing.T) {
 			Status:    "pending",
 		}
 		mockIdempotencyStore.On("CheckIdempotencyKeyStatus", "12345").Return(constants.WAITING, nil)
-		mockIdempotencyStore.On("UpdateIdempotencyKeyStatus", "12345", constants.PROCESSING).Return(nil)
+		mockIdempotencyStore.On("BindIdempotencyKeyFingerprint", "12345", mock.Anything).Return(true, nil)
+		mockIdempotencyStore.On("ClaimIdempotencyKey", "12345", constants.WAITING).Return("test-lease", true, nil)
 
 		mockRepo.On("FindAccountById", 125).Return(account)
 		mockRepo.On("CreateTransaction", createDBTransactionDTO).Return(transaction, errors.New("error creating transaction in DB"))
-		mockIdempotencyStore.On("UpdateIdempotencyKeyStatus", "12345", constants.FAILED).Return(nil)
+		mockIdempotencyStore.On("UpdateIdempotencyKeyStatus", "12345", "test-lease", constants.CAN_RETRY).Return(nil)
 
 		body, _ := json.Marshal(transactionDTO)
 		req, _ := http.NewRequest("POST", "/transactions/debit", bytes.NewBuffer(body))
@@ -153,23 +171,29 @@ func TestCreateCreditTransaction(t *testing.T) {
 	mockRepo := new(mocks.MockRepo)
 	mockExternal := new(mocks.MockExternal)
 	mockIdempotencyStore := new(mocks.MockIdempotencyStore)
-	ctrl := controllers.NewController(mockRepo, mockExternal, mockIdempotencyStore)
+	mockIdempotencyStore.On("KeepIdempotencyKeyLease", mock.Anything, "test-lease").Return(func() {}).Maybe()
+	ctrl := controllers.NewController(mockRepo, mockExternal, mockIdempotencyStore, controllers.Options{})
 
 	handler := http.HandlerFunc(ctrl.CreateCreditTransaction)
+	mockIdempotencyStore.On("RegisterIdempotencyKey", mock.Anything).Return(false, nil)
+	mockExternal.On("CircuitBreakerState").Return(external.CircuitBreakerState{State: external.CircuitClosed}).Maybe()
 
 	t.Run("successful credit transaction", func(t *testing.T) {
 		transactionDTO := dto.CreateTransactionDTO{
 			AccountID: 123,
-			Amount:    100.0,
+			Amount:    decimal.NewFromInt(100),
 		}
 		account := &models.UserAccount{
-			ID:      123,
-			Balance: decimal.NewFromFloat(1000.0),
+			ID:       123,
+			Balance:  decimal.NewFromFloat(1000.0),
+			Currency: "NGN",
 		}
 		createDBTransactionDTO := dto.CreateDBTransactionDTO{
-			AccountID: transactionDTO.AccountID,
-			Amount:    transactionDTO.Amount,
-			Direction: "credit",
+			AccountID:      transactionDTO.AccountID,
+			Amount:         transactionDTO.Amount,
+			Direction:      "credit",
+			Currency:       "NGN",
+			IdempotencyKey: "12345",
 		}
 		transaction := &models.Transaction{
 			AccountID: createDBTransactionDTO.AccountID,
@@ -178,13 +202,12 @@ func TestCreateCreditTransaction(t *testing.T) {
 			Status:    "pending",
 		}
 		mockIdempotencyStore.On("CheckIdempotencyKeyStatus", "12345").Return(constants.WAITING, nil)
-		mockIdempotencyStore.On("UpdateIdempotencyKeyStatus", "12345", constants.PROCESSING).Return(nil)
+		mockIdempotencyStore.On("BindIdempotencyKeyFingerprint", "12345", mock.Anything).Return(true, nil)
+		mockIdempotencyStore.On("ClaimIdempotencyKey", "12345", constants.WAITING).Return("test-lease", true, nil)
 
 		mockRepo.On("FindAccountById", 123).Return(account).Once()
 		mockRepo.On("CreateTransaction", &createDBTransactionDTO).Return(transaction, nil)
-		mockExternal.On("ForwardTransactionToThirdParty", transaction).Return(nil)
-		mockRepo.On("UpdateTransactionStatus", transaction, "success").Return(nil)
-		mockIdempotencyStore.On("UpdateIdempotencyKeyStatus", "12345", constants.SUCCESS).Return(nil)
+		mockIdempotencyStore.On("CompleteIdempotencyKey", "12345", "test-lease", http.StatusAccepted, mock.Anything).Return(nil)
 		body, _ := json.Marshal(transactionDTO)
 		req, _ := http.NewRequest("POST", "/transactions/credit", bytes.NewBuffer(body))
 		req.Header.Set("X-Idempotency-Key", "12345")
@@ -192,7 +215,7 @@ func TestCreateCreditTransaction(t *testing.T) {
 
 		handler.ServeHTTP(rr, req)
 
-		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, http.StatusAccepted, rr.Code)
 		mockRepo.AssertExpectations(t)
 		mockExternal.AssertExpectations(t)
 		mockIdempotencyStore.AssertExpectations(t)
@@ -200,8 +223,9 @@ func TestCreateCreditTransaction(t *testing.T) {
 
 	t.Run("invalid payload", func(t *testing.T) {
 		mockIdempotencyStore.On("CheckIdempotencyKeyStatus", "12345").Return(constants.WAITING, nil)
-		mockIdempotencyStore.On("UpdateIdempotencyKeyStatus", "12345", constants.PROCESSING).Return(nil)
-		mockIdempotencyStore.On("UpdateIdempotencyKeyStatus", "12345", constants.FAILED).Return(nil)
+		mockIdempotencyStore.On("BindIdempotencyKeyFingerprint", "12345", mock.Anything).Return(true, nil)
+		mockIdempotencyStore.On("ClaimIdempotencyKey", "12345", constants.WAITING).Return("test-lease", true, nil)
+		mockIdempotencyStore.On("UpdateIdempotencyKeyStatus", "12345", "test-lease", constants.FAILED).Return(nil)
 
 		req, _ := http.NewRequest("POST", "/transactions/credit", bytes.NewBuffer([]byte("invalid payload")))
 		req.Header.Set("X-Idempotency-Key", "12345")
@@ -217,11 +241,18 @@ func TestCreateCreditTransaction(t *testing.T) {
 
 		transactionDTO := dto.CreateTransactionDTO{
 			AccountID: 123,
-			Amount:    -100.0,
+			Amount:    decimal.NewFromInt(-100),
+		}
+		account := &models.UserAccount{
+			ID:       123,
+			Balance:  decimal.NewFromFloat(1000.0),
+			Currency: "NGN",
 		}
+		mockRepo.On("FindAccountById", 123).Return(account).Once()
 		mockIdempotencyStore.On("CheckIdempotencyKeyStatus", "12345").Return(constants.WAITING, nil)
-		mockIdempotencyStore.On("UpdateIdempotencyKeyStatus", "12345", constants.PROCESSING).Return(nil)
-		mockIdempotencyStore.On("UpdateIdempotencyKeyStatus", "12345", constants.FAILED).Return(nil)
+		mockIdempotencyStore.On("BindIdempotencyKeyFingerprint", "12345", mock.Anything).Return(true, nil)
+		mockIdempotencyStore.On("ClaimIdempotencyKey", "12345", constants.WAITING).Return("test-lease", true, nil)
+		mockIdempotencyStore.On("UpdateIdempotencyKeyStatus", "12345", "test-lease", constants.FAILED).Return(nil)
 		body, _ := json.Marshal(transactionDTO)
 		req, _ := http.NewRequest("POST", "/transactions/credit", bytes.NewBuffer(body))
 		req.Header.Set("X-Idempotency-Key", "12345")
@@ -234,16 +265,63 @@ func TestCreateCreditTransaction(t *testing.T) {
 
 	})
 
+	t.Run("amount with more precision than the currency allows", func(t *testing.T) {
+		account := &models.UserAccount{
+			ID:       123,
+			Balance:  decimal.NewFromFloat(1000.0),
+			Currency: "NGN",
+		}
+		mockRepo.On("FindAccountById", 123).Return(account).Once()
+		mockIdempotencyStore.On("CheckIdempotencyKeyStatus", "12345").Return(constants.WAITING, nil)
+		mockIdempotencyStore.On("BindIdempotencyKeyFingerprint", "12345", mock.Anything).Return(true, nil)
+		mockIdempotencyStore.On("ClaimIdempotencyKey", "12345", constants.WAITING).Return("test-lease", true, nil)
+		mockIdempotencyStore.On("UpdateIdempotencyKeyStatus", "12345", "test-lease", constants.FAILED).Return(nil)
+		body := []byte(`{"account_id": 123, "amount": "100.005"}`)
+		req, _ := http.NewRequest("POST", "/transactions/credit", bytes.NewBuffer(body))
+		req.Header.Set("X-Idempotency-Key", "12345")
+		rr := httptest.NewRecorder()
+
+		handler.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+		assert.Contains(t, rr.Body.String(), constants.ErrAmountPrecision.Error())
+		mockIdempotencyStore.AssertExpectations(t)
+	})
+
+	t.Run("currency does not match the account", func(t *testing.T) {
+		account := &models.UserAccount{
+			ID:       123,
+			Balance:  decimal.NewFromFloat(1000.0),
+			Currency: "NGN",
+		}
+		mockRepo.On("FindAccountById", 123).Return(account).Once()
+		mockIdempotencyStore.On("CheckIdempotencyKeyStatus", "12345").Return(constants.WAITING, nil)
+		mockIdempotencyStore.On("BindIdempotencyKeyFingerprint", "12345", mock.Anything).Return(true, nil)
+		mockIdempotencyStore.On("ClaimIdempotencyKey", "12345", constants.WAITING).Return("test-lease", true, nil)
+		mockIdempotencyStore.On("UpdateIdempotencyKeyStatus", "12345", "test-lease", constants.FAILED).Return(nil)
+		body := []byte(`{"account_id": 123, "amount": "100", "currency": "USD"}`)
+		req, _ := http.NewRequest("POST", "/transactions/credit", bytes.NewBuffer(body))
+		req.Header.Set("X-Idempotency-Key", "12345")
+		rr := httptest.NewRecorder()
+
+		handler.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusUnprocessableEntity, rr.Code)
+		mockRepo.AssertExpectations(t)
+		mockIdempotencyStore.AssertExpectations(t)
+	})
+
 	t.Run("invalid account ID", func(t *testing.T) {
 		transactionDTO := dto.CreateTransactionDTO{
 			AccountID: 999,
-			Amount:    100.0,
+			Amount:    decimal.NewFromInt(100),
 		}
 
 		mockRepo.On("FindAccountById", 999).Return(nil).Once()
 		mockIdempotencyStore.On("CheckIdempotencyKeyStatus", "12345").Return(constants.WAITING, nil)
-		mockIdempotencyStore.On("UpdateIdempotencyKeyStatus", "12345", constants.PROCESSING).Return(nil)
-		mockIdempotencyStore.On("UpdateIdempotencyKeyStatus", "12345", constants.FAILED).Return(nil)
+		mockIdempotencyStore.On("BindIdempotencyKeyFingerprint", "12345", mock.Anything).Return(true, nil)
+		mockIdempotencyStore.On("ClaimIdempotencyKey", "12345", constants.WAITING).Return("test-lease", true, nil)
+		mockIdempotencyStore.On("UpdateIdempotencyKeyStatus", "12345", "test-lease", constants.FAILED).Return(nil)
 		body, _ := json.Marshal(transactionDTO)
 		req, _ := http.NewRequest("POST", "/transactions/credit", bytes.NewBuffer(body))
 		req.Header.Set("X-Idempotency-Key", "12345")
@@ -256,68 +334,173 @@ func TestCreateCreditTransaction(t *testing.T) {
 		mockIdempotencyStore.AssertExpectations(t)
 	})
 
-	t.Run("forward transaction error", func(t *testing.T) {
+}
+
+func TestProcessingIdempotency(t *testing.T) {
+	mockRepo := new(mocks.MockRepo)
+	mockExternal := new(mocks.MockExternal)
+	mockIdempotencyStore := new(mocks.MockIdempotencyStore)
+	mockIdempotencyStore.On("KeepIdempotencyKeyLease", mock.Anything, "test-lease").Return(func() {}).Maybe()
+	ctrl := controllers.NewController(mockRepo, mockExternal, mockIdempotencyStore, controllers.Options{})
+
+	handler := http.HandlerFunc(ctrl.CreateCreditTransaction)
+	mockIdempotencyStore.On("RegisterIdempotencyKey", mock.Anything).Return(false, nil)
+	mockExternal.On("CircuitBreakerState").Return(external.CircuitBreakerState{State: external.CircuitClosed}).Maybe()
+	t.Run("idempotency processing", func(t *testing.T) {
 
 		transactionDTO := dto.CreateTransactionDTO{
 			AccountID: 124,
-			Amount:    100.0,
+			Amount:    decimal.NewFromInt(100),
 		}
-		account := &models.UserAccount{
-			ID:      124,
-			Balance: decimal.NewFromFloat(1000.0),
+
+		mockIdempotencyStore.On("CheckIdempotencyKeyStatus", "12345").Return(constants.PROCESSING, nil)
+		mockIdempotencyStore.On("BindIdempotencyKeyFingerprint", "12345", mock.Anything).Return(true, nil)
+
+		body, _ := json.Marshal(transactionDTO)
+		req, _ := http.NewRequest("POST", "/transactions/credit", bytes.NewBuffer(body))
+		req.Header.Set("X-Idempotency-Key", "12345")
+		rr := httptest.NewRecorder()
+
+		handler.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusConflict, rr.Code)
+		mockExternal.AssertExpectations(t)
+		mockRepo.AssertExpectations(t)
+		mockIdempotencyStore.AssertExpectations(t)
+	})
+	t.Run("idempotency success replays the original response", func(t *testing.T) {
+
+		transactionDTO := dto.CreateTransactionDTO{
+			AccountID: 124,
+			Amount:    decimal.NewFromInt(100),
 		}
-		createDBTransactionDTO := dto.CreateDBTransactionDTO{
-			AccountID: transactionDTO.AccountID,
-			Amount:    transactionDTO.Amount,
-			Direction: "credit",
+		originalResponse := []byte(`{"success":true,"message":"Transaction created successfully","data":{"reference":"TRX-1"}}`)
+
+		mockIdempotencyStore.On("CheckIdempotencyKeyStatus", "replayed-key").Return(constants.SUCCESS, nil)
+		mockIdempotencyStore.On("BindIdempotencyKeyFingerprint", "replayed-key", mock.Anything).Return(true, nil)
+		mockIdempotencyStore.On("FetchIdempotencyKeyResponse", "replayed-key").Return(http.StatusOK, originalResponse, nil)
+
+		body, _ := json.Marshal(transactionDTO)
+		req, _ := http.NewRequest("POST", "/transactions/credit", bytes.NewBuffer(body))
+		req.Header.Set("X-Idempotency-Key", "replayed-key")
+		rr := httptest.NewRecorder()
+
+		handler.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, originalResponse, rr.Body.Bytes())
+		assert.Equal(t, "true", rr.Header().Get("Idempotent-Replayed"))
+		mockExternal.AssertExpectations(t)
+		mockRepo.AssertExpectations(t)
+		mockIdempotencyStore.AssertExpectations(t)
+	})
+
+	t.Run("released key with a settled transaction is not executed again", func(t *testing.T) {
+
+		transactionDTO := dto.CreateTransactionDTO{
+			AccountID: 124,
+			Amount:    decimal.NewFromInt(100),
 		}
-		transaction := &models.Transaction{
-			AccountID: createDBTransactionDTO.AccountID,
-			Amount:    createDBTransactionDTO.Amount,
-			Direction: "credit",
-			Status:    "pending",
+		transaction := &models.Transaction{AccountID: 124, Reference: "TRX-SETTLED", Amount: decimal.NewFromInt(100), Direction: "credit", Status: constants.SUCCESS}
+
+		mockIdempotencyStore.On("CheckIdempotencyKeyStatus", "released-settled-key").Return(constants.CAN_RETRY, nil)
+		mockIdempotencyStore.On("BindIdempotencyKeyFingerprint", "released-settled-key", mock.Anything).Return(true, nil)
+		mockIdempotencyStore.On("ClaimIdempotencyKey", "released-settled-key", constants.CAN_RETRY).Return("test-lease", true, nil)
+		mockRepo.On("FetchTransactionsByIdempotencyKey", "released-settled-key").Return([]*models.Transaction{transaction}, nil)
+		mockIdempotencyStore.On("CompleteIdempotencyKey", "released-settled-key", "test-lease", http.StatusAccepted, mock.Anything).Return(nil)
+
+		body, _ := json.Marshal(transactionDTO)
+		req, _ := http.NewRequest("POST", "/transactions/credit", bytes.NewBuffer(body))
+		req.Header.Set("X-Idempotency-Key", "released-settled-key")
+		rr := httptest.NewRecorder()
+
+		handler.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusAccepted, rr.Code)
+		assert.Contains(t, rr.Body.String(), "TRX-SETTLED")
+		mockRepo.AssertNotCalled(t, "SettleTransaction", transaction)
+		mockExternal.AssertNotCalled(t, "ForwardTransactionToThirdParty", transaction)
+		mockIdempotencyStore.AssertExpectations(t)
+	})
+
+	t.Run("released key with a pending transaction is not created again", func(t *testing.T) {
+
+		transactionDTO := dto.CreateTransactionDTO{
+			AccountID: 124,
+			Amount:    decimal.NewFromInt(100),
 		}
-		mockIdempotencyStore.On("CheckIdempotencyKeyStatus", "12345").Return(constants.WAITING, nil)
-		mockIdempotencyStore.On("UpdateIdempotencyKeyStatus", "12345", constants.PROCESSING).Return(nil)
-		mockRepo.On("FindAccountById", 124).Return(account)
-		mockRepo.On("CreateTransaction", &createDBTransactionDTO).Return(transaction, nil)
-		mockExternal.On("ForwardTransactionToThirdParty", transaction).Return(constants.ErrThirdPartyFailure)
-		mockRepo.On("UpdateTransactionStatus", transaction, "failed").Return(nil)
-		mockIdempotencyStore.On("UpdateIdempotencyKeyStatus", "12345", constants.FAILED).Return(nil)
+		transaction := &models.Transaction{AccountID: 124, Reference: "TRX-PENDING", Amount: decimal.NewFromInt(100), Direction: "credit", Status: "pending"}
+
+		mockIdempotencyStore.On("CheckIdempotencyKeyStatus", "released-pending-key").Return(constants.CAN_RETRY, nil)
+		mockIdempotencyStore.On("BindIdempotencyKeyFingerprint", "released-pending-key", mock.Anything).Return(true, nil)
+		mockIdempotencyStore.On("ClaimIdempotencyKey", "released-pending-key", constants.CAN_RETRY).Return("test-lease", true, nil)
+		mockRepo.On("FetchTransactionsByIdempotencyKey", "released-pending-key").Return([]*models.Transaction{transaction}, nil)
+		mockIdempotencyStore.On("CompleteIdempotencyKey", "released-pending-key", "test-lease", http.StatusAccepted, mock.Anything).Return(nil)
 
 		body, _ := json.Marshal(transactionDTO)
 		req, _ := http.NewRequest("POST", "/transactions/credit", bytes.NewBuffer(body))
-		req.Header.Set("X-Idempotency-Key", "12345")
+		req.Header.Set("X-Idempotency-Key", "released-pending-key")
 		rr := httptest.NewRecorder()
 
 		handler.ServeHTTP(rr, req)
 
-		assert.Equal(t, http.StatusInternalServerError, rr.Code)
+		assert.Equal(t, http.StatusAccepted, rr.Code)
+		mockRepo.AssertNotCalled(t, "CreateTransaction", mock.MatchedBy(func(d *dto.CreateDBTransactionDTO) bool { return d.IdempotencyKey == "released-pending-key" }))
 		mockExternal.AssertExpectations(t)
 		mockRepo.AssertExpectations(t)
 		mockIdempotencyStore.AssertExpectations(t)
 	})
-}
 
-func TestProcessingIdempotency(t *testing.T) {
-	mockRepo := new(mocks.MockRepo)
-	mockExternal := new(mocks.MockExternal)
-	mockIdempotencyStore := new(mocks.MockIdempotencyStore)
-	ctrl := controllers.NewController(mockRepo, mockExternal, mockIdempotencyStore)
+	t.Run("released key without a transaction runs the request again", func(t *testing.T) {
 
-	handler := http.HandlerFunc(ctrl.CreateCreditTransaction)
-	t.Run("idempotency processing", func(t *testing.T) {
+		transactionDTO := dto.CreateTransactionDTO{
+			AccountID: 126,
+			Amount:    decimal.NewFromInt(100),
+		}
+		createDBTransactionDTO := &dto.CreateDBTransactionDTO{
+			AccountID:      126,
+			Amount:         transactionDTO.Amount,
+			Direction:      "credit",
+			Currency:       "NGN",
+			IdempotencyKey: "released-empty-key",
+		}
+		transaction := &models.Transaction{AccountID: 126, Reference: "TRX-RETRIED", Amount: decimal.NewFromInt(100), Direction: "credit", Status: "pending"}
+
+		mockIdempotencyStore.On("CheckIdempotencyKeyStatus", "released-empty-key").Return(constants.CAN_RETRY, nil)
+		mockIdempotencyStore.On("BindIdempotencyKeyFingerprint", "released-empty-key", mock.Anything).Return(true, nil)
+		mockIdempotencyStore.On("ClaimIdempotencyKey", "released-empty-key", constants.CAN_RETRY).Return("test-lease", true, nil)
+		mockRepo.On("FetchTransactionsByIdempotencyKey", "released-empty-key").Return([]*models.Transaction{}, nil)
+		mockRepo.On("FindAccountById", 126).Return(&models.UserAccount{ID: 126, Balance: decimal.NewFromInt(0), Currency: "NGN"})
+		mockRepo.On("CreateTransaction", createDBTransactionDTO).Return(transaction, nil)
+		mockIdempotencyStore.On("CompleteIdempotencyKey", "released-empty-key", "test-lease", http.StatusAccepted, mock.Anything).Return(nil)
+
+		body, _ := json.Marshal(transactionDTO)
+		req, _ := http.NewRequest("POST", "/transactions/credit", bytes.NewBuffer(body))
+		req.Header.Set("X-Idempotency-Key", "released-empty-key")
+		rr := httptest.NewRecorder()
+
+		handler.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusAccepted, rr.Code)
+		mockExternal.AssertExpectations(t)
+		mockRepo.AssertExpectations(t)
+		mockIdempotencyStore.AssertExpectations(t)
+	})
+
+	t.Run("idempotency success without a stored response", func(t *testing.T) {
 
 		transactionDTO := dto.CreateTransactionDTO{
 			AccountID: 124,
-			Amount:    100.0,
+			Amount:    decimal.NewFromInt(100),
 		}
 
-		mockIdempotencyStore.On("CheckIdempotencyKeyStatus", "12345").Return(constants.PROCESSING, nil)
+		mockIdempotencyStore.On("CheckIdempotencyKeyStatus", "legacy-key").Return(constants.SUCCESS, nil)
+		mockIdempotencyStore.On("BindIdempotencyKeyFingerprint", "legacy-key", mock.Anything).Return(true, nil)
+		mockIdempotencyStore.On("FetchIdempotencyKeyResponse", "legacy-key").Return(0, nil, nil)
 
 		body, _ := json.Marshal(transactionDTO)
 		req, _ := http.NewRequest("POST", "/transactions/credit", bytes.NewBuffer(body))
-		req.Header.Set("X-Idempotency-Key", "12345")
+		req.Header.Set("X-Idempotency-Key", "legacy-key")
 		rr := httptest.NewRecorder()
 
 		handler.ServeHTTP(rr, req)
@@ -327,23 +510,26 @@ func TestProcessingIdempotency(t *testing.T) {
 		mockRepo.AssertExpectations(t)
 		mockIdempotencyStore.AssertExpectations(t)
 	})
-	t.Run("idempotency success", func(t *testing.T) {
+
+	t.Run("idempotency key reused with different parameters", func(t *testing.T) {
 
 		transactionDTO := dto.CreateTransactionDTO{
 			AccountID: 124,
-			Amount:    100.0,
+			Amount:    decimal.NewFromInt(200),
 		}
 
-		mockIdempotencyStore.On("CheckIdempotencyKeyStatus", "12345").Return(constants.SUCCESS, nil)
+		mockIdempotencyStore.On("CheckIdempotencyKeyStatus", "reused-key").Return(constants.SUCCESS, nil)
+		mockIdempotencyStore.On("BindIdempotencyKeyFingerprint", "reused-key", mock.Anything).Return(false, nil)
 
 		body, _ := json.Marshal(transactionDTO)
 		req, _ := http.NewRequest("POST", "/transactions/credit", bytes.NewBuffer(body))
-		req.Header.Set("X-Idempotency-Key", "12345")
+		req.Header.Set("X-Idempotency-Key", "reused-key")
 		rr := httptest.NewRecorder()
 
 		handler.ServeHTTP(rr, req)
 
-		assert.Equal(t, http.StatusConflict, rr.Code)
+		assert.Equal(t, http.StatusUnprocessableEntity, rr.Code)
+		assert.Contains(t, rr.Body.String(), "idempotency key reused with different parameters")
 		mockExternal.AssertExpectations(t)
 		mockRepo.AssertExpectations(t)
 		mockIdempotencyStore.AssertExpectations(t)
@@ -353,14 +539,15 @@ func TestProcessingIdempotency(t *testing.T) {
 
 		transactionDTO := dto.CreateTransactionDTO{
 			AccountID: 124,
-			Amount:    100.0,
+			Amount:    decimal.NewFromInt(100),
 		}
 
-		mockIdempotencyStore.On("CheckIdempotencyKeyStatus", "12345").Return(constants.FAILED, nil)
+		mockIdempotencyStore.On("CheckIdempotencyKeyStatus", "failed-key").Return(constants.FAILED, nil)
+		mockIdempotencyStore.On("BindIdempotencyKeyFingerprint", "failed-key", mock.Anything).Return(true, nil)
 
 		body, _ := json.Marshal(transactionDTO)
 		req, _ := http.NewRequest("POST", "/transactions/credit", bytes.NewBuffer(body))
-		req.Header.Set("X-Idempotency-Key", "12345")
+		req.Header.Set("X-Idempotency-Key", "failed-key")
 		rr := httptest.NewRecorder()
 
 		handler.ServeHTTP(rr, req)
@@ -371,3 +558,138 @@ func TestProcessingIdempotency(t *testing.T) {
 		mockIdempotencyStore.AssertExpectations(t)
 	})
 }
+
+func TestThirdPartyUnavailable(t *testing.T) {
+	mockRepo := new(mocks.MockRepo)
+	mockExternal := new(mocks.MockExternal)
+	mockIdempotencyStore := new(mocks.MockIdempotencyStore)
+	mockIdempotencyStore.On("KeepIdempotencyKeyLease", mock.Anything, "test-lease").Return(func() {}).Maybe()
+	ctrl := controllers.NewController(mockRepo, mockExternal, mockIdempotencyStore, controllers.Options{})
+	mockIdempotencyStore.On("RegisterIdempotencyKey", mock.Anything).Return(false, nil)
+	retryAt := time.Now().Add(10 * time.Second)
+	mockExternal.On("CircuitBreakerState").Return(external.CircuitBreakerState{State: external.CircuitOpen, RetryAt: &retryAt})
+
+	t.Run("open breaker fails fast and leaves the key open for a retry", func(t *testing.T) {
+		mockIdempotencyStore.On("CheckIdempotencyKeyStatus", "open-key").Return(constants.WAITING, nil)
+		mockIdempotencyStore.On("BindIdempotencyKeyFingerprint", "open-key", mock.Anything).Return(true, nil)
+		mockIdempotencyStore.On("ClaimIdempotencyKey", "open-key", constants.WAITING).Return("test-lease", true, nil)
+		mockIdempotencyStore.On("UpdateIdempotencyKeyStatus", "open-key", "test-lease", constants.CAN_RETRY).Return(nil)
+		body, _ := json.Marshal(dto.CreateTransactionDTO{AccountID: 123, Amount: decimal.NewFromInt(100)})
+		req, _ := http.NewRequest("POST", "/transactions/debit", bytes.NewBuffer(body))
+		req.Header.Set("X-Idempotency-Key", "open-key")
+		rr := httptest.NewRecorder()
+
+		http.HandlerFunc(ctrl.CreateDebitTransaction).ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusServiceUnavailable, rr.Code)
+		assert.NotEmpty(t, rr.Header().Get("Retry-After"))
+		assert.Contains(t, rr.Body.String(), controllers.ThirdPartyUnavailableCode)
+		mockIdempotencyStore.AssertCalled(t, "UpdateIdempotencyKeyStatus", "open-key", "test-lease", constants.CAN_RETRY)
+		mockRepo.AssertNotCalled(t, "FindAccountById", mock.Anything)
+	})
+
+	t.Run("breaker state is exposed", func(t *testing.T) {
+		req, _ := http.NewRequest("GET", "/third-party/status", nil)
+		rr := httptest.NewRecorder()
+
+		http.HandlerFunc(ctrl.FetchThirdPartyStatus).ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Contains(t, rr.Body.String(), `"state":"open"`)
+	})
+}
+
+func TestFetchTransactionDetails(t *testing.T) {
+	mockRepo := new(mocks.MockRepo)
+	mockExternal := new(mocks.MockExternal)
+	mockIdempotencyStore := new(mocks.MockIdempotencyStore)
+	ctrl := controllers.NewController(mockRepo, mockExternal, mockIdempotencyStore, controllers.Options{})
+
+	handler := http.HandlerFunc(ctrl.FetchTransactionDetails)
+
+	t.Run("transaction found", func(t *testing.T) {
+		transaction := &models.Transaction{
+			AccountID: 123,
+			Reference: "TRX-1",
+			Amount:    decimal.NewFromInt(100),
+			Direction: "credit",
+			Status:    "success",
+		}
+		mockRepo.On("FetchTransactionDetailsByReference", "TRX-1").Return(transaction)
+
+		req, _ := http.NewRequest("GET", "/transaction/TRX-1", nil)
+		req = mux.SetURLVars(req, map[string]string{"reference": "TRX-1"})
+		rr := httptest.NewRecorder()
+
+		handler.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.NotContains(t, rr.Body.String(), `"external"`)
+		mockRepo.AssertExpectations(t)
+		mockExternal.AssertNotCalled(t, "FetchTransactionDetailsFromThirdParty", "TRX-1")
+	})
+
+	t.Run("transaction found with external details", func(t *testing.T) {
+		transaction := &models.Transaction{
+			AccountID: 123,
+			Reference: "TRX-2",
+			Amount:    decimal.NewFromInt(100),
+			Direction: "credit",
+			Status:    "success",
+		}
+		externalTransaction := &dto.ForwardTransactionDTO{
+			Reference: "TRX-2",
+			AccountID: 123,
+			Amount:    decimal.NewFromInt(100),
+		}
+		mockRepo.On("FetchTransactionDetailsByReference", "TRX-2").Return(transaction)
+		mockExternal.On("FetchTransactionDetailsFromThirdParty", "TRX-2").Return(externalTransaction, nil)
+
+		req, _ := http.NewRequest("GET", "/transaction/TRX-2?include=external", nil)
+		req = mux.SetURLVars(req, map[string]string{"reference": "TRX-2"})
+		rr := httptest.NewRecorder()
+
+		handler.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Contains(t, rr.Body.String(), `"external":{"reference":"TRX-2"`)
+		mockRepo.AssertExpectations(t)
+		mockExternal.AssertExpectations(t)
+	})
+
+	t.Run("external lookup failure still returns the transaction", func(t *testing.T) {
+		transaction := &models.Transaction{
+			AccountID: 123,
+			Reference: "TRX-3",
+			Amount:    decimal.NewFromInt(100),
+			Direction: "credit",
+			Status:    "success",
+		}
+		mockRepo.On("FetchTransactionDetailsByReference", "TRX-3").Return(transaction)
+		mockExternal.On("FetchTransactionDetailsFromThirdParty", "TRX-3").Return(nil, constants.ErrThirdPartyFailure)
+
+		req, _ := http.NewRequest("GET", "/transaction/TRX-3?include=external", nil)
+		req = mux.SetURLVars(req, map[string]string{"reference": "TRX-3"})
+		rr := httptest.NewRecorder()
+
+		handler.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Contains(t, rr.Body.String(), constants.ErrThirdPartyFailure.Error())
+		mockRepo.AssertExpectations(t)
+		mockExternal.AssertExpectations(t)
+	})
+
+	t.Run("transaction not found", func(t *testing.T) {
+		mockRepo.On("FetchTransactionDetailsByReference", "TRX-404").Return(nil)
+
+		req, _ := http.NewRequest("GET", "/transaction/TRX-404", nil)
+		req = mux.SetURLVars(req, map[string]string{"reference": "TRX-404"})
+		rr := httptest.NewRecorder()
+
+		handler.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+		mockRepo.AssertExpectations(t)
+	})
+}
@@ -0,0 +1,217 @@
+package controllers_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/midedickson/simple-banking-app/constants"
+	"github.com/midedickson/simple-banking-app/controllers"
+	"github.com/midedickson/simple-banking-app/dto"
+	"github.com/midedickson/simple-banking-app/fx"
+	"github.com/midedickson/simple-banking-app/models"
+	"github.com/midedickson/simple-banking-app/tests/mocks"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func TestCreateTransfer(t *testing.T) {
+	mockRepo := new(mocks.MockRepo)
+	mockExternal := new(mocks.MockExternal)
+	mockIdempotencyStore := new(mocks.MockIdempotencyStore)
+	mockIdempotencyStore.On("KeepIdempotencyKeyLease", mock.Anything, "test-lease").Return(func() {}).Maybe()
+	db, err := gorm.Open(sqlite.Open(fmt.Sprintf("file:%s?mode=memory&cache=shared", t.Name())), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&models.FXQuote{}); err != nil {
+		t.Fatal(err)
+	}
+	quoter := fx.NewQuoter(db, fx.NewStaticRateProvider(map[string]decimal.Decimal{
+		"USD/NGN": decimal.NewFromInt(1500),
+	}), decimal.RequireFromString("0.01"), time.Minute)
+	ctrl := controllers.NewController(mockRepo, mockExternal, mockIdempotencyStore, controllers.Options{Quoter: quoter})
+
+	handler := http.HandlerFunc(ctrl.CreateTransfer)
+	mockIdempotencyStore.On("RegisterIdempotencyKey", mock.Anything).Return(false, nil)
+
+	t.Run("successful transfer", func(t *testing.T) {
+		transferDTO := dto.CreateTransferDTO{
+			SourceAccountID:      1,
+			DestinationAccountID: 2,
+			Amount:               decimal.NewFromInt(100),
+		}
+		transfer := &dto.TransferDTO{
+			TransferID: "TRF-1",
+			Debit:      &models.Transaction{AccountID: 1, Amount: decimal.NewFromInt(100), Direction: "debit", Status: "success", TransferID: "TRF-1"},
+			Credit:     &models.Transaction{AccountID: 2, Amount: decimal.NewFromInt(100), Direction: "credit", Status: "success", TransferID: "TRF-1"},
+		}
+		mockIdempotencyStore.On("CheckIdempotencyKeyStatus", "transfer-1").Return(constants.WAITING, nil)
+		mockIdempotencyStore.On("BindIdempotencyKeyFingerprint", "transfer-1", mock.Anything).Return(true, nil)
+		mockIdempotencyStore.On("ClaimIdempotencyKey", "transfer-1", constants.WAITING).Return("test-lease", true, nil)
+		mockRepo.On("FindAccountById", 1).Return(&models.UserAccount{ID: 1, Balance: decimal.NewFromFloat(400.0), Currency: "NGN"})
+		mockRepo.On("FindAccountById", 2).Return(&models.UserAccount{ID: 2, Balance: decimal.NewFromFloat(400.0), Currency: "NGN"})
+		createDBTransferDTO := &dto.CreateDBTransferDTO{
+			SourceAccountID:      1,
+			DestinationAccountID: 2,
+			Amount:               transferDTO.Amount,
+			DestinationAmount:    transferDTO.Amount,
+			IdempotencyKey:       "transfer-1",
+		}
+		mockRepo.On("CreateTransfer", createDBTransferDTO).Return(transfer, nil)
+		mockIdempotencyStore.On("CompleteIdempotencyKey", "transfer-1", "test-lease", http.StatusOK, mock.Anything).Return(nil)
+
+		body, _ := json.Marshal(transferDTO)
+		req, _ := http.NewRequest("POST", "/transfer", bytes.NewBuffer(body))
+		req.Header.Set("X-Idempotency-Key", "transfer-1")
+		rr := httptest.NewRecorder()
+
+		handler.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Contains(t, rr.Body.String(), `"transfer_id":"TRF-1"`)
+		mockRepo.AssertExpectations(t)
+		mockIdempotencyStore.AssertExpectations(t)
+	})
+
+	t.Run("insufficient funds", func(t *testing.T) {
+		transferDTO := dto.CreateTransferDTO{
+			SourceAccountID:      1,
+			DestinationAccountID: 2,
+			Amount:               decimal.NewFromInt(1000),
+		}
+		mockIdempotencyStore.On("CheckIdempotencyKeyStatus", "transfer-2").Return(constants.WAITING, nil)
+		mockIdempotencyStore.On("BindIdempotencyKeyFingerprint", "transfer-2", mock.Anything).Return(true, nil)
+		mockIdempotencyStore.On("ClaimIdempotencyKey", "transfer-2", constants.WAITING).Return("test-lease", true, nil)
+		createDBTransferDTO := &dto.CreateDBTransferDTO{
+			SourceAccountID:      1,
+			DestinationAccountID: 2,
+			Amount:               transferDTO.Amount,
+			DestinationAmount:    transferDTO.Amount,
+			IdempotencyKey:       "transfer-2",
+		}
+		mockRepo.On("CreateTransfer", createDBTransferDTO).Return(nil, constants.ErrInsufficientFunds)
+		mockIdempotencyStore.On("UpdateIdempotencyKeyStatus", "transfer-2", "test-lease", constants.FAILED).Return(nil)
+
+		body, _ := json.Marshal(transferDTO)
+		req, _ := http.NewRequest("POST", "/transfer", bytes.NewBuffer(body))
+		req.Header.Set("X-Idempotency-Key", "transfer-2")
+		rr := httptest.NewRecorder()
+
+		handler.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+		mockRepo.AssertExpectations(t)
+		mockIdempotencyStore.AssertExpectations(t)
+	})
+
+	t.Run("same source and destination", func(t *testing.T) {
+		transferDTO := dto.CreateTransferDTO{
+			SourceAccountID:      1,
+			DestinationAccountID: 1,
+			Amount:               decimal.NewFromInt(100),
+		}
+		mockIdempotencyStore.On("CheckIdempotencyKeyStatus", "transfer-3").Return(constants.WAITING, nil)
+		mockIdempotencyStore.On("BindIdempotencyKeyFingerprint", "transfer-3", mock.Anything).Return(true, nil)
+		mockIdempotencyStore.On("ClaimIdempotencyKey", "transfer-3", constants.WAITING).Return("test-lease", true, nil)
+		mockIdempotencyStore.On("UpdateIdempotencyKeyStatus", "transfer-3", "test-lease", constants.FAILED).Return(nil)
+
+		body, _ := json.Marshal(transferDTO)
+		req, _ := http.NewRequest("POST", "/transfer", bytes.NewBuffer(body))
+		req.Header.Set("X-Idempotency-Key", "transfer-3")
+		rr := httptest.NewRecorder()
+
+		handler.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+		mockIdempotencyStore.AssertExpectations(t)
+	})
+
+	t.Run("cross-currency transfer uses the locked quote", func(t *testing.T) {
+		quote, err := quoter.NewQuote("USD", "NGN")
+		assert.NoError(t, err)
+		transferDTO := dto.CreateTransferDTO{
+			SourceAccountID:      4,
+			DestinationAccountID: 2,
+			Amount:               decimal.NewFromInt(10),
+			QuoteID:              quote.ID,
+		}
+		rate := decimal.NewFromInt(1485)
+		createDBTransferDTO := &dto.CreateDBTransferDTO{
+			SourceAccountID:      4,
+			DestinationAccountID: 2,
+			Amount:               transferDTO.Amount,
+			DestinationAmount:    decimal.NewFromInt(14850),
+			FXRate:               &rate,
+		}
+		transfer := &dto.TransferDTO{TransferID: "TRF-4"}
+		mockIdempotencyStore.On("CheckIdempotencyKeyStatus", "transfer-4").Return(constants.WAITING, nil)
+		mockIdempotencyStore.On("BindIdempotencyKeyFingerprint", "transfer-4", mock.Anything).Return(true, nil)
+		mockIdempotencyStore.On("ClaimIdempotencyKey", "transfer-4", constants.WAITING).Return("test-lease", true, nil)
+		mockRepo.On("FindAccountById", 4).Return(&models.UserAccount{ID: 4, Balance: decimal.NewFromFloat(400.0), Currency: "USD"})
+		mockRepo.On("CreateTransfer", mock.MatchedBy(func(d *dto.CreateDBTransferDTO) bool {
+			return d.SourceAccountID == createDBTransferDTO.SourceAccountID &&
+				d.DestinationAmount.Equal(createDBTransferDTO.DestinationAmount) &&
+				d.FXRate.Equal(*createDBTransferDTO.FXRate) &&
+				d.QuoteID == quote.ID
+		})).Return(transfer, nil)
+		mockIdempotencyStore.On("CompleteIdempotencyKey", "transfer-4", "test-lease", http.StatusOK, mock.Anything).Return(nil)
+
+		body, _ := json.Marshal(transferDTO)
+		req, _ := http.NewRequest("POST", "/transfer", bytes.NewBuffer(body))
+		req.Header.Set("X-Idempotency-Key", "transfer-4")
+		rr := httptest.NewRecorder()
+
+		handler.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		mockRepo.AssertExpectations(t)
+		mockIdempotencyStore.AssertExpectations(t)
+	})
+
+	t.Run("quote cannot be reused", func(t *testing.T) {
+		quote, _ := quoter.NewQuote("USD", "NGN")
+		_, err := fx.ConsumeQuote(db, quote.ID, "TRF-earlier")
+		assert.NoError(t, err)
+		transferDTO := dto.CreateTransferDTO{
+			SourceAccountID:      4,
+			DestinationAccountID: 2,
+			Amount:               decimal.NewFromInt(10),
+			QuoteID:              quote.ID,
+		}
+		mockIdempotencyStore.On("CheckIdempotencyKeyStatus", "transfer-5").Return(constants.WAITING, nil)
+		mockIdempotencyStore.On("BindIdempotencyKeyFingerprint", "transfer-5", mock.Anything).Return(true, nil)
+		mockIdempotencyStore.On("ClaimIdempotencyKey", "transfer-5", constants.WAITING).Return("test-lease", true, nil)
+		mockIdempotencyStore.On("UpdateIdempotencyKeyStatus", "transfer-5", "test-lease", constants.FAILED).Return(nil)
+
+		body, _ := json.Marshal(transferDTO)
+		req, _ := http.NewRequest("POST", "/transfer", bytes.NewBuffer(body))
+		req.Header.Set("X-Idempotency-Key", "transfer-5")
+		rr := httptest.NewRecorder()
+
+		handler.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusUnprocessableEntity, rr.Code)
+		assert.Contains(t, rr.Body.String(), constants.ErrQuoteUsed.Error())
+		mockIdempotencyStore.AssertExpectations(t)
+	})
+
+	t.Run("missing idempotency key", func(t *testing.T) {
+		req, _ := http.NewRequest("POST", "/transfer", bytes.NewBuffer([]byte("{}")))
+		rr := httptest.NewRecorder()
+
+		handler.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+}
@@ -0,0 +1,98 @@
+package controllers_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/midedickson/simple-banking-app/constants"
+	"github.com/midedickson/simple-banking-app/controllers"
+	"github.com/midedickson/simple-banking-app/dto"
+	"github.com/midedickson/simple-banking-app/models"
+	"github.com/midedickson/simple-banking-app/tests/mocks"
+	"github.com/midedickson/simple-banking-app/webhooks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func newWebhookRequest(t *testing.T, secret string, event dto.PartnerWebhookDTO) *http.Request {
+	body, err := json.Marshal(event)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, _ := http.NewRequest("POST", "/webhooks/partner", bytes.NewBuffer(body))
+	webhooks.SignRequest(req, secret, time.Now(), body)
+	return req
+}
+
+func eventWithID(eventID string) interface{} {
+	return mock.MatchedBy(func(event *models.WebhookEvent) bool { return event.EventID == eventID })
+}
+
+func TestReceivePartnerWebhook(t *testing.T) {
+	mockRepo := new(mocks.MockRepo)
+	mockExternal := new(mocks.MockExternal)
+	mockIdempotencyStore := new(mocks.MockIdempotencyStore)
+	ctrl := controllers.NewController(mockRepo, mockExternal, mockIdempotencyStore, controllers.Options{WebhookVerifier: webhooks.NewVerifier("secret", time.Minute)})
+	handler := http.HandlerFunc(ctrl.ReceivePartnerWebhook)
+
+	t.Run("confirmed transaction is settled", func(t *testing.T) {
+		transaction := &models.Transaction{Reference: "TRX-1", Status: constants.SUCCESS}
+		mockRepo.On("ApplyWebhookEvent", eventWithID("evt-1")).Return(transaction, nil).Once()
+		rr := httptest.NewRecorder()
+
+		handler.ServeHTTP(rr, newWebhookRequest(t, "secret", dto.PartnerWebhookDTO{EventID: "evt-1", Reference: "TRX-1", Status: constants.PartnerEventCompleted}))
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		mockRepo.AssertExpectations(t)
+	})
+
+	t.Run("redelivered event is acknowledged without being applied again", func(t *testing.T) {
+		mockRepo.On("ApplyWebhookEvent", eventWithID("evt-2")).Return(nil, constants.ErrDuplicateWebhookEvent).Once()
+		rr := httptest.NewRecorder()
+
+		handler.ServeHTTP(rr, newWebhookRequest(t, "secret", dto.PartnerWebhookDTO{EventID: "evt-2", Reference: "TRX-1", Status: constants.PartnerEventCompleted}))
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Contains(t, rr.Body.String(), "already processed")
+	})
+
+	t.Run("unknown transaction", func(t *testing.T) {
+		mockRepo.On("ApplyWebhookEvent", eventWithID("evt-3")).Return(nil, constants.ErrTransactionNotFound).Once()
+		rr := httptest.NewRecorder()
+
+		handler.ServeHTTP(rr, newWebhookRequest(t, "secret", dto.PartnerWebhookDTO{EventID: "evt-3", Reference: "TRX-unknown", Status: constants.PartnerEventCompleted}))
+
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+	})
+
+	t.Run("invalid signature is rejected", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+
+		handler.ServeHTTP(rr, newWebhookRequest(t, "wrong-secret", dto.PartnerWebhookDTO{EventID: "evt-4", Reference: "TRX-1", Status: constants.PartnerEventCompleted}))
+
+		assert.Equal(t, http.StatusUnauthorized, rr.Code)
+		mockRepo.AssertNotCalled(t, "ApplyWebhookEvent", eventWithID("evt-4"))
+	})
+
+	t.Run("unknown status is rejected", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+
+		handler.ServeHTTP(rr, newWebhookRequest(t, "secret", dto.PartnerWebhookDTO{EventID: "evt-5", Reference: "TRX-1", Status: "maybe"}))
+
+		assert.Equal(t, http.StatusUnprocessableEntity, rr.Code)
+		mockRepo.AssertNotCalled(t, "ApplyWebhookEvent", eventWithID("evt-5"))
+	})
+
+	t.Run("webhooks are refused when no secret is configured", func(t *testing.T) {
+		unconfigured := controllers.NewController(mockRepo, mockExternal, mockIdempotencyStore, controllers.Options{})
+		rr := httptest.NewRecorder()
+
+		http.HandlerFunc(unconfigured.ReceivePartnerWebhook).ServeHTTP(rr, newWebhookRequest(t, "secret", dto.PartnerWebhookDTO{EventID: "evt-6", Reference: "TRX-1", Status: constants.PartnerEventCompleted}))
+
+		assert.Equal(t, http.StatusServiceUnavailable, rr.Code)
+	})
+}
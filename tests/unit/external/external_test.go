@@ -0,0 +1,255 @@
+package external_test
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/midedickson/simple-banking-app/constants"
+	"github.com/midedickson/simple-banking-app/dto"
+	"github.com/midedickson/simple-banking-app/external"
+	mock_client "github.com/midedickson/simple-banking-app/mock"
+	"github.com/midedickson/simple-banking-app/models"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+)
+
+// answers each call with the next status code, and with errs[i] when it is set
+func scriptedClient(statusCodes []int, errs []error, requests *[]*http.Request) *mock_client.MockClient {
+	return &mock_client.MockClient{
+		DoFunc: func(req *http.Request) (*http.Response, error) {
+			call := len(*requests)
+			*requests = append(*requests, req)
+			if call < len(errs) && errs[call] != nil {
+				return nil, errs[call]
+			}
+			return &http.Response{StatusCode: statusCodes[call], Status: http.StatusText(statusCodes[call])}, nil
+		},
+	}
+}
+
+func testRetryPolicy() external.RetryPolicy {
+	policy := external.DefaultRetryPolicy()
+	policy.BaseDelay, policy.MaxDelay = time.Millisecond, time.Millisecond
+	return policy
+}
+
+func newTestBreaker() *external.CircuitBreaker {
+	return external.NewCircuitBreaker(external.DefaultCircuitBreakerSettings())
+}
+
+func testBreakerSettings() external.CircuitBreakerSettings {
+	return external.CircuitBreakerSettings{FailureRateThreshold: 0.5, MinimumCalls: 4, Window: time.Minute, CoolDown: 20 * time.Millisecond, HalfOpenCalls: 2}
+}
+
+func TestForwardTransactionToThirdParty(t *testing.T) {
+	transaction := &models.Transaction{Reference: "TRX-1", AccountID: 1, Amount: decimal.NewFromInt(100), Currency: "NGN"}
+
+	t.Run("retryable status is retried until it succeeds", func(t *testing.T) {
+		var requests []*http.Request
+		client := scriptedClient([]int{http.StatusServiceUnavailable, http.StatusBadGateway, http.StatusOK}, nil, &requests)
+
+		err := external.NewTransactionExternal(client, external.DefaultClientSettings(), testRetryPolicy(), newTestBreaker()).ForwardTransactionToThirdParty(transaction)
+
+		assert.NoError(t, err)
+		assert.Len(t, requests, 3)
+		for _, req := range requests {
+			assert.Equal(t, "TRX-1", req.Header.Get("Idempotency-Key"))
+		}
+	})
+
+	t.Run("other statuses are rejected without a retry", func(t *testing.T) {
+		var requests []*http.Request
+		client := scriptedClient([]int{http.StatusBadRequest}, nil, &requests)
+
+		err := external.NewTransactionExternal(client, external.DefaultClientSettings(), testRetryPolicy(), newTestBreaker()).ForwardTransactionToThirdParty(transaction)
+
+		assert.ErrorIs(t, err, constants.ErrThirdPartyRejected)
+		assert.Len(t, requests, 1)
+	})
+
+	t.Run("gives up after the last attempt", func(t *testing.T) {
+		var requests []*http.Request
+		client := scriptedClient([]int{http.StatusServiceUnavailable, http.StatusServiceUnavailable, http.StatusServiceUnavailable, http.StatusOK}, nil, &requests)
+
+		err := external.NewTransactionExternal(client, external.DefaultClientSettings(), testRetryPolicy(), newTestBreaker()).ForwardTransactionToThirdParty(transaction)
+
+		assert.ErrorIs(t, err, constants.ErrThirdPartyFailure)
+		assert.Len(t, requests, 3)
+	})
+
+	t.Run("transport errors follow the policy", func(t *testing.T) {
+		refused := errors.New("connection refused")
+		var requests []*http.Request
+		client := scriptedClient([]int{0, http.StatusOK}, []error{refused}, &requests)
+
+		err := external.NewTransactionExternal(client, external.DefaultClientSettings(), testRetryPolicy(), newTestBreaker()).ForwardTransactionToThirdParty(transaction)
+		assert.NoError(t, err)
+		assert.Len(t, requests, 2)
+
+		requests = nil
+		policy := testRetryPolicy()
+		policy.RetryableError = func(err error) bool { return false }
+		client = scriptedClient([]int{0, http.StatusOK}, []error{refused}, &requests)
+
+		err = external.NewTransactionExternal(client, external.DefaultClientSettings(), policy, newTestBreaker()).ForwardTransactionToThirdParty(transaction)
+		assert.ErrorIs(t, err, refused)
+		assert.Len(t, requests, 1)
+	})
+}
+
+func TestPartnerClient(t *testing.T) {
+	var received []*http.Request
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = append(received, r)
+		if r.Method == http.MethodGet {
+			json.NewEncoder(w).Encode(dto.ForwardTransactionDTO{Reference: "TRX-3", AccountID: 1, Amount: decimal.NewFromInt(100), Currency: "NGN"})
+		}
+	}))
+	defer server.Close()
+	settings := external.DefaultClientSettings()
+	settings.BaseURL = server.URL + "/"
+	settings.Headers = map[string]string{"Authorization": "Bearer partner-token"}
+	transactionExternal := external.NewTransactionExternal(external.NewHTTPClient(settings), settings, testRetryPolicy(), newTestBreaker())
+
+	t.Run("forwards to the configured partner with its headers", func(t *testing.T) {
+		received = nil
+
+		err := transactionExternal.ForwardTransactionToThirdParty(&models.Transaction{Reference: "TRX-3", AccountID: 1, Amount: decimal.NewFromInt(100), Currency: "NGN"})
+
+		assert.NoError(t, err)
+		assert.Len(t, received, 1)
+		assert.Equal(t, "/transactions", received[0].URL.Path)
+		assert.Equal(t, "Bearer partner-token", received[0].Header.Get("Authorization"))
+		assert.Equal(t, "TRX-3", received[0].Header.Get("Idempotency-Key"))
+	})
+
+	t.Run("looks transactions up through the same client", func(t *testing.T) {
+		received = nil
+
+		transaction, err := transactionExternal.FetchTransactionDetailsFromThirdParty("TRX-3")
+
+		assert.NoError(t, err)
+		assert.Equal(t, "TRX-3", transaction.Reference)
+		assert.Len(t, received, 1)
+		assert.Equal(t, "/transactions/TRX-3", received[0].URL.Path)
+		assert.Equal(t, "Bearer partner-token", received[0].Header.Get("Authorization"))
+	})
+
+	t.Run("slow partner times out", func(t *testing.T) {
+		slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			time.Sleep(100 * time.Millisecond)
+		}))
+		defer slow.Close()
+		slowSettings := external.DefaultClientSettings()
+		slowSettings.BaseURL, slowSettings.Timeout = slow.URL, 10*time.Millisecond
+
+		_, err := external.NewTransactionExternal(external.NewHTTPClient(slowSettings), slowSettings, testRetryPolicy(), newTestBreaker()).FetchTransactionDetailsFromThirdParty("TRX-3")
+
+		assert.Error(t, err)
+	})
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	t.Run("opens once the failure rate crosses the threshold", func(t *testing.T) {
+		breaker := external.NewCircuitBreaker(testBreakerSettings())
+		for _, failed := range []bool{false, true, false} {
+			generation, err := breaker.Allow()
+			assert.NoError(t, err)
+			breaker.Record(generation, failed)
+		}
+		assert.Equal(t, external.CircuitClosed, breaker.State().State)
+
+		generation, err := breaker.Allow()
+		assert.NoError(t, err)
+		breaker.Record(generation, true)
+
+		state := breaker.State()
+		assert.Equal(t, external.CircuitOpen, state.State)
+		assert.NotNil(t, state.RetryAt)
+		_, err = breaker.Allow()
+		assert.ErrorIs(t, err, constants.ErrThirdPartyUnavailable)
+	})
+
+	t.Run("calls allowed in an earlier window are not counted", func(t *testing.T) {
+		settings := testBreakerSettings()
+		settings.Window = 20 * time.Millisecond
+		breaker := external.NewCircuitBreaker(settings)
+		var stale []uint64
+		for i := 0; i < 4; i++ {
+			generation, _ := breaker.Allow()
+			stale = append(stale, generation)
+		}
+		time.Sleep(30 * time.Millisecond)
+		generation, err := breaker.Allow()
+		assert.NoError(t, err)
+		breaker.Record(generation, false)
+
+		for _, generation := range stale {
+			breaker.Record(generation, true)
+		}
+
+		state := breaker.State()
+		assert.Equal(t, external.CircuitClosed, state.State)
+		assert.Equal(t, 1, state.Calls)
+		assert.Zero(t, state.Failures)
+	})
+
+	t.Run("open breaker fails fast without calling the third party", func(t *testing.T) {
+		var requests []*http.Request
+		statusCodes := []int{http.StatusServiceUnavailable, http.StatusServiceUnavailable, http.StatusServiceUnavailable, http.StatusServiceUnavailable, http.StatusOK}
+		client := scriptedClient(statusCodes, nil, &requests)
+		policy := testRetryPolicy()
+		policy.MaxAttempts = 1
+		transactionExternal := external.NewTransactionExternal(client, external.DefaultClientSettings(), policy, external.NewCircuitBreaker(testBreakerSettings()))
+		transaction := &models.Transaction{Reference: "TRX-2", AccountID: 1, Amount: decimal.NewFromInt(100), Currency: "NGN"}
+		for i := 0; i < 4; i++ {
+			assert.ErrorIs(t, transactionExternal.ForwardTransactionToThirdParty(transaction), constants.ErrThirdPartyFailure)
+		}
+
+		err := transactionExternal.ForwardTransactionToThirdParty(transaction)
+
+		assert.ErrorIs(t, err, constants.ErrThirdPartyUnavailable)
+		assert.Len(t, requests, 4)
+		assert.Equal(t, external.CircuitOpen, transactionExternal.CircuitBreakerState().State)
+	})
+
+	t.Run("half-open probes close the breaker after the cool-down", func(t *testing.T) {
+		breaker := external.NewCircuitBreaker(testBreakerSettings())
+		for i := 0; i < 4; i++ {
+			generation, _ := breaker.Allow()
+			breaker.Record(generation, true)
+		}
+		time.Sleep(30 * time.Millisecond)
+		assert.Equal(t, external.CircuitHalfOpen, breaker.State().State)
+
+		first, err := breaker.Allow()
+		assert.NoError(t, err)
+		second, err := breaker.Allow()
+		assert.NoError(t, err)
+		_, err = breaker.Allow()
+		assert.ErrorIs(t, err, constants.ErrThirdPartyUnavailable)
+		breaker.Record(first, false)
+		breaker.Record(second, false)
+
+		assert.Equal(t, external.CircuitClosed, breaker.State().State)
+	})
+
+	t.Run("a failed probe opens the breaker again", func(t *testing.T) {
+		breaker := external.NewCircuitBreaker(testBreakerSettings())
+		for i := 0; i < 4; i++ {
+			generation, _ := breaker.Allow()
+			breaker.Record(generation, true)
+		}
+		time.Sleep(30 * time.Millisecond)
+
+		generation, err := breaker.Allow()
+		assert.NoError(t, err)
+		breaker.Record(generation, true)
+
+		assert.Equal(t, external.CircuitOpen, breaker.State().State)
+	})
+}
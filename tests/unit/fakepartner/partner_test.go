@@ -0,0 +1,170 @@
+package fakepartner_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/midedickson/simple-banking-app/constants"
+	"github.com/midedickson/simple-banking-app/dto"
+	"github.com/midedickson/simple-banking-app/external"
+	"github.com/midedickson/simple-banking-app/fakepartner"
+	"github.com/midedickson/simple-banking-app/models"
+	"github.com/midedickson/simple-banking-app/webhooks"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestExternal(server *httptest.Server, timeout time.Duration) *external.TransactionExternal {
+	settings := external.DefaultClientSettings()
+	settings.BaseURL, settings.Timeout = server.URL, timeout
+	policy := external.DefaultRetryPolicy()
+	policy.BaseDelay, policy.MaxDelay = time.Millisecond, time.Millisecond
+	breaker := external.NewCircuitBreaker(external.DefaultCircuitBreakerSettings())
+	return external.NewTransactionExternal(external.NewHTTPClient(settings), settings, policy, breaker)
+}
+
+func newTestTransaction(reference string) *models.Transaction {
+	return &models.Transaction{Reference: reference, AccountID: 1, Amount: decimal.NewFromInt(100), Currency: "NGN"}
+}
+
+func TestPartner(t *testing.T) {
+	t.Run("stores a transaction and looks it up", func(t *testing.T) {
+		partner := fakepartner.NewPartner("", "")
+		server := httptest.NewServer(partner)
+		defer server.Close()
+		transactionExternal := newTestExternal(server, time.Second)
+
+		assert.NoError(t, transactionExternal.ForwardTransactionToThirdParty(newTestTransaction("TRX-1")))
+		transaction, err := transactionExternal.FetchTransactionDetailsFromThirdParty("TRX-1")
+
+		assert.NoError(t, err)
+		assert.True(t, transaction.Amount.Equal(decimal.NewFromInt(100)))
+		_, err = transactionExternal.FetchTransactionDetailsFromThirdParty("TRX-unknown")
+		assert.Error(t, err)
+	})
+
+	t.Run("scripted 5xx responses are retried", func(t *testing.T) {
+		partner := fakepartner.NewPartner("", "")
+		partner.SetFaults(fakepartner.Faults{FailNext: 2, FailStatus: http.StatusServiceUnavailable})
+		server := httptest.NewServer(partner)
+		defer server.Close()
+
+		err := newTestExternal(server, time.Second).ForwardTransactionToThirdParty(newTestTransaction("TRX-2"))
+
+		assert.NoError(t, err)
+		assert.NotNil(t, partner.Transaction("TRX-2"))
+		assert.Equal(t, 1, partner.Received())
+	})
+
+	t.Run("a failure after accepting leads to a duplicate that is deduplicated", func(t *testing.T) {
+		partner := fakepartner.NewPartner("", "")
+		partner.SetFaults(fakepartner.Faults{AcceptThenFail: 1})
+		server := httptest.NewServer(partner)
+		defer server.Close()
+
+		err := newTestExternal(server, time.Second).ForwardTransactionToThirdParty(newTestTransaction("TRX-3"))
+
+		assert.NoError(t, err)
+		assert.Equal(t, 2, partner.Received())
+		assert.Equal(t, 1, partner.Duplicates())
+	})
+
+	t.Run("stalled requests time out", func(t *testing.T) {
+		partner := fakepartner.NewPartner("", "")
+		partner.SetFaults(fakepartner.Faults{Stall: time.Second})
+		server := httptest.NewServer(partner)
+		defer server.Close()
+		start := time.Now()
+
+		_, err := newTestExternal(server, 20*time.Millisecond).FetchTransactionDetailsFromThirdParty("TRX-4")
+
+		assert.Error(t, err)
+		assert.Less(t, time.Since(start), time.Second)
+	})
+
+	t.Run("latency delays the answer", func(t *testing.T) {
+		partner := fakepartner.NewPartner("", "")
+		partner.SetFaults(fakepartner.Faults{Latency: 30 * time.Millisecond})
+		server := httptest.NewServer(partner)
+		defer server.Close()
+		start := time.Now()
+
+		err := newTestExternal(server, time.Second).ForwardTransactionToThirdParty(newTestTransaction("TRX-5"))
+
+		assert.NoError(t, err)
+		assert.GreaterOrEqual(t, time.Since(start), 30*time.Millisecond)
+	})
+
+	t.Run("accepted transactions are confirmed with signed callbacks unless they are dropped", func(t *testing.T) {
+		events := make(chan dto.PartnerWebhookDTO, 3)
+		verifier := webhooks.NewVerifier("secret", time.Minute)
+		bank := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ := io.ReadAll(r.Body)
+			if err := verifier.Verify(r.Header, body, time.Now()); err != nil {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			var event dto.PartnerWebhookDTO
+			json.Unmarshal(body, &event)
+			events <- event
+		}))
+		defer bank.Close()
+		partner := fakepartner.NewPartner(bank.URL, "secret")
+		server := httptest.NewServer(partner)
+		defer server.Close()
+		transactionExternal := newTestExternal(server, time.Second)
+
+		assert.NoError(t, transactionExternal.ForwardTransactionToThirdParty(newTestTransaction("TRX-6")))
+		partner.Close()
+		partner.SetFaults(fakepartner.Faults{DeclineNext: 1})
+		assert.NoError(t, transactionExternal.ForwardTransactionToThirdParty(newTestTransaction("TRX-7")))
+		partner.Close()
+		partner.SetFaults(fakepartner.Faults{DropCallbacks: true})
+		assert.NoError(t, transactionExternal.ForwardTransactionToThirdParty(newTestTransaction("TRX-8")))
+		partner.Close()
+
+		assert.Len(t, events, 2)
+		completed, declined := <-events, <-events
+		assert.Equal(t, "TRX-6", completed.Reference)
+		assert.Equal(t, constants.PartnerEventCompleted, completed.Status)
+		assert.NotEmpty(t, completed.EventID)
+		assert.Equal(t, "TRX-7", declined.Reference)
+		assert.Equal(t, constants.PartnerEventFailed, declined.Status)
+	})
+
+	t.Run("faults can be scripted over HTTP", func(t *testing.T) {
+		partner := fakepartner.NewPartner("", "")
+		server := httptest.NewServer(partner)
+		defer server.Close()
+		body := []byte(`{"latency": "15ms", "fail_next": 1, "fail_status": 502}`)
+		req, _ := http.NewRequest(http.MethodPut, server.URL+"/_faults", bytes.NewReader(body))
+
+		resp, err := http.DefaultClient.Do(req)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, fakepartner.Faults{Latency: 15 * time.Millisecond, FailNext: 1, FailStatus: http.StatusBadGateway}, partner.Faults())
+		resp, _ = http.Post(server.URL+"/transactions", "application/json", bytes.NewReader([]byte(`{"reference": "TRX-10"}`)))
+		assert.Equal(t, http.StatusBadGateway, resp.StatusCode)
+	})
+
+	t.Run("reusing a reference under another key is refused", func(t *testing.T) {
+		partner := fakepartner.NewPartner("", "")
+		data, _ := json.Marshal(dto.ForwardTransactionDTO{Reference: "TRX-9"})
+		first := httptest.NewRequest(http.MethodPost, "/transactions", bytes.NewReader(data))
+		first.Header.Set("Idempotency-Key", "first")
+		partner.ServeHTTP(httptest.NewRecorder(), first)
+		req := httptest.NewRequest(http.MethodPost, "/transactions", bytes.NewReader(data))
+		req.Header.Set("Idempotency-Key", "second")
+		rr := httptest.NewRecorder()
+
+		partner.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusConflict, rr.Code)
+	})
+}
@@ -0,0 +1,150 @@
+package fx_test
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/midedickson/simple-banking-app/constants"
+	"github.com/midedickson/simple-banking-app/fx"
+	"github.com/midedickson/simple-banking-app/models"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func TestStaticRateProvider(t *testing.T) {
+	provider := fx.NewStaticRateProvider(map[string]decimal.Decimal{
+		"usd/ngn": decimal.NewFromInt(1600),
+	})
+
+	t.Run("direct pair", func(t *testing.T) {
+		rate, err := provider.Rate("USD", "NGN")
+
+		assert.NoError(t, err)
+		assert.True(t, rate.Equal(decimal.NewFromInt(1600)))
+	})
+
+	t.Run("inverse pair", func(t *testing.T) {
+		rate, err := provider.Rate("NGN", "USD")
+
+		assert.NoError(t, err)
+		assert.True(t, rate.Equal(decimal.RequireFromString("0.000625")), rate.String())
+	})
+
+	t.Run("unknown pair", func(t *testing.T) {
+		_, err := provider.Rate("USD", "KES")
+
+		assert.ErrorIs(t, err, constants.ErrRateUnavailable)
+	})
+}
+
+func TestFileRateProvider(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rates.json")
+	err := os.WriteFile(path, []byte(`{"EUR/NGN": "1700.50"}`), 0o600)
+	assert.NoError(t, err)
+
+	provider, err := fx.NewFileRateProvider(path)
+
+	assert.NoError(t, err)
+	rate, err := provider.Rate("EUR", "NGN")
+	assert.NoError(t, err)
+	assert.True(t, rate.Equal(decimal.RequireFromString("1700.50")))
+}
+
+func newTestDB(t *testing.T) *gorm.DB {
+	db, err := gorm.Open(sqlite.Open(fmt.Sprintf("file:%s?mode=memory&cache=shared", t.Name())), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&models.FXQuote{}); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestQuoter(t *testing.T) {
+	provider := fx.NewStaticRateProvider(map[string]decimal.Decimal{
+		"USD/NGN": decimal.NewFromInt(1500),
+	})
+
+	t.Run("spread is taken off the mid rate", func(t *testing.T) {
+		quoter := fx.NewQuoter(newTestDB(t), provider, decimal.RequireFromString("0.01"), time.Minute)
+
+		quote, err := quoter.NewQuote("USD", "NGN")
+
+		assert.NoError(t, err)
+		assert.True(t, quote.Rate.Equal(decimal.NewFromInt(1485)), quote.Rate.String())
+		assert.True(t, quote.Convert(decimal.RequireFromString("10.01"), 2).Equal(decimal.RequireFromString("14864.85")))
+	})
+
+	t.Run("quote is visible to another quoter on the same database", func(t *testing.T) {
+		db := newTestDB(t)
+		quote, _ := fx.NewQuoter(db, provider, decimal.RequireFromString("0.01"), time.Minute).NewQuote("USD", "NGN")
+
+		fetched, err := fx.NewQuoter(db, provider, decimal.Zero, time.Minute).FetchQuote(quote.ID)
+
+		assert.NoError(t, err)
+		assert.True(t, fetched.Rate.Equal(quote.Rate), fetched.Rate.String())
+	})
+
+	t.Run("quote can only be consumed once", func(t *testing.T) {
+		db := newTestDB(t)
+		quoter := fx.NewQuoter(db, provider, decimal.Zero, time.Minute)
+		quote, _ := quoter.NewQuote("USD", "NGN")
+
+		_, err := quoter.FetchQuote(quote.ID)
+		assert.NoError(t, err)
+		_, err = fx.ConsumeQuote(db, quote.ID, "TRF-1")
+		assert.NoError(t, err)
+		_, err = fx.ConsumeQuote(db, quote.ID, "TRF-2")
+		assert.ErrorIs(t, err, constants.ErrQuoteUsed)
+		_, err = quoter.FetchQuote(quote.ID)
+		assert.ErrorIs(t, err, constants.ErrQuoteUsed)
+	})
+
+	t.Run("rolled back consumption leaves the quote usable", func(t *testing.T) {
+		db := newTestDB(t)
+		quoter := fx.NewQuoter(db, provider, decimal.Zero, time.Minute)
+		quote, _ := quoter.NewQuote("USD", "NGN")
+
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if _, err := fx.ConsumeQuote(tx, quote.ID, "TRF-1"); err != nil {
+				return err
+			}
+			return assert.AnError
+		})
+
+		assert.ErrorIs(t, err, assert.AnError)
+		_, err = fx.ConsumeQuote(db, quote.ID, "TRF-2")
+		assert.NoError(t, err)
+	})
+
+	t.Run("unknown quote is rejected", func(t *testing.T) {
+		db := newTestDB(t)
+
+		_, err := fx.NewQuoter(db, provider, decimal.Zero, time.Minute).FetchQuote("missing")
+
+		assert.ErrorIs(t, err, constants.ErrQuoteNotFound)
+		_, err = fx.ConsumeQuote(db, "missing", "TRF-1")
+		assert.ErrorIs(t, err, constants.ErrQuoteNotFound)
+	})
+
+	t.Run("expired quote is rejected", func(t *testing.T) {
+		db := newTestDB(t)
+		quoter := fx.NewQuoter(db, provider, decimal.Zero, -time.Second)
+		quote, _ := quoter.NewQuote("USD", "NGN")
+
+		_, err := quoter.FetchQuote(quote.ID)
+
+		assert.ErrorIs(t, err, constants.ErrQuoteExpired)
+		_, err = fx.ConsumeQuote(db, quote.ID, "TRF-1")
+		assert.ErrorIs(t, err, constants.ErrQuoteExpired)
+	})
+}
@@ -0,0 +1,59 @@
+package holds_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/midedickson/simple-banking-app/constants"
+	"github.com/midedickson/simple-banking-app/holds"
+	"github.com/midedickson/simple-banking-app/models"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func newTestDB(t *testing.T) *gorm.DB {
+	db, err := gorm.Open(sqlite.Open(fmt.Sprintf("file:%s?mode=memory&cache=shared", t.Name())), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&models.UserAccount{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Create(&models.UserAccount{ID: 1, Balance: decimal.NewFromInt(400), Currency: "NGN", Status: constants.AccountStatusActive}).Error; err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestFunds(t *testing.T) {
+	t.Run("reserve refuses more than the available balance", func(t *testing.T) {
+		db := newTestDB(t)
+
+		assert.NoError(t, holds.Reserve(db, 1, decimal.NewFromInt(300)))
+		assert.ErrorIs(t, holds.Reserve(db, 1, decimal.NewFromInt(200)), constants.ErrInsufficientFunds)
+
+		var account models.UserAccount
+		db.First(&account, 1)
+		assert.True(t, account.Held.Equal(decimal.NewFromInt(300)), account.Held.String())
+	})
+
+	t.Run("release writes only the funds columns", func(t *testing.T) {
+		db := newTestDB(t)
+		assert.NoError(t, holds.Reserve(db, 1, decimal.NewFromInt(300)))
+		// a change made elsewhere to a column the release does not own
+		assert.NoError(t, db.Model(&models.UserAccount{}).Where("id = ?", 1).Update("status", constants.AccountStatusFrozen).Error)
+
+		assert.NoError(t, holds.Release(db, 1, decimal.NewFromInt(100)))
+
+		var account models.UserAccount
+		db.First(&account, 1)
+		assert.Equal(t, constants.AccountStatusFrozen, account.Status)
+		assert.True(t, account.Held.Equal(decimal.NewFromInt(200)), account.Held.String())
+		assert.True(t, account.Balance.Equal(decimal.NewFromInt(400)))
+	})
+}
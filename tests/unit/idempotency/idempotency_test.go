@@ -0,0 +1,307 @@
+package idempotency_test
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/midedickson/simple-banking-app/constants"
+	"github.com/midedickson/simple-banking-app/idempotency"
+	"github.com/midedickson/simple-banking-app/models"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func newTestDBStore(t *testing.T) *idempotency.DBIdempotencyStore {
+	db, err := gorm.Open(sqlite.Open(fmt.Sprintf("file:%s?mode=memory&cache=shared", t.Name())), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&models.IdempotencyKey{}); err != nil {
+		t.Fatal(err)
+	}
+	return idempotency.NewDBIdempotencyStore(db, time.Hour, time.Minute)
+}
+
+func TestIdempotencyStores(t *testing.T) {
+	stores := map[string]func(t *testing.T) idempotency.IdempotencyStore{
+		"memory": func(t *testing.T) idempotency.IdempotencyStore {
+			return idempotency.NewIdempotencyStore(time.Hour, time.Minute)
+		},
+		"database": func(t *testing.T) idempotency.IdempotencyStore {
+			return newTestDBStore(t)
+		},
+	}
+
+	for name, newStore := range stores {
+		t.Run(name+" new key is waiting", func(t *testing.T) {
+			store := newStore(t)
+
+			key, err := store.CreateNewIdempotencyKey()
+
+			assert.NoError(t, err)
+			status, err := store.CheckIdempotencyKeyStatus(key)
+			assert.NoError(t, err)
+			assert.Equal(t, constants.WAITING, status)
+		})
+
+		t.Run(name+" client key is registered on first use", func(t *testing.T) {
+			store := newStore(t)
+
+			registered, err := store.RegisterIdempotencyKey("01J9Z8Q6X3V1T4N5B2C7D8E9FA")
+			assert.NoError(t, err)
+			assert.True(t, registered)
+			status, _ := store.CheckIdempotencyKeyStatus("01J9Z8Q6X3V1T4N5B2C7D8E9FA")
+			assert.Equal(t, constants.WAITING, status)
+
+			lease, _, _ := store.ClaimIdempotencyKey("01J9Z8Q6X3V1T4N5B2C7D8E9FA", constants.WAITING)
+			store.CompleteIdempotencyKey("01J9Z8Q6X3V1T4N5B2C7D8E9FA", lease, 200, nil)
+			registered, err = store.RegisterIdempotencyKey("01J9Z8Q6X3V1T4N5B2C7D8E9FA")
+			assert.NoError(t, err)
+			assert.False(t, registered)
+			status, _ = store.CheckIdempotencyKeyStatus("01J9Z8Q6X3V1T4N5B2C7D8E9FA")
+			assert.Equal(t, constants.SUCCESS, status)
+		})
+
+		t.Run(name+" sweeping removes expired keys", func(t *testing.T) {
+			store := newStore(t)
+			expired, _ := store.CreateNewIdempotencyKey()
+			processing, _ := store.CreateNewIdempotencyKey()
+			store.ClaimIdempotencyKey(processing, constants.WAITING)
+
+			removed, err := store.SweepExpiredIdempotencyKeys(time.Now())
+			assert.NoError(t, err)
+			assert.Equal(t, 0, removed)
+
+			removed, err = store.SweepExpiredIdempotencyKeys(time.Now().Add(2 * time.Hour))
+			assert.NoError(t, err)
+			assert.Equal(t, 1, removed)
+			_, err = store.CheckIdempotencyKeyStatus(expired)
+			assert.Error(t, err)
+			status, _ := store.CheckIdempotencyKeyStatus(processing)
+			assert.Equal(t, constants.PROCESSING, status)
+		})
+
+		t.Run(name+" unknown key", func(t *testing.T) {
+			store := newStore(t)
+
+			_, err := store.CheckIdempotencyKeyStatus("unknown")
+			assert.Error(t, err)
+			assert.Error(t, store.UpdateIdempotencyKeyStatus("unknown", "lease", constants.SUCCESS))
+			_, _, err = store.ClaimIdempotencyKey("unknown", constants.WAITING)
+			assert.Error(t, err)
+		})
+
+		t.Run(name+" completed key keeps its response", func(t *testing.T) {
+			store := newStore(t)
+			key, _ := store.CreateNewIdempotencyKey()
+			lease, _, _ := store.ClaimIdempotencyKey(key, constants.WAITING)
+			response := []byte(`{"success":true}`)
+
+			err := store.CompleteIdempotencyKey(key, lease, 200, response)
+
+			assert.NoError(t, err)
+			status, _ := store.CheckIdempotencyKeyStatus(key)
+			assert.Equal(t, constants.SUCCESS, status)
+			statusCode, body, err := store.FetchIdempotencyKeyResponse(key)
+			assert.NoError(t, err)
+			assert.Equal(t, 200, statusCode)
+			assert.Equal(t, response, body)
+		})
+
+		t.Run(name+" key is bound to the first fingerprint", func(t *testing.T) {
+			store := newStore(t)
+			key, _ := store.CreateNewIdempotencyKey()
+
+			matches, err := store.BindIdempotencyKeyFingerprint(key, "first")
+			assert.NoError(t, err)
+			assert.True(t, matches)
+			matches, _ = store.BindIdempotencyKeyFingerprint(key, "first")
+			assert.True(t, matches)
+			matches, _ = store.BindIdempotencyKeyFingerprint(key, "second")
+			assert.False(t, matches)
+		})
+
+		t.Run(name+" expired lease releases the key for retry", func(t *testing.T) {
+			store := newStore(t)
+			key, _ := store.CreateNewIdempotencyKey()
+			_, claimed, err := store.ClaimIdempotencyKey(key, constants.WAITING)
+			assert.NoError(t, err)
+			assert.True(t, claimed)
+
+			released, err := store.ExpireIdempotencyKeyLeases(time.Now())
+			assert.NoError(t, err)
+			assert.Equal(t, 0, released)
+
+			released, err = store.ExpireIdempotencyKeyLeases(time.Now().Add(2 * time.Minute))
+			assert.NoError(t, err)
+			assert.Equal(t, 1, released)
+			status, _ := store.CheckIdempotencyKeyStatus(key)
+			assert.Equal(t, constants.CAN_RETRY, status)
+
+			_, claimed, err = store.ClaimIdempotencyKey(key, constants.CAN_RETRY)
+			assert.NoError(t, err)
+			assert.True(t, claimed)
+			_, claimed, _ = store.ClaimIdempotencyKey(key, constants.CAN_RETRY)
+			assert.False(t, claimed)
+		})
+
+		t.Run(name+" a lost lease cannot change the key", func(t *testing.T) {
+			store := newStore(t)
+			key, _ := store.CreateNewIdempotencyKey()
+			stale, _, _ := store.ClaimIdempotencyKey(key, constants.WAITING)
+			store.ExpireIdempotencyKeyLeases(time.Now().Add(2 * time.Minute))
+			current, _, _ := store.ClaimIdempotencyKey(key, constants.CAN_RETRY)
+			assert.NotEqual(t, stale, current)
+
+			assert.ErrorIs(t, store.UpdateIdempotencyKeyStatus(key, stale, constants.FAILED), idempotency.ErrIdempotencyKeyLeaseLost)
+			assert.ErrorIs(t, store.CompleteIdempotencyKey(key, stale, 200, []byte(`{"stale":true}`)), idempotency.ErrIdempotencyKeyLeaseLost)
+			renewed, err := store.RenewIdempotencyKeyLease(key, stale)
+			assert.NoError(t, err)
+			assert.False(t, renewed)
+			status, _ := store.CheckIdempotencyKeyStatus(key)
+			assert.Equal(t, constants.PROCESSING, status)
+
+			assert.NoError(t, store.CompleteIdempotencyKey(key, current, 200, []byte(`{"current":true}`)))
+			_, body, _ := store.FetchIdempotencyKeyResponse(key)
+			assert.Equal(t, []byte(`{"current":true}`), body)
+		})
+
+		t.Run(name+" a renewed lease is not released", func(t *testing.T) {
+			store := newStore(t)
+			key, _ := store.CreateNewIdempotencyKey()
+			lease, _, _ := store.ClaimIdempotencyKey(key, constants.WAITING)
+			time.Sleep(10 * time.Millisecond)
+
+			renewed, err := store.RenewIdempotencyKeyLease(key, lease)
+
+			assert.NoError(t, err)
+			assert.True(t, renewed)
+			// the lease now runs a minute from the renewal, past the original deadline
+			released, _ := store.ExpireIdempotencyKeyLeases(time.Now().Add(time.Minute - 5*time.Millisecond))
+			assert.Zero(t, released)
+		})
+
+		t.Run(name+" waiting to processing happens only once", func(t *testing.T) {
+			store := newStore(t)
+			key, _ := store.CreateNewIdempotencyKey()
+
+			var wg sync.WaitGroup
+			var mu sync.Mutex
+			claims := 0
+			for i := 0; i < 10; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					_, claimed, err := store.ClaimIdempotencyKey(key, constants.WAITING)
+					assert.NoError(t, err)
+					if claimed {
+						mu.Lock()
+						claims++
+						mu.Unlock()
+					}
+				}()
+			}
+			wg.Wait()
+
+			assert.Equal(t, 1, claims)
+			status, _ := store.CheckIdempotencyKeyStatus(key)
+			assert.Equal(t, constants.PROCESSING, status)
+		})
+	}
+}
+
+func TestDBIdempotencyStoreIsShared(t *testing.T) {
+	first := newTestDBStore(t)
+	second := idempotency.NewDBIdempotencyStore(first.DB, time.Hour, time.Minute)
+	key, _ := first.CreateNewIdempotencyKey()
+
+	_, claimed, err := second.ClaimIdempotencyKey(key, constants.WAITING)
+	assert.NoError(t, err)
+	assert.True(t, claimed)
+
+	_, claimed, err = first.ClaimIdempotencyKey(key, constants.WAITING)
+	assert.NoError(t, err)
+	assert.False(t, claimed)
+}
+
+func TestKeepIdempotencyKeyLease(t *testing.T) {
+	store := idempotency.NewIdempotencyStore(time.Hour, 30*time.Millisecond)
+	key, _ := store.CreateNewIdempotencyKey()
+	lease, _, _ := store.ClaimIdempotencyKey(key, constants.WAITING)
+
+	stop := store.KeepIdempotencyKeyLease(key, lease)
+	time.Sleep(100 * time.Millisecond)
+	released, err := store.ExpireIdempotencyKeyLeases(time.Now())
+	stop()
+
+	assert.NoError(t, err)
+	assert.Zero(t, released)
+	assert.NoError(t, store.CompleteIdempotencyKey(key, lease, 200, nil))
+}
+
+func TestFingerprint(t *testing.T) {
+	fingerprint := func(method string, path string, body string) string {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		value, err := idempotency.Fingerprint(req)
+		assert.NoError(t, err)
+		return value
+	}
+
+	t.Run("formatting and key order do not matter", func(t *testing.T) {
+		first := fingerprint("POST", "/transaction/credit", `{"account_id": 1, "amount": "100.50"}`)
+		second := fingerprint("POST", "/transaction/credit", `{
+			"amount": "100.50",
+			"account_id": 1
+		}`)
+
+		assert.Equal(t, first, second)
+	})
+
+	t.Run("parameters matter", func(t *testing.T) {
+		original := fingerprint("POST", "/transaction/credit", `{"account_id": 1, "amount": "100.50"}`)
+
+		assert.NotEqual(t, original, fingerprint("POST", "/transaction/credit", `{"account_id": 2, "amount": "100.50"}`))
+		assert.NotEqual(t, original, fingerprint("POST", "/transaction/credit", `{"account_id": 1, "amount": "100.51"}`))
+		assert.NotEqual(t, original, fingerprint("POST", "/transaction/debit", `{"account_id": 1, "amount": "100.50"}`))
+	})
+
+	t.Run("body is still readable", func(t *testing.T) {
+		req := httptest.NewRequest("POST", "/transaction/credit", strings.NewReader(`{"account_id": 1}`))
+
+		_, err := idempotency.Fingerprint(req)
+
+		assert.NoError(t, err)
+		body, _ := io.ReadAll(req.Body)
+		assert.Equal(t, `{"account_id": 1}`, string(body))
+	})
+}
+
+func TestValidateIdempotencyKey(t *testing.T) {
+	assert.NoError(t, idempotency.ValidateIdempotencyKey("3f1c6a9e-2b7d-4e8a-9c1f-5d6e7a8b9c0d"))
+	assert.NoError(t, idempotency.ValidateIdempotencyKey("01J9Z8Q6X3V1T4N5B2C7D8E9FA"))
+	assert.ErrorIs(t, idempotency.ValidateIdempotencyKey(""), idempotency.ErrInvalidIdempotencyKey)
+	assert.ErrorIs(t, idempotency.ValidateIdempotencyKey("not a key!"), idempotency.ErrInvalidIdempotencyKey)
+	assert.ErrorIs(t, idempotency.ValidateIdempotencyKey(strings.Repeat("a", 65)), idempotency.ErrInvalidIdempotencyKey)
+}
+
+func TestIsTransientFailure(t *testing.T) {
+	assert.True(t, idempotency.IsTransientFailure(constants.ErrThirdPartyFailure))
+	assert.True(t, idempotency.IsTransientFailure(errors.New("database is locked")))
+	assert.False(t, idempotency.IsTransientFailure(constants.ErrInsufficientFunds))
+	assert.False(t, idempotency.IsTransientFailure(fmt.Errorf("%w: status 422", constants.ErrThirdPartyRejected)))
+	assert.False(t, idempotency.IsTransientFailure(constants.ErrQuoteUsed))
+	assert.False(t, idempotency.IsTransientFailure(constants.ErrRateUnavailable))
+	assert.False(t, idempotency.IsTransientFailure(fmt.Errorf("%w: user:1 holds 450 NGN but its postings sum to 400", constants.ErrBalanceDrift)))
+	assert.False(t, idempotency.IsTransientFailure(constants.ErrUnbalancedEntry))
+	assert.False(t, idempotency.IsTransientFailure(fmt.Errorf("settling: %w", constants.ErrCurrencyMismatch)))
+}
@@ -0,0 +1,88 @@
+package ledger_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/midedickson/simple-banking-app/constants"
+	"github.com/midedickson/simple-banking-app/ledger"
+	"github.com/midedickson/simple-banking-app/models"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func newTestDB(t *testing.T) *gorm.DB {
+	db, err := gorm.Open(sqlite.Open(fmt.Sprintf("file:%s?mode=memory&cache=shared", t.Name())), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&models.JournalEntry{}, &models.Posting{}); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestPost(t *testing.T) {
+	t.Run("balanced entry updates derived balances", func(t *testing.T) {
+		db := newTestDB(t)
+
+		_, err := ledger.Post(db, "TRX-1", "credit", ledger.Transfer(ledger.SettlementAccount, ledger.UserAccount(1), decimal.NewFromFloat(100.25), "NGN")...)
+		assert.NoError(t, err)
+		_, err = ledger.Post(db, "TRX-2", "debit", ledger.Transfer(ledger.UserAccount(1), ledger.SettlementAccount, decimal.NewFromFloat(40.0), "NGN")...)
+		assert.NoError(t, err)
+
+		balance, err := ledger.Balance(db, ledger.UserAccount(1), "NGN")
+		assert.NoError(t, err)
+		assert.True(t, balance.Equal(decimal.NewFromFloat(60.25)), balance.String())
+		settlementBalance, _ := ledger.Balance(db, ledger.SettlementAccount, "NGN")
+		assert.True(t, settlementBalance.Equal(decimal.NewFromFloat(-60.25)), settlementBalance.String())
+		trialBalance, _ := ledger.TrialBalance(db, "NGN")
+		assert.True(t, trialBalance.IsZero())
+	})
+
+	t.Run("unbalanced entry is rejected", func(t *testing.T) {
+		db := newTestDB(t)
+
+		_, err := ledger.Post(db, "TRX-3", "credit",
+			models.Posting{Account: ledger.UserAccount(1), Amount: decimal.NewFromFloat(100.0), Currency: "NGN"},
+			models.Posting{Account: ledger.SettlementAccount, Amount: decimal.NewFromFloat(-99.99), Currency: "NGN"},
+		)
+
+		assert.ErrorIs(t, err, constants.ErrUnbalancedEntry)
+		balance, _ := ledger.Balance(db, ledger.UserAccount(1), "NGN")
+		assert.True(t, balance.IsZero())
+	})
+
+	t.Run("postings in different currencies do not offset", func(t *testing.T) {
+		db := newTestDB(t)
+
+		_, err := ledger.Post(db, "TRX-5", "transfer",
+			models.Posting{Account: ledger.UserAccount(1), Amount: decimal.NewFromFloat(-100.0), Currency: "USD"},
+			models.Posting{Account: ledger.UserAccount(2), Amount: decimal.NewFromFloat(100.0), Currency: "NGN"},
+		)
+
+		assert.ErrorIs(t, err, constants.ErrUnbalancedEntry)
+	})
+
+	t.Run("single posting is rejected", func(t *testing.T) {
+		db := newTestDB(t)
+
+		_, err := ledger.Post(db, "TRX-4", "credit", models.Posting{Account: ledger.SettlementAccount, Amount: decimal.Zero, Currency: "NGN"})
+
+		assert.Error(t, err)
+	})
+}
+
+func TestCheckBalance(t *testing.T) {
+	db := newTestDB(t)
+	_, err := ledger.Post(db, "TRX-1", "credit", ledger.Transfer(ledger.SettlementAccount, ledger.UserAccount(1), decimal.NewFromFloat(100.25), "NGN")...)
+	assert.NoError(t, err)
+
+	assert.NoError(t, ledger.CheckBalance(db, ledger.UserAccount(1), "NGN", decimal.NewFromFloat(100.25)))
+	assert.ErrorIs(t, ledger.CheckBalance(db, ledger.UserAccount(1), "NGN", decimal.NewFromFloat(100.0)), constants.ErrBalanceDrift)
+}
@@ -0,0 +1,190 @@
+package outbox_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/midedickson/simple-banking-app/constants"
+	"github.com/midedickson/simple-banking-app/dto"
+	"github.com/midedickson/simple-banking-app/models"
+	"github.com/midedickson/simple-banking-app/outbox"
+	"github.com/midedickson/simple-banking-app/repository"
+	"github.com/midedickson/simple-banking-app/tests/mocks"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func newTestRepository(t *testing.T) *repository.StorageRepository {
+	db, err := gorm.Open(sqlite.Open(fmt.Sprintf("file:%s?mode=memory&cache=shared", t.Name())), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&models.Transaction{}, &models.UserAccount{}, &models.JournalEntry{}, &models.Posting{}, &models.OutboxEntry{}); err != nil {
+		t.Fatal(err)
+	}
+	repo := repository.NewStorageRepository(db)
+	if err := repo.SeedUserAccounts([]*models.UserAccount{{ID: 1, Balance: decimal.NewFromInt(400)}}); err != nil {
+		t.Fatal(err)
+	}
+	return repo
+}
+
+func fetchEntry(t *testing.T, repo *repository.StorageRepository, transaction *models.Transaction) models.OutboxEntry {
+	var entry models.OutboxEntry
+	if err := repo.DB.Where("transaction_id = ?", transaction.ID).First(&entry).Error; err != nil {
+		t.Fatal(err)
+	}
+	return entry
+}
+
+func TestDispatcher(t *testing.T) {
+	t.Run("delivered transaction is settled", func(t *testing.T) {
+		repo := newTestRepository(t)
+		mockExternal := new(mocks.MockExternal)
+		dispatcher := outbox.NewDispatcher(repo.DB, mockExternal, repo, 3)
+		transaction, _ := repo.CreateTransaction(&dto.CreateDBTransactionDTO{AccountID: 1, Amount: decimal.NewFromInt(100), Direction: constants.DirectionCredit, Currency: "NGN"})
+		mockExternal.On("ForwardTransactionToThirdParty", mock.Anything).Return(nil).Once()
+
+		delivered, err := dispatcher.DispatchDue(time.Now())
+
+		assert.NoError(t, err)
+		assert.Equal(t, 1, delivered)
+		assert.Equal(t, constants.SUCCESS, repo.FetchTransactionDetailsByReference(transaction.Reference).Status)
+		assert.True(t, repo.FindAccountById(1).Balance.Equal(decimal.NewFromInt(500)))
+		assert.Equal(t, constants.OutboxDelivered, fetchEntry(t, repo, transaction).Status)
+		mockExternal.AssertExpectations(t)
+	})
+
+	t.Run("transient failure is retried after a backoff", func(t *testing.T) {
+		repo := newTestRepository(t)
+		mockExternal := new(mocks.MockExternal)
+		dispatcher := outbox.NewDispatcher(repo.DB, mockExternal, repo, 3)
+		transaction, _ := repo.CreateTransaction(&dto.CreateDBTransactionDTO{AccountID: 1, Amount: decimal.NewFromInt(100), Direction: constants.DirectionCredit, Currency: "NGN"})
+		mockExternal.On("ForwardTransactionToThirdParty", mock.Anything).Return(constants.ErrThirdPartyFailure).Once()
+		now := time.Now()
+
+		delivered, _ := dispatcher.DispatchDue(now)
+
+		assert.Equal(t, 0, delivered)
+		entry := fetchEntry(t, repo, transaction)
+		assert.Equal(t, constants.OutboxPending, entry.Status)
+		assert.Equal(t, 1, entry.Attempts)
+		assert.Equal(t, constants.ErrThirdPartyFailure.Error(), entry.LastError)
+		assert.Equal(t, "pending", repo.FetchTransactionDetailsByReference(transaction.Reference).Status)
+
+		delivered, _ = dispatcher.DispatchDue(now)
+		assert.Equal(t, 0, delivered)
+
+		// the first attempt never reached the third party, so the retry sends it again
+		mockExternal.On("FetchTransactionDetailsFromThirdParty", transaction.Reference).Return(nil, constants.ErrThirdPartyFailure).Once()
+		mockExternal.On("ForwardTransactionToThirdParty", mock.Anything).Return(nil).Once()
+		delivered, _ = dispatcher.DispatchDue(now.Add(2 * time.Second))
+
+		assert.Equal(t, 1, delivered)
+		assert.Equal(t, constants.SUCCESS, repo.FetchTransactionDetailsByReference(transaction.Reference).Status)
+		mockExternal.AssertExpectations(t)
+	})
+
+	t.Run("retry does not send a transaction the third party already has", func(t *testing.T) {
+		repo := newTestRepository(t)
+		mockExternal := new(mocks.MockExternal)
+		dispatcher := outbox.NewDispatcher(repo.DB, mockExternal, repo, 3)
+		transaction, _ := repo.CreateTransaction(&dto.CreateDBTransactionDTO{AccountID: 1, Amount: decimal.NewFromInt(100), Direction: constants.DirectionCredit, Currency: "NGN"})
+		mockExternal.On("ForwardTransactionToThirdParty", mock.Anything).Return(constants.ErrThirdPartyFailure).Once()
+		now := time.Now()
+		dispatcher.DispatchDue(now)
+
+		mockExternal.On("FetchTransactionDetailsFromThirdParty", transaction.Reference).Return(&dto.ForwardTransactionDTO{Reference: transaction.Reference}, nil).Once()
+		delivered, _ := dispatcher.DispatchDue(now.Add(2 * time.Second))
+
+		assert.Equal(t, 1, delivered)
+		mockExternal.AssertNumberOfCalls(t, "ForwardTransactionToThirdParty", 1)
+		assert.Equal(t, constants.SUCCESS, repo.FetchTransactionDetailsByReference(transaction.Reference).Status)
+	})
+
+	t.Run("entry is given up after the last attempt", func(t *testing.T) {
+		repo := newTestRepository(t)
+		mockExternal := new(mocks.MockExternal)
+		dispatcher := outbox.NewDispatcher(repo.DB, mockExternal, repo, 1)
+		transaction, _ := repo.CreateTransaction(&dto.CreateDBTransactionDTO{AccountID: 1, Amount: decimal.NewFromInt(100), Direction: constants.DirectionCredit, Currency: "NGN"})
+		mockExternal.On("ForwardTransactionToThirdParty", mock.Anything).Return(constants.ErrThirdPartyFailure).Once()
+
+		dispatcher.DispatchDue(time.Now())
+
+		assert.Equal(t, constants.OutboxFailed, fetchEntry(t, repo, transaction).Status)
+		assert.Equal(t, constants.FAILED, repo.FetchTransactionDetailsByReference(transaction.Reference).Status)
+	})
+
+	t.Run("transaction the third party rejects is not sent again", func(t *testing.T) {
+		repo := newTestRepository(t)
+		mockExternal := new(mocks.MockExternal)
+		dispatcher := outbox.NewDispatcher(repo.DB, mockExternal, repo, 10)
+		transaction, _ := repo.CreateTransaction(&dto.CreateDBTransactionDTO{AccountID: 1, Amount: decimal.NewFromInt(100), Direction: constants.DirectionCredit, Currency: "NGN"})
+		mockExternal.On("ForwardTransactionToThirdParty", mock.Anything).Return(fmt.Errorf("%w: status 422", constants.ErrThirdPartyRejected)).Once()
+
+		dispatcher.DispatchDue(time.Now())
+
+		entry := fetchEntry(t, repo, transaction)
+		assert.Equal(t, constants.OutboxFailed, entry.Status)
+		assert.Equal(t, 1, entry.Attempts)
+		assert.Equal(t, constants.FAILED, repo.FetchTransactionDetailsByReference(transaction.Reference).Status)
+	})
+
+	t.Run("debit the third party rejects releases its held amount", func(t *testing.T) {
+		repo := newTestRepository(t)
+		mockExternal := new(mocks.MockExternal)
+		dispatcher := outbox.NewDispatcher(repo.DB, mockExternal, repo, 3)
+		transaction, _ := repo.CreateTransaction(&dto.CreateDBTransactionDTO{AccountID: 1, Amount: decimal.NewFromInt(300), Direction: constants.DirectionDebit, Currency: "NGN"})
+		assert.True(t, repo.FindAccountById(1).Held.Equal(decimal.NewFromInt(300)))
+		mockExternal.On("ForwardTransactionToThirdParty", mock.Anything).Return(constants.ErrThirdPartyRejected).Once()
+
+		delivered, _ := dispatcher.DispatchDue(time.Now())
+
+		assert.Equal(t, 0, delivered)
+		assert.Equal(t, constants.OutboxFailed, fetchEntry(t, repo, transaction).Status)
+		assert.Equal(t, constants.FAILED, repo.FetchTransactionDetailsByReference(transaction.Reference).Status)
+		account := repo.FindAccountById(1)
+		assert.True(t, account.Balance.Equal(decimal.NewFromInt(400)))
+		assert.True(t, account.Held.IsZero())
+	})
+	t.Run("open circuit breaker does not use up an attempt", func(t *testing.T) {
+		repo := newTestRepository(t)
+		mockExternal := new(mocks.MockExternal)
+		dispatcher := outbox.NewDispatcher(repo.DB, mockExternal, repo, 1)
+		first, _ := repo.CreateTransaction(&dto.CreateDBTransactionDTO{AccountID: 1, Amount: decimal.NewFromInt(100), Direction: constants.DirectionCredit, Currency: "NGN"})
+		second, _ := repo.CreateTransaction(&dto.CreateDBTransactionDTO{AccountID: 1, Amount: decimal.NewFromInt(50), Direction: constants.DirectionCredit, Currency: "NGN"})
+		mockExternal.On("ForwardTransactionToThirdParty", mock.Anything).Return(constants.ErrThirdPartyUnavailable).Once()
+
+		delivered, _ := dispatcher.DispatchDue(time.Now())
+
+		assert.Equal(t, 0, delivered)
+		entry := fetchEntry(t, repo, first)
+		assert.Equal(t, constants.OutboxPending, entry.Status)
+		assert.Equal(t, 0, entry.Attempts)
+		// the rest of the batch waits for the breaker instead of failing the same way
+		assert.Equal(t, 0, fetchEntry(t, repo, second).Attempts)
+		mockExternal.AssertNumberOfCalls(t, "ForwardTransactionToThirdParty", 1)
+		assert.Equal(t, "pending", repo.FetchTransactionDetailsByReference(first.Reference).Status)
+	})
+	t.Run("without a settler the transaction waits for confirmation", func(t *testing.T) {
+		repo := newTestRepository(t)
+		mockExternal := new(mocks.MockExternal)
+		dispatcher := outbox.NewDispatcher(repo.DB, mockExternal, nil, 3)
+		transaction, _ := repo.CreateTransaction(&dto.CreateDBTransactionDTO{AccountID: 1, Amount: decimal.NewFromInt(100), Direction: constants.DirectionCredit, Currency: "NGN"})
+		mockExternal.On("ForwardTransactionToThirdParty", mock.Anything).Return(nil).Once()
+
+		delivered, _ := dispatcher.DispatchDue(time.Now())
+
+		assert.Equal(t, 1, delivered)
+		assert.Equal(t, constants.OutboxDelivered, fetchEntry(t, repo, transaction).Status)
+		assert.Equal(t, "pending", repo.FetchTransactionDetailsByReference(transaction.Reference).Status)
+		assert.True(t, repo.FindAccountById(1).Balance.Equal(decimal.NewFromInt(400)))
+	})
+}
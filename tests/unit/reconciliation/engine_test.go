@@ -0,0 +1,164 @@
+package reconciliation_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/midedickson/simple-banking-app/constants"
+	"github.com/midedickson/simple-banking-app/dto"
+	"github.com/midedickson/simple-banking-app/models"
+	"github.com/midedickson/simple-banking-app/reconciliation"
+	"github.com/midedickson/simple-banking-app/repository"
+	"github.com/midedickson/simple-banking-app/tests/mocks"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func newTestRepository(t *testing.T) *repository.StorageRepository {
+	db, err := gorm.Open(sqlite.Open(fmt.Sprintf("file:%s?mode=memory&cache=shared", t.Name())), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.AutoMigrate(&models.Transaction{}, &models.UserAccount{}, &models.JournalEntry{}, &models.Posting{}, &models.OutboxEntry{}, &models.ReconciliationReport{}, &models.ReconciliationItem{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo := repository.NewStorageRepository(db)
+	if err := repo.SeedUserAccounts([]*models.UserAccount{{ID: 1, Balance: decimal.NewFromInt(400)}, {ID: 2, Balance: decimal.NewFromInt(400)}}); err != nil {
+		t.Fatal(err)
+	}
+	return repo
+}
+
+func createTransaction(t *testing.T, repo *repository.StorageRepository, amount int64, status string) *models.Transaction {
+	transaction, err := repo.CreateTransaction(&dto.CreateDBTransactionDTO{AccountID: 1, Amount: decimal.NewFromInt(amount), Direction: constants.DirectionCredit, Currency: "NGN"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status != "pending" {
+		repo.DB.Model(transaction).Update("status", status)
+	}
+	return transaction
+}
+
+func remoteRecord(transaction *models.Transaction, amount int64, status string) *dto.ForwardTransactionDTO {
+	return &dto.ForwardTransactionDTO{Reference: transaction.Reference, AccountID: transaction.AccountID, Amount: decimal.NewFromInt(amount), Currency: "NGN", Status: status}
+}
+
+func results(report *models.ReconciliationReport) map[string]string {
+	byReference := map[string]string{}
+	for _, item := range report.Items {
+		byReference[item.Reference] = item.Result
+	}
+	return byReference
+}
+
+func TestReconciliation(t *testing.T) {
+	from, to := time.Now().Add(-time.Hour), time.Now().Add(time.Hour)
+
+	t.Run("classifies transactions against the partner API", func(t *testing.T) {
+		repo := newTestRepository(t)
+		mockExternal := new(mocks.MockExternal)
+		engine := reconciliation.NewEngine(repo.DB, mockExternal)
+		matched := createTransaction(t, repo, 100, constants.SUCCESS)
+		missing := createTransaction(t, repo, 50, constants.SUCCESS)
+		wrongAmount := createTransaction(t, repo, 70, constants.SUCCESS)
+		wrongStatus := createTransaction(t, repo, 30, constants.FAILED)
+		neverSent := createTransaction(t, repo, 20, constants.FAILED)
+		repo.CreateTransfer(&dto.CreateDBTransferDTO{SourceAccountID: 1, DestinationAccountID: 2, Amount: decimal.NewFromInt(10), DestinationAmount: decimal.NewFromInt(10)})
+		mockExternal.On("FetchTransactionDetailsFromThirdParty", matched.Reference).Return(remoteRecord(matched, 100, constants.PartnerEventCompleted), nil)
+		mockExternal.On("FetchTransactionDetailsFromThirdParty", missing.Reference).Return(nil, constants.ErrThirdPartyTransactionNotFound)
+		mockExternal.On("FetchTransactionDetailsFromThirdParty", wrongAmount.Reference).Return(remoteRecord(wrongAmount, 75, constants.PartnerEventCompleted), nil)
+		mockExternal.On("FetchTransactionDetailsFromThirdParty", wrongStatus.Reference).Return(remoteRecord(wrongStatus, 30, constants.PartnerEventCompleted), nil)
+		mockExternal.On("FetchTransactionDetailsFromThirdParty", neverSent.Reference).Return(nil, constants.ErrThirdPartyTransactionNotFound)
+
+		report, err := engine.RunAgainstPartner(from, to)
+
+		assert.NoError(t, err)
+		assert.Equal(t, constants.ReconciliationCompleted, report.Status)
+		// transfer legs never leave the bank and are not reconciled
+		assert.Len(t, report.Items, 5)
+		assert.Equal(t, map[string]string{
+			matched.Reference:     constants.ReconciliationMatched,
+			missing.Reference:     constants.ReconciliationMissingRemote,
+			wrongAmount.Reference: constants.ReconciliationAmountMismatch,
+			wrongStatus.Reference: constants.ReconciliationStatusMismatch,
+			neverSent.Reference:   constants.ReconciliationMatched,
+		}, results(report))
+		assert.Equal(t, 2, report.Matched)
+		assert.Equal(t, 1, report.MissingRemote)
+		assert.Equal(t, 1, report.AmountMismatch)
+		assert.Equal(t, 1, report.StatusMismatch)
+	})
+
+	t.Run("an imported ledger finds transactions missing locally", func(t *testing.T) {
+		repo := newTestRepository(t)
+		engine := reconciliation.NewEngine(repo.DB, new(mocks.MockExternal))
+		matched := createTransaction(t, repo, 100, constants.SUCCESS)
+		pending := createTransaction(t, repo, 40, "pending")
+		records := []*dto.ForwardTransactionDTO{
+			remoteRecord(matched, 100, ""),
+			remoteRecord(pending, 40, constants.PartnerEventCompleted),
+			{Reference: "TRX-partner-only", AccountID: 1, Amount: decimal.NewFromInt(60), Currency: "NGN"},
+		}
+
+		report, err := engine.RunAgainstImport(from, to, records)
+
+		assert.NoError(t, err)
+		assert.Equal(t, constants.ReconciliationSourceImport, report.Source)
+		assert.Equal(t, map[string]string{
+			matched.Reference:  constants.ReconciliationMatched,
+			pending.Reference:  constants.ReconciliationStatusMismatch,
+			"TRX-partner-only": constants.ReconciliationMissingLocal,
+		}, results(report))
+		assert.Equal(t, 1, report.MissingLocal)
+	})
+
+	t.Run("reports are persisted with their items", func(t *testing.T) {
+		repo := newTestRepository(t)
+		engine := reconciliation.NewEngine(repo.DB, new(mocks.MockExternal))
+		transaction := createTransaction(t, repo, 100, constants.SUCCESS)
+		created, _ := engine.RunAgainstImport(from, to, []*dto.ForwardTransactionDTO{remoteRecord(transaction, 90, "")})
+
+		report, err := engine.FetchReport(created.ID)
+
+		assert.NoError(t, err)
+		assert.Len(t, report.Items, 1)
+		assert.Equal(t, constants.ReconciliationAmountMismatch, report.Items[0].Result)
+		assert.True(t, report.Items[0].LocalAmount.Equal(decimal.NewFromInt(100)))
+		assert.True(t, report.Items[0].RemoteAmount.Equal(decimal.NewFromInt(90)))
+		_, err = engine.FetchReport(created.ID + 1)
+		assert.ErrorIs(t, err, reconciliation.ErrReportNotFound)
+	})
+
+	t.Run("a partner failure fails the run instead of reporting partial results", func(t *testing.T) {
+		repo := newTestRepository(t)
+		mockExternal := new(mocks.MockExternal)
+		engine := reconciliation.NewEngine(repo.DB, mockExternal)
+		transaction := createTransaction(t, repo, 100, constants.SUCCESS)
+		mockExternal.On("FetchTransactionDetailsFromThirdParty", transaction.Reference).Return(nil, constants.ErrThirdPartyUnavailable)
+
+		report, err := engine.RunAgainstPartner(from, to)
+
+		assert.ErrorIs(t, err, constants.ErrThirdPartyUnavailable)
+		assert.Equal(t, constants.ReconciliationFailed, report.Status)
+		stored, _ := engine.FetchReport(report.ID)
+		assert.Equal(t, constants.ReconciliationFailed, stored.Status)
+		assert.Empty(t, stored.Items)
+	})
+
+	t.Run("window must end after it starts", func(t *testing.T) {
+		repo := newTestRepository(t)
+		engine := reconciliation.NewEngine(repo.DB, new(mocks.MockExternal))
+
+		_, err := engine.RunAgainstPartner(to, from)
+
+		assert.ErrorIs(t, err, reconciliation.ErrInvalidWindow)
+	})
+}
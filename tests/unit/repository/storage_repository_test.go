@@ -0,0 +1,745 @@
+package repository_test
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/midedickson/simple-banking-app/constants"
+	"github.com/midedickson/simple-banking-app/dto"
+	"github.com/midedickson/simple-banking-app/fx"
+	"github.com/midedickson/simple-banking-app/ledger"
+	"github.com/midedickson/simple-banking-app/models"
+	"github.com/midedickson/simple-banking-app/repository"
+	"github.com/midedickson/simple-banking-app/utils"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func newTestRepository(t *testing.T) *repository.StorageRepository {
+	db, err := gorm.Open(sqlite.Open(fmt.Sprintf("file:%s?mode=memory&cache=shared", t.Name())), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&models.Transaction{}, &models.UserAccount{}, &models.JournalEntry{}, &models.Posting{}, &models.OutboxEntry{}, &models.WebhookEvent{}, &models.Hold{}, &models.FXQuote{}); err != nil {
+		t.Fatal(err)
+	}
+	repo := repository.NewStorageRepository(db)
+	err = repo.SeedUserAccounts([]*models.UserAccount{
+		{ID: 1, Balance: decimal.NewFromFloat(400.0)},
+		{ID: 2, Balance: decimal.NewFromFloat(400.0)},
+		{ID: 3, Balance: decimal.NewFromFloat(400.0), Currency: "USD"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return repo
+}
+
+func TestSettleTransaction(t *testing.T) {
+	t.Run("credit is persisted with the transaction", func(t *testing.T) {
+		repo := newTestRepository(t)
+		transaction, err := repo.CreateTransaction(&dto.CreateDBTransactionDTO{AccountID: 1, Amount: decimal.NewFromInt(100), Direction: constants.DirectionCredit})
+		assert.NoError(t, err)
+
+		err = repo.SettleTransaction(transaction)
+
+		assert.NoError(t, err)
+		assert.True(t, repo.FindAccountById(1).Balance.Equal(decimal.NewFromFloat(500.0)))
+		assert.Equal(t, constants.SUCCESS, repo.FetchTransactionDetailsByReference(transaction.Reference).Status)
+		ledgerBalance, _ := ledger.Balance(repo.DB, ledger.UserAccount(1), "NGN")
+		assert.True(t, ledgerBalance.Equal(decimal.NewFromFloat(500.0)))
+	})
+
+	t.Run("transaction is queued for delivery with its outbox entry", func(t *testing.T) {
+		repo := newTestRepository(t)
+
+		transaction, err := repo.CreateTransaction(&dto.CreateDBTransactionDTO{AccountID: 1, Amount: decimal.NewFromInt(100), Direction: constants.DirectionCredit})
+
+		assert.NoError(t, err)
+		var entry models.OutboxEntry
+		assert.NoError(t, repo.DB.Where("transaction_id = ?", transaction.ID).First(&entry).Error)
+		assert.Equal(t, transaction.Reference, entry.Reference)
+		assert.Equal(t, constants.OutboxPending, entry.Status)
+	})
+
+	t.Run("a transaction settles only once", func(t *testing.T) {
+		repo := newTestRepository(t)
+		transaction, _ := repo.CreateTransaction(&dto.CreateDBTransactionDTO{AccountID: 1, Amount: decimal.NewFromInt(100), Direction: constants.DirectionCredit})
+		assert.NoError(t, repo.SettleTransaction(transaction))
+
+		stale := *transaction
+		stale.Status = "pending"
+		err := repo.SettleTransaction(&stale)
+
+		assert.ErrorIs(t, err, constants.ErrTransactionNotPending)
+		assert.True(t, repo.FindAccountById(1).Balance.Equal(decimal.NewFromInt(500)))
+	})
+
+	t.Run("debit the available balance cannot cover is refused", func(t *testing.T) {
+		repo := newTestRepository(t)
+
+		_, err := repo.CreateTransaction(&dto.CreateDBTransactionDTO{AccountID: 1, Amount: decimal.NewFromInt(500), Direction: constants.DirectionDebit})
+
+		assert.ErrorIs(t, err, constants.ErrInsufficientFunds)
+		account := repo.FindAccountById(1)
+		assert.True(t, account.Balance.Equal(decimal.NewFromFloat(400.0)))
+		assert.True(t, account.Held.IsZero())
+		var count int64
+		repo.DB.Model(&models.Transaction{}).Count(&count)
+		assert.Zero(t, count)
+		repo.DB.Model(&models.OutboxEntry{}).Count(&count)
+		assert.Zero(t, count)
+	})
+
+	t.Run("concurrent debits cannot both be accepted for the same funds", func(t *testing.T) {
+		repo := newTestRepository(t)
+		errs := make(chan error, 2)
+		var wg sync.WaitGroup
+		for i := 0; i < 2; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_, err := repo.CreateTransaction(&dto.CreateDBTransactionDTO{AccountID: 1, Amount: decimal.NewFromInt(300), Direction: constants.DirectionDebit})
+				errs <- err
+			}()
+		}
+		wg.Wait()
+		close(errs)
+
+		accepted, refused := 0, 0
+		for err := range errs {
+			if err == nil {
+				accepted++
+			} else if errors.Is(err, constants.ErrInsufficientFunds) {
+				refused++
+			}
+		}
+		assert.Equal(t, 1, accepted)
+		assert.Equal(t, 1, refused)
+		assert.True(t, repo.FindAccountById(1).Held.Equal(decimal.NewFromInt(300)))
+	})
+
+	t.Run("a pending debit's funds cannot be transferred", func(t *testing.T) {
+		repo := newTestRepository(t)
+		debit, err := repo.CreateTransaction(&dto.CreateDBTransactionDTO{AccountID: 1, Amount: decimal.NewFromInt(300), Direction: constants.DirectionDebit})
+		assert.NoError(t, err)
+
+		_, err = repo.CreateTransfer(&dto.CreateDBTransferDTO{SourceAccountID: 1, DestinationAccountID: 2, Amount: decimal.NewFromInt(200), DestinationAmount: decimal.NewFromInt(200)})
+
+		assert.ErrorIs(t, err, constants.ErrInsufficientFunds)
+		assert.NoError(t, repo.SettleTransaction(debit))
+		account := repo.FindAccountById(1)
+		assert.True(t, account.Balance.Equal(decimal.NewFromInt(100)))
+		assert.True(t, account.Held.IsZero())
+	})
+
+	t.Run("a balance that drifted from the ledger stops the settlement", func(t *testing.T) {
+		repo := newTestRepository(t)
+		transaction, _ := repo.CreateTransaction(&dto.CreateDBTransactionDTO{AccountID: 1, Amount: decimal.NewFromInt(100), Direction: constants.DirectionCredit})
+		repo.DB.Model(&models.UserAccount{}).Where("id = ?", 1).Update("balance", decimal.NewFromInt(450))
+
+		err := repo.SettleTransaction(transaction)
+
+		assert.ErrorIs(t, err, constants.ErrBalanceDrift)
+		assert.True(t, repo.FindAccountById(1).Balance.Equal(decimal.NewFromInt(450)))
+		assert.Equal(t, "pending", repo.FetchTransactionDetailsByReference(transaction.Reference).Status)
+	})
+
+	t.Run("amounts are stored exactly", func(t *testing.T) {
+		repo := newTestRepository(t)
+		balance, _ := decimal.NewFromString("12345678901234.567")
+		assert.NoError(t, repo.SeedUserAccounts([]*models.UserAccount{{ID: 4, Balance: balance, Currency: "KWD"}}))
+		amount, _ := decimal.NewFromString("0.001")
+		transaction, _ := repo.CreateTransaction(&dto.CreateDBTransactionDTO{AccountID: 4, Amount: amount, Currency: "KWD", Direction: constants.DirectionCredit})
+
+		assert.NoError(t, repo.SettleTransaction(transaction))
+
+		expected, _ := decimal.NewFromString("12345678901234.568")
+		assert.True(t, repo.FindAccountById(4).Balance.Equal(expected), repo.FindAccountById(4).Balance.String())
+		assert.True(t, repo.FetchTransactionDetailsByReference(transaction.Reference).Amount.Equal(amount))
+	})
+
+	t.Run("seeding keeps existing balances", func(t *testing.T) {
+		repo := newTestRepository(t)
+		transaction, _ := repo.CreateTransaction(&dto.CreateDBTransactionDTO{AccountID: 1, Amount: decimal.NewFromInt(50), Direction: constants.DirectionDebit})
+		assert.NoError(t, repo.SettleTransaction(transaction))
+
+		err := repo.SeedUserAccounts([]*models.UserAccount{{ID: 1, Balance: decimal.NewFromFloat(400.0)}})
+
+		assert.NoError(t, err)
+		assert.True(t, repo.FindAccountById(1).Balance.Equal(decimal.NewFromFloat(350.0)))
+	})
+}
+
+func TestCreateTransfer(t *testing.T) {
+	t.Run("both legs share a transfer ID", func(t *testing.T) {
+		repo := newTestRepository(t)
+
+		transfer, err := repo.CreateTransfer(&dto.CreateDBTransferDTO{SourceAccountID: 1, DestinationAccountID: 2, Amount: decimal.NewFromInt(150), DestinationAmount: decimal.NewFromInt(150), IdempotencyKey: "transfer-key"})
+
+		assert.NoError(t, err)
+		legs, _ := repo.FetchTransactionsByIdempotencyKey("transfer-key")
+		assert.Len(t, legs, 2)
+		assert.Equal(t, transfer.TransferID, transfer.Debit.TransferID)
+		assert.Equal(t, transfer.TransferID, transfer.Credit.TransferID)
+		assert.True(t, repo.FindAccountById(1).Balance.Equal(decimal.NewFromFloat(250.0)))
+		assert.True(t, repo.FindAccountById(2).Balance.Equal(decimal.NewFromFloat(550.0)))
+		ledgerBalance, _ := ledger.Balance(repo.DB, ledger.UserAccount(2), "NGN")
+		assert.True(t, ledgerBalance.Equal(decimal.NewFromFloat(550.0)))
+	})
+
+	t.Run("failed transfer changes neither account", func(t *testing.T) {
+		repo := newTestRepository(t)
+
+		_, err := repo.CreateTransfer(&dto.CreateDBTransferDTO{SourceAccountID: 1, DestinationAccountID: 2, Amount: decimal.NewFromInt(500), DestinationAmount: decimal.NewFromInt(500)})
+
+		assert.ErrorIs(t, err, constants.ErrInsufficientFunds)
+		assert.True(t, repo.FindAccountById(1).Balance.Equal(decimal.NewFromFloat(400.0)))
+		assert.True(t, repo.FindAccountById(2).Balance.Equal(decimal.NewFromFloat(400.0)))
+		transactions, _ := repo.FetchRecentTransactionsByAccountID(2, 10)
+		assert.Empty(t, transactions)
+	})
+
+	t.Run("conversion records the rate and both amounts", func(t *testing.T) {
+		repo := newTestRepository(t)
+		rate := decimal.RequireFromString("0.5")
+		quote := newQuote(t, repo, "NGN", "USD")
+
+		transfer, err := repo.CreateTransfer(&dto.CreateDBTransferDTO{
+			SourceAccountID:      1,
+			DestinationAccountID: 3,
+			Amount:               decimal.NewFromInt(100),
+			DestinationAmount:    decimal.NewFromInt(50),
+			FXRate:               &rate,
+			QuoteID:              quote.ID,
+		})
+
+		assert.NoError(t, err)
+		assert.True(t, transfer.Credit.FXRate.Equal(rate))
+		assert.True(t, transfer.Debit.CounterAmount.Equal(decimal.NewFromInt(50)))
+		assert.Equal(t, "USD", transfer.Debit.CounterCurrency)
+		assert.True(t, repo.FindAccountById(1).Balance.Equal(decimal.NewFromInt(300)))
+		assert.True(t, repo.FindAccountById(3).Balance.Equal(decimal.NewFromInt(450)))
+		ngnTrialBalance, _ := ledger.TrialBalance(repo.DB, "NGN")
+		usdTrialBalance, _ := ledger.TrialBalance(repo.DB, "USD")
+		assert.True(t, ngnTrialBalance.IsZero())
+		assert.True(t, usdTrialBalance.IsZero())
+	})
+
+	t.Run("conversion uses up its quote", func(t *testing.T) {
+		repo := newTestRepository(t)
+		quote := newQuote(t, repo, "NGN", "USD")
+		createTransferDTO := &dto.CreateDBTransferDTO{
+			SourceAccountID:      1,
+			DestinationAccountID: 3,
+			Amount:               decimal.NewFromInt(100),
+			DestinationAmount:    decimal.NewFromInt(50),
+			FXRate:               &quote.Rate,
+			QuoteID:              quote.ID,
+		}
+
+		transfer, err := repo.CreateTransfer(createTransferDTO)
+
+		assert.NoError(t, err)
+		var stored models.FXQuote
+		repo.DB.First(&stored, "id = ?", quote.ID)
+		assert.NotNil(t, stored.ConsumedAt)
+		assert.Equal(t, transfer.TransferID, stored.TransferID)
+		_, err = repo.CreateTransfer(createTransferDTO)
+		assert.ErrorIs(t, err, constants.ErrQuoteUsed)
+		assert.True(t, repo.FindAccountById(1).Balance.Equal(decimal.NewFromInt(300)))
+	})
+
+	t.Run("failed conversion leaves its quote usable", func(t *testing.T) {
+		repo := newTestRepository(t)
+		quoter := fx.NewQuoter(repo.DB, fx.NewStaticRateProvider(map[string]decimal.Decimal{"NGN/USD": decimal.RequireFromString("0.5")}), decimal.Zero, time.Minute)
+		quote, _ := quoter.NewQuote("NGN", "USD")
+
+		_, err := repo.CreateTransfer(&dto.CreateDBTransferDTO{
+			SourceAccountID:      1,
+			DestinationAccountID: 3,
+			Amount:               decimal.NewFromInt(500),
+			DestinationAmount:    decimal.NewFromInt(250),
+			FXRate:               &quote.Rate,
+			QuoteID:              quote.ID,
+		})
+
+		assert.ErrorIs(t, err, constants.ErrInsufficientFunds)
+		_, err = quoter.FetchQuote(quote.ID)
+		assert.NoError(t, err)
+	})
+
+	t.Run("held funds cannot be transferred", func(t *testing.T) {
+		repo := newTestRepository(t)
+		_, err := repo.AuthorizeHold(&dto.CreateDBHoldDTO{AccountID: 1, Amount: decimal.NewFromInt(400), Currency: "NGN", ExpiresAt: time.Now().Add(time.Hour)})
+		assert.NoError(t, err)
+
+		_, err = repo.CreateTransfer(&dto.CreateDBTransferDTO{SourceAccountID: 1, DestinationAccountID: 2, Amount: decimal.NewFromInt(400), DestinationAmount: decimal.NewFromInt(400)})
+
+		assert.ErrorIs(t, err, constants.ErrInsufficientFunds)
+		account := repo.FindAccountById(1)
+		assert.True(t, account.Balance.Equal(decimal.NewFromInt(400)))
+		assert.True(t, account.AvailableBalance().IsZero())
+	})
+
+	t.Run("accounts in different currencies need a rate", func(t *testing.T) {
+		repo := newTestRepository(t)
+
+		_, err := repo.CreateTransfer(&dto.CreateDBTransferDTO{SourceAccountID: 1, DestinationAccountID: 3, Amount: decimal.NewFromInt(100), DestinationAmount: decimal.NewFromInt(100)})
+
+		assert.ErrorIs(t, err, constants.ErrCurrencyMismatch)
+		assert.True(t, repo.FindAccountById(3).Balance.Equal(decimal.NewFromFloat(400.0)))
+	})
+
+	t.Run("conversion needs a quote for its currencies and rate", func(t *testing.T) {
+		repo := newTestRepository(t)
+		rate := decimal.RequireFromString("0.5")
+		transferDTO := func(quoteID string, rate decimal.Decimal) *dto.CreateDBTransferDTO {
+			return &dto.CreateDBTransferDTO{SourceAccountID: 1, DestinationAccountID: 3, Amount: decimal.NewFromInt(100), DestinationAmount: decimal.NewFromInt(50), FXRate: &rate, QuoteID: quoteID}
+		}
+
+		_, err := repo.CreateTransfer(transferDTO("", rate))
+		assert.ErrorIs(t, err, constants.ErrQuoteNotFound)
+		_, err = repo.CreateTransfer(transferDTO(newQuote(t, repo, "USD", "NGN").ID, rate))
+		assert.ErrorIs(t, err, constants.ErrQuoteMismatch)
+		_, err = repo.CreateTransfer(transferDTO(newQuote(t, repo, "NGN", "USD").ID, decimal.RequireFromString("0.6")))
+		assert.ErrorIs(t, err, constants.ErrQuoteMismatch)
+		assert.True(t, repo.FindAccountById(1).Balance.Equal(decimal.NewFromFloat(400.0)))
+		assert.True(t, repo.FindAccountById(3).Balance.Equal(decimal.NewFromFloat(400.0)))
+	})
+}
+
+// issues a quote at 0.5 USD per NGN, or its inverse
+func newQuote(t *testing.T, repo *repository.StorageRepository, from string, to string) *fx.Quote {
+	quoter := fx.NewQuoter(repo.DB, fx.NewStaticRateProvider(map[string]decimal.Decimal{"NGN/USD": decimal.RequireFromString("0.5")}), decimal.Zero, time.Minute)
+	quote, err := quoter.NewQuote(from, to)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return quote
+}
+
+func TestApplyWebhookEvent(t *testing.T) {
+	t.Run("completed event settles the transaction once", func(t *testing.T) {
+		repo := newTestRepository(t)
+		transaction, _ := repo.CreateTransaction(&dto.CreateDBTransactionDTO{AccountID: 1, Amount: decimal.NewFromInt(100), Direction: constants.DirectionCredit})
+
+		settled, err := repo.ApplyWebhookEvent(&models.WebhookEvent{EventID: "evt-1", Reference: transaction.Reference, Status: constants.PartnerEventCompleted, ReceivedAt: time.Now()})
+
+		assert.NoError(t, err)
+		assert.Equal(t, constants.SUCCESS, settled.Status)
+		assert.True(t, repo.FindAccountById(1).Balance.Equal(decimal.NewFromInt(500)))
+
+		_, err = repo.ApplyWebhookEvent(&models.WebhookEvent{EventID: "evt-1", Reference: transaction.Reference, Status: constants.PartnerEventCompleted, ReceivedAt: time.Now()})
+
+		assert.ErrorIs(t, err, constants.ErrDuplicateWebhookEvent)
+		assert.True(t, repo.FindAccountById(1).Balance.Equal(decimal.NewFromInt(500)))
+	})
+
+	t.Run("failed event fails the transaction without moving funds", func(t *testing.T) {
+		repo := newTestRepository(t)
+		transaction, _ := repo.CreateTransaction(&dto.CreateDBTransactionDTO{AccountID: 1, Amount: decimal.NewFromInt(100), Direction: constants.DirectionDebit})
+
+		failed, err := repo.ApplyWebhookEvent(&models.WebhookEvent{EventID: "evt-2", Reference: transaction.Reference, Status: constants.PartnerEventFailed, ReceivedAt: time.Now()})
+
+		assert.NoError(t, err)
+		assert.Equal(t, constants.FAILED, failed.Status)
+		assert.Equal(t, constants.FAILED, repo.FetchTransactionDetailsByReference(transaction.Reference).Status)
+		assert.True(t, repo.FindAccountById(1).Balance.Equal(decimal.NewFromInt(400)))
+	})
+
+	t.Run("a late event does not change a settled transaction", func(t *testing.T) {
+		repo := newTestRepository(t)
+		transaction, _ := repo.CreateTransaction(&dto.CreateDBTransactionDTO{AccountID: 1, Amount: decimal.NewFromInt(100), Direction: constants.DirectionCredit})
+		repo.ApplyWebhookEvent(&models.WebhookEvent{EventID: "evt-3", Reference: transaction.Reference, Status: constants.PartnerEventCompleted, ReceivedAt: time.Now()})
+
+		_, err := repo.ApplyWebhookEvent(&models.WebhookEvent{EventID: "evt-4", Reference: transaction.Reference, Status: constants.PartnerEventFailed, ReceivedAt: time.Now()})
+
+		assert.NoError(t, err)
+		assert.Equal(t, constants.SUCCESS, repo.FetchTransactionDetailsByReference(transaction.Reference).Status)
+	})
+
+	t.Run("unknown reference records nothing", func(t *testing.T) {
+		repo := newTestRepository(t)
+
+		_, err := repo.ApplyWebhookEvent(&models.WebhookEvent{EventID: "evt-5", Reference: "TRX-unknown", Status: constants.PartnerEventCompleted, ReceivedAt: time.Now()})
+
+		assert.ErrorIs(t, err, constants.ErrTransactionNotFound)
+		var count int64
+		repo.DB.Model(&models.WebhookEvent{}).Count(&count)
+		assert.Zero(t, count)
+	})
+}
+
+func TestCreateReversal(t *testing.T) {
+	settledTransaction := func(t *testing.T, repo *repository.StorageRepository, amount int64, direction string) *models.Transaction {
+		transaction, err := repo.CreateTransaction(&dto.CreateDBTransactionDTO{AccountID: 1, Amount: decimal.NewFromInt(amount), Direction: direction, Currency: "NGN"})
+		assert.NoError(t, err)
+		assert.NoError(t, repo.SettleTransaction(transaction))
+		return transaction
+	}
+	amount := func(value int64) *decimal.Decimal {
+		d := decimal.NewFromInt(value)
+		return &d
+	}
+
+	t.Run("refunding a debit credits the account once settled", func(t *testing.T) {
+		repo := newTestRepository(t)
+		debit := settledTransaction(t, repo, 100, constants.DirectionDebit)
+
+		reversal, err := repo.CreateReversal(&dto.CreateDBReversalDTO{Reference: debit.Reference, Amount: amount(40)})
+
+		assert.NoError(t, err)
+		assert.Equal(t, debit.Reference, reversal.ReversalOf)
+		assert.Equal(t, constants.DirectionCredit, reversal.Direction)
+		assert.Equal(t, "pending", reversal.Status)
+		var entry models.OutboxEntry
+		assert.NoError(t, repo.DB.Where("transaction_id = ?", reversal.ID).First(&entry).Error)
+
+		assert.NoError(t, repo.SettleTransaction(reversal))
+		assert.True(t, repo.FindAccountById(1).Balance.Equal(decimal.NewFromInt(340)))
+	})
+
+	t.Run("reversals never exceed the original amount", func(t *testing.T) {
+		repo := newTestRepository(t)
+		debit := settledTransaction(t, repo, 100, constants.DirectionDebit)
+		_, err := repo.CreateReversal(&dto.CreateDBReversalDTO{Reference: debit.Reference, Amount: amount(60)})
+		assert.NoError(t, err)
+
+		_, err = repo.CreateReversal(&dto.CreateDBReversalDTO{Reference: debit.Reference, Amount: amount(50)})
+		assert.ErrorIs(t, err, constants.ErrReversalExceedsAmount)
+
+		// without an amount the rest is reversed
+		rest, err := repo.CreateReversal(&dto.CreateDBReversalDTO{Reference: debit.Reference})
+		assert.NoError(t, err)
+		assert.True(t, rest.Amount.Equal(decimal.NewFromInt(40)))
+
+		_, err = repo.CreateReversal(&dto.CreateDBReversalDTO{Reference: debit.Reference})
+		assert.ErrorIs(t, err, constants.ErrReversalExceedsAmount)
+	})
+
+	t.Run("a failed reversal frees its amount", func(t *testing.T) {
+		repo := newTestRepository(t)
+		debit := settledTransaction(t, repo, 100, constants.DirectionDebit)
+		reversal, _ := repo.CreateReversal(&dto.CreateDBReversalDTO{Reference: debit.Reference})
+		repo.UpdateTransactionStatus(reversal, constants.FAILED)
+
+		again, err := repo.CreateReversal(&dto.CreateDBReversalDTO{Reference: debit.Reference})
+
+		assert.NoError(t, err)
+		assert.True(t, again.Amount.Equal(decimal.NewFromInt(100)))
+	})
+
+	t.Run("reversing a credit needs the funds", func(t *testing.T) {
+		repo := newTestRepository(t)
+		credit := settledTransaction(t, repo, 100, constants.DirectionCredit)
+		settledTransaction(t, repo, 450, constants.DirectionDebit)
+
+		_, err := repo.CreateReversal(&dto.CreateDBReversalDTO{Reference: credit.Reference})
+
+		assert.ErrorIs(t, err, constants.ErrInsufficientFunds)
+	})
+
+	t.Run("reversing a credit holds its amount until the reversal settles", func(t *testing.T) {
+		repo := newTestRepository(t)
+		credit := settledTransaction(t, repo, 100, constants.DirectionCredit)
+		reversal, err := repo.CreateReversal(&dto.CreateDBReversalDTO{Reference: credit.Reference})
+		assert.NoError(t, err)
+		assert.True(t, repo.FindAccountById(1).Held.Equal(decimal.NewFromInt(100)))
+
+		_, err = repo.CreateTransfer(&dto.CreateDBTransferDTO{SourceAccountID: 1, DestinationAccountID: 2, Amount: decimal.NewFromInt(450), DestinationAmount: decimal.NewFromInt(450)})
+
+		assert.ErrorIs(t, err, constants.ErrInsufficientFunds)
+		assert.NoError(t, repo.SettleTransaction(reversal))
+		account := repo.FindAccountById(1)
+		assert.True(t, account.Balance.Equal(decimal.NewFromInt(400)))
+		assert.True(t, account.Held.IsZero())
+	})
+
+	t.Run("only successful credits and debits can be reversed", func(t *testing.T) {
+		repo := newTestRepository(t)
+		pending, _ := repo.CreateTransaction(&dto.CreateDBTransactionDTO{AccountID: 1, Amount: decimal.NewFromInt(100), Direction: constants.DirectionDebit})
+		transfer, _ := repo.CreateTransfer(&dto.CreateDBTransferDTO{SourceAccountID: 1, DestinationAccountID: 2, Amount: decimal.NewFromInt(10), DestinationAmount: decimal.NewFromInt(10)})
+		debit := settledTransaction(t, repo, 100, constants.DirectionDebit)
+		reversal, _ := repo.CreateReversal(&dto.CreateDBReversalDTO{Reference: debit.Reference})
+		repo.SettleTransaction(reversal)
+
+		for _, reference := range []string{pending.Reference, transfer.Debit.Reference, reversal.Reference} {
+			_, err := repo.CreateReversal(&dto.CreateDBReversalDTO{Reference: reference})
+			assert.ErrorIs(t, err, constants.ErrTransactionNotReversible)
+		}
+		_, err := repo.CreateReversal(&dto.CreateDBReversalDTO{Reference: "TRX-unknown"})
+		assert.ErrorIs(t, err, constants.ErrTransactionNotFound)
+	})
+}
+
+func TestHolds(t *testing.T) {
+	authorize := func(t *testing.T, repo *repository.StorageRepository, amount int64, ttl time.Duration) *dto.HoldDTO {
+		held, err := repo.AuthorizeHold(&dto.CreateDBHoldDTO{AccountID: 1, Amount: decimal.NewFromInt(amount), Currency: "NGN", ExpiresAt: time.Now().Add(ttl), IdempotencyKey: "authorize-key"})
+		assert.NoError(t, err)
+		return held
+	}
+
+	t.Run("a hold lowers the available balance but not the ledger balance", func(t *testing.T) {
+		repo := newTestRepository(t)
+
+		held := authorize(t, repo, 150, time.Hour)
+
+		assert.Equal(t, constants.HoldActive, held.Hold.Status)
+		assert.Equal(t, constants.DirectionAuthorization, held.Transaction.Direction)
+		assert.Equal(t, held.Hold.Reference, held.Transaction.HoldReference)
+		account := repo.FindAccountById(1)
+		assert.True(t, account.Balance.Equal(decimal.NewFromInt(400)))
+		assert.True(t, account.AvailableBalance().Equal(decimal.NewFromInt(250)))
+		var entries int64
+		repo.DB.Model(&models.OutboxEntry{}).Count(&entries)
+		assert.Zero(t, entries)
+	})
+
+	t.Run("holds cannot exceed the available balance", func(t *testing.T) {
+		repo := newTestRepository(t)
+		authorize(t, repo, 300, time.Hour)
+
+		_, err := repo.AuthorizeHold(&dto.CreateDBHoldDTO{AccountID: 1, Amount: decimal.NewFromInt(150), Currency: "NGN", ExpiresAt: time.Now().Add(time.Hour)})
+
+		assert.ErrorIs(t, err, constants.ErrInsufficientFunds)
+		assert.True(t, repo.FindAccountById(1).Held.Equal(decimal.NewFromInt(300)))
+	})
+
+	t.Run("a partial capture releases the rest and debits once settled", func(t *testing.T) {
+		repo := newTestRepository(t)
+		held := authorize(t, repo, 150, time.Hour)
+		amount := decimal.NewFromInt(100)
+
+		captured, err := repo.CaptureHold(&dto.CaptureDBHoldDTO{Reference: held.Hold.Reference, Amount: &amount, IdempotencyKey: "capture-key"})
+
+		assert.NoError(t, err)
+		assert.Equal(t, constants.HoldCaptured, captured.Hold.Status)
+		assert.True(t, captured.Hold.CapturedAmount.Equal(amount))
+		assert.Equal(t, constants.DirectionDebit, captured.Transaction.Direction)
+		assert.Equal(t, "pending", captured.Transaction.Status)
+		var entry models.OutboxEntry
+		assert.NoError(t, repo.DB.Where("transaction_id = ?", captured.Transaction.ID).First(&entry).Error)
+		// the captured amount stays reserved until its debit settles
+		assert.True(t, repo.FindAccountById(1).Held.Equal(amount))
+
+		assert.NoError(t, repo.SettleTransaction(captured.Transaction))
+		account := repo.FindAccountById(1)
+		assert.True(t, account.Balance.Equal(decimal.NewFromInt(300)))
+		assert.True(t, account.Held.IsZero())
+		assert.True(t, account.AvailableBalance().Equal(decimal.NewFromInt(300)))
+	})
+
+	t.Run("captured funds cannot be spent before the capture settles", func(t *testing.T) {
+		repo := newTestRepository(t)
+		held := authorize(t, repo, 400, time.Hour)
+		captured, err := repo.CaptureHold(&dto.CaptureDBHoldDTO{Reference: held.Hold.Reference})
+		assert.NoError(t, err)
+
+		_, err = repo.CreateTransfer(&dto.CreateDBTransferDTO{SourceAccountID: 1, DestinationAccountID: 2, Amount: decimal.NewFromInt(400), DestinationAmount: decimal.NewFromInt(400)})
+
+		assert.ErrorIs(t, err, constants.ErrInsufficientFunds)
+		assert.NoError(t, repo.SettleTransaction(captured.Transaction))
+		account := repo.FindAccountById(1)
+		assert.True(t, account.Balance.IsZero())
+		assert.True(t, account.Held.IsZero())
+	})
+
+	t.Run("a failed capture releases its amount", func(t *testing.T) {
+		repo := newTestRepository(t)
+		held := authorize(t, repo, 150, time.Hour)
+		captured, err := repo.CaptureHold(&dto.CaptureDBHoldDTO{Reference: held.Hold.Reference})
+		assert.NoError(t, err)
+
+		_, err = repo.ApplyWebhookEvent(&models.WebhookEvent{EventID: "evt-capture", Reference: captured.Transaction.Reference, Status: constants.PartnerEventFailed, ReceivedAt: time.Now()})
+
+		assert.NoError(t, err)
+		account := repo.FindAccountById(1)
+		assert.True(t, account.Balance.Equal(decimal.NewFromInt(400)))
+		assert.True(t, account.Held.IsZero())
+	})
+
+	t.Run("a capture cannot exceed the hold", func(t *testing.T) {
+		repo := newTestRepository(t)
+		held := authorize(t, repo, 150, time.Hour)
+		amount := decimal.NewFromInt(151)
+
+		_, err := repo.CaptureHold(&dto.CaptureDBHoldDTO{Reference: held.Hold.Reference, Amount: &amount})
+
+		assert.ErrorIs(t, err, constants.ErrCaptureExceedsHold)
+		assert.Equal(t, constants.HoldActive, repo.FetchHoldByReference(held.Hold.Reference).Status)
+	})
+
+	t.Run("a voided hold releases its funds and cannot be captured", func(t *testing.T) {
+		repo := newTestRepository(t)
+		held := authorize(t, repo, 150, time.Hour)
+
+		voided, err := repo.VoidHold(held.Hold.Reference, "void-key")
+
+		assert.NoError(t, err)
+		assert.Equal(t, constants.HoldVoided, voided.Hold.Status)
+		assert.Equal(t, constants.DirectionVoid, voided.Transaction.Direction)
+		assert.True(t, repo.FindAccountById(1).AvailableBalance().Equal(decimal.NewFromInt(400)))
+
+		_, err = repo.CaptureHold(&dto.CaptureDBHoldDTO{Reference: held.Hold.Reference})
+		assert.ErrorIs(t, err, constants.ErrHoldNotActive)
+		_, err = repo.VoidHold(held.Hold.Reference, "void-again-key")
+		assert.ErrorIs(t, err, constants.ErrHoldNotActive)
+		assert.True(t, repo.FindAccountById(1).Held.IsZero())
+	})
+
+	t.Run("holds past their expiry are released", func(t *testing.T) {
+		repo := newTestRepository(t)
+		expiring := authorize(t, repo, 100, time.Minute)
+		lasting := authorize(t, repo, 50, time.Hour)
+
+		expired, err := repo.ExpireHolds(time.Now().Add(2 * time.Minute))
+
+		assert.NoError(t, err)
+		assert.Equal(t, 1, expired)
+		assert.Equal(t, constants.HoldExpired, repo.FetchHoldByReference(expiring.Hold.Reference).Status)
+		assert.Equal(t, constants.HoldActive, repo.FetchHoldByReference(lasting.Hold.Reference).Status)
+		assert.True(t, repo.FindAccountById(1).Held.Equal(decimal.NewFromInt(50)))
+		var expiries int64
+		repo.DB.Model(&models.Transaction{}).Where("hold_reference = ? AND direction = ?", expiring.Hold.Reference, constants.DirectionExpiry).Count(&expiries)
+		assert.Equal(t, int64(1), expiries)
+
+		expired, err = repo.ExpireHolds(time.Now().Add(2 * time.Minute))
+		assert.NoError(t, err)
+		assert.Zero(t, expired)
+	})
+
+	t.Run("a hold past its expiry cannot be captured before the expirer gets to it", func(t *testing.T) {
+		repo := newTestRepository(t)
+		held := authorize(t, repo, 100, -time.Second)
+
+		_, err := repo.CaptureHold(&dto.CaptureDBHoldDTO{Reference: held.Hold.Reference})
+
+		assert.ErrorIs(t, err, constants.ErrHoldNotActive)
+	})
+
+	t.Run("hold steps cannot be reversed", func(t *testing.T) {
+		repo := newTestRepository(t)
+		held := authorize(t, repo, 100, time.Hour)
+
+		_, err := repo.CreateReversal(&dto.CreateDBReversalDTO{Reference: held.Transaction.Reference})
+
+		assert.ErrorIs(t, err, constants.ErrTransactionNotReversible)
+	})
+}
+
+func TestFetchTransactionHistory(t *testing.T) {
+	repo := newTestRepository(t)
+	base := time.Now().Add(-time.Hour).Truncate(time.Second)
+	var created []*models.Transaction
+	// the middle three share a creation time, so the ID has to order them
+	offsets := []time.Duration{0, 2 * time.Minute, 2 * time.Minute, 2 * time.Minute, 4 * time.Minute}
+	for i, amount := range []int64{10, 20, 30, 40, 50} {
+		direction := constants.DirectionCredit
+		if i%2 == 1 {
+			direction = constants.DirectionDebit
+		}
+		transaction, err := repo.CreateTransaction(&dto.CreateDBTransactionDTO{AccountID: 1, Amount: decimal.NewFromInt(amount), Direction: direction, Currency: "NGN"})
+		assert.NoError(t, err)
+		createdAt := base.Add(offsets[i])
+		repo.DB.Model(transaction).Update("created_at", createdAt)
+		transaction.CreatedAt = createdAt
+		created = append(created, transaction)
+	}
+	repo.CreateTransaction(&dto.CreateDBTransactionDTO{AccountID: 2, Amount: decimal.NewFromInt(10), Direction: constants.DirectionCredit, Currency: "NGN"})
+	references := func(transactions []*models.Transaction) []string {
+		refs := []string{}
+		for _, transaction := range transactions {
+			refs = append(refs, transaction.Reference)
+		}
+		return refs
+	}
+	// cursors go through their client-facing encoding, as they do between pages
+	after := func(transaction *models.Transaction) *dto.TransactionCursor {
+		cursor, err := utils.DecodeTransactionCursor(utils.EncodeTransactionCursor(dto.TransactionCursor{CreatedAt: transaction.CreatedAt, ID: transaction.ID}))
+		assert.NoError(t, err)
+		return cursor
+	}
+
+	t.Run("pages through the account newest first without overlap", func(t *testing.T) {
+		first, err := repo.FetchTransactionHistory(&dto.TransactionHistoryFilter{AccountID: 1, Limit: 2})
+		assert.NoError(t, err)
+		assert.Equal(t, []string{created[4].Reference, created[3].Reference}, references(first))
+
+		second, err := repo.FetchTransactionHistory(&dto.TransactionHistoryFilter{AccountID: 1, Limit: 2, After: after(first[1])})
+		assert.NoError(t, err)
+		assert.Equal(t, []string{created[2].Reference, created[1].Reference}, references(second))
+
+		third, err := repo.FetchTransactionHistory(&dto.TransactionHistoryFilter{AccountID: 1, Limit: 2, After: after(second[1])})
+		assert.NoError(t, err)
+		assert.Equal(t, []string{created[0].Reference}, references(third))
+	})
+
+	t.Run("pages oldest first", func(t *testing.T) {
+		first, err := repo.FetchTransactionHistory(&dto.TransactionHistoryFilter{AccountID: 1, Limit: 2, Ascending: true})
+		assert.NoError(t, err)
+		assert.Equal(t, []string{created[0].Reference, created[1].Reference}, references(first))
+
+		second, err := repo.FetchTransactionHistory(&dto.TransactionHistoryFilter{AccountID: 1, Limit: 2, Ascending: true, After: after(first[1])})
+		assert.NoError(t, err)
+		assert.Equal(t, []string{created[2].Reference, created[3].Reference}, references(second))
+	})
+
+	t.Run("filters by direction, status, date and amount", func(t *testing.T) {
+		credits, err := repo.FetchTransactionHistory(&dto.TransactionHistoryFilter{AccountID: 1, Direction: constants.DirectionCredit, Limit: 10})
+		assert.NoError(t, err)
+		assert.Equal(t, []string{created[4].Reference, created[2].Reference, created[0].Reference}, references(credits))
+
+		repo.DB.Model(created[1]).Update("status", constants.FAILED)
+		failed, err := repo.FetchTransactionHistory(&dto.TransactionHistoryFilter{AccountID: 1, Status: constants.FAILED, Limit: 10})
+		assert.NoError(t, err)
+		assert.Equal(t, []string{created[1].Reference}, references(failed))
+
+		from, to := base.Add(2*time.Minute), base.Add(4*time.Minute)
+		window, err := repo.FetchTransactionHistory(&dto.TransactionHistoryFilter{AccountID: 1, From: &from, To: &to, Limit: 10})
+		assert.NoError(t, err)
+		assert.Equal(t, []string{created[3].Reference, created[2].Reference, created[1].Reference}, references(window))
+
+		minAmount, maxAmount := decimal.NewFromInt(20), decimal.NewFromInt(40)
+		ranged, err := repo.FetchTransactionHistory(&dto.TransactionHistoryFilter{AccountID: 1, MinAmount: &minAmount, MaxAmount: &maxAmount, Limit: 10})
+		assert.NoError(t, err)
+		assert.Equal(t, []string{created[3].Reference, created[2].Reference, created[1].Reference}, references(ranged))
+	})
+
+	t.Run("amount filters compare every decimal place", func(t *testing.T) {
+		repo := newTestRepository(t)
+		balance := decimal.RequireFromString("99999999999999999.999")
+		assert.NoError(t, repo.SeedUserAccounts([]*models.UserAccount{{ID: 5, Balance: balance, Currency: "KWD"}}))
+		// a float cannot tell these apart
+		lower := decimal.RequireFromString("12345678901234567.891")
+		upper := decimal.RequireFromString("12345678901234567.892")
+		var boundary []*models.Transaction
+		for _, amount := range []decimal.Decimal{lower, upper, decimal.RequireFromString("9.5"), decimal.RequireFromString("10.25")} {
+			transaction, err := repo.CreateTransaction(&dto.CreateDBTransactionDTO{AccountID: 5, Amount: amount, Currency: "KWD", Direction: constants.DirectionCredit})
+			assert.NoError(t, err)
+			boundary = append(boundary, transaction)
+		}
+
+		above, err := repo.FetchTransactionHistory(&dto.TransactionHistoryFilter{AccountID: 5, MinAmount: &upper, Limit: 10})
+		assert.NoError(t, err)
+		assert.Equal(t, []string{boundary[1].Reference}, references(above))
+
+		below, err := repo.FetchTransactionHistory(&dto.TransactionHistoryFilter{AccountID: 5, MaxAmount: &lower, Limit: 10})
+		assert.NoError(t, err)
+		assert.ElementsMatch(t, []string{boundary[0].Reference, boundary[2].Reference, boundary[3].Reference}, references(below))
+
+		// shorter and longer fractions and integer parts still order by value
+		minAmount, maxAmount := decimal.RequireFromString("9.50"), decimal.RequireFromString("10.3")
+		small, err := repo.FetchTransactionHistory(&dto.TransactionHistoryFilter{AccountID: 5, MinAmount: &minAmount, MaxAmount: &maxAmount, Limit: 10})
+		assert.NoError(t, err)
+		assert.ElementsMatch(t, []string{boundary[2].Reference, boundary[3].Reference}, references(small))
+	})
+}
@@ -0,0 +1,185 @@
+package settlement_test
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/midedickson/simple-banking-app/constants"
+	"github.com/midedickson/simple-banking-app/dto"
+	"github.com/midedickson/simple-banking-app/models"
+	"github.com/midedickson/simple-banking-app/repository"
+	"github.com/midedickson/simple-banking-app/settlement"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func newTestRepository(t *testing.T) *repository.StorageRepository {
+	db, err := gorm.Open(sqlite.Open(fmt.Sprintf("file:%s?mode=memory&cache=shared", t.Name())), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.AutoMigrate(&models.Transaction{}, &models.UserAccount{}, &models.JournalEntry{}, &models.Posting{}, &models.OutboxEntry{}, &models.SettlementImport{}, &models.SettlementEntry{}, &models.SuspenseItem{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo := repository.NewStorageRepository(db)
+	if err := repo.SeedUserAccounts([]*models.UserAccount{{ID: 1, Balance: decimal.NewFromInt(400)}}); err != nil {
+		t.Fatal(err)
+	}
+	return repo
+}
+
+func createTransaction(t *testing.T, repo *repository.StorageRepository, amount int64, direction string) *models.Transaction {
+	transaction, err := repo.CreateTransaction(&dto.CreateDBTransactionDTO{AccountID: 1, Amount: decimal.NewFromInt(amount), Direction: direction, Currency: "NGN"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return transaction
+}
+
+func settledTransaction(t *testing.T, repo *repository.StorageRepository, amount int64, direction string) *models.Transaction {
+	transaction := createTransaction(t, repo, amount, direction)
+	if err := repo.SettleTransaction(transaction); err != nil {
+		t.Fatal(err)
+	}
+	return transaction
+}
+
+func reasons(items []*models.SuspenseItem) map[string]string {
+	byReference := map[string]string{}
+	for _, item := range items {
+		byReference[item.Reference] = item.Reason
+	}
+	return byReference
+}
+
+func TestImporter(t *testing.T) {
+	t.Run("matches entries and suspends the rest", func(t *testing.T) {
+		repo := newTestRepository(t)
+		importer := settlement.NewImporter(repo.DB)
+		matched := settledTransaction(t, repo, 100, constants.DirectionCredit)
+		wrongAmount := settledTransaction(t, repo, 70, constants.DirectionCredit)
+		wrongDirection := settledTransaction(t, repo, 30, constants.DirectionCredit)
+		content := fmt.Sprintf("reference,amount,currency,direction\n%s,100,NGN,credit\n%s,75,NGN,credit\n%s,30,NGN,debit\nunknown-ref,10,NGN,credit\n,5,NGN,credit\n%s,100,NGN,credit\n",
+			matched.Reference, wrongAmount.Reference, wrongDirection.Reference, matched.Reference)
+
+		settlementImport, err := importer.Import(constants.SettlementFormatCSV, "statement.csv", []byte(content))
+		assert.NoError(t, err)
+		assert.Equal(t, constants.SettlementImportCompleted, settlementImport.Status)
+		assert.Equal(t, 6, settlementImport.EntryCount)
+		assert.Equal(t, 1, settlementImport.Matched)
+		assert.Equal(t, 5, settlementImport.Suspended)
+		assert.Equal(t, matched.ID, *settlementImport.Entries[0].TransactionID)
+
+		items, err := importer.FetchSuspenseItems(constants.SuspenseOpen)
+		assert.NoError(t, err)
+		assert.Len(t, items, 5)
+		byReference := reasons(items)
+		assert.Equal(t, constants.SuspenseAmountMismatch, byReference[wrongAmount.Reference])
+		assert.Equal(t, constants.SuspenseDirectionMismatch, byReference[wrongDirection.Reference])
+		assert.Equal(t, constants.SuspenseUnknownReference, byReference["unknown-ref"])
+		assert.Equal(t, constants.SuspenseMissingReference, byReference[""])
+		assert.Equal(t, constants.SuspenseDuplicateEntry, byReference[matched.Reference])
+	})
+
+	t.Run("suspends entries for transactions that did not succeed here", func(t *testing.T) {
+		repo := newTestRepository(t)
+		importer := settlement.NewImporter(repo.DB)
+		failed := createTransaction(t, repo, 300, constants.DirectionDebit)
+		repo.DB.Model(failed).Update("status", constants.FAILED)
+		pending := createTransaction(t, repo, 50, constants.DirectionCredit)
+		content := fmt.Sprintf("reference,amount,currency,direction\n%s,300,NGN,debit\n%s,50,NGN,credit\n", failed.Reference, pending.Reference)
+
+		settlementImport, err := importer.Import(constants.SettlementFormatCSV, "", []byte(content))
+
+		assert.NoError(t, err)
+		assert.Equal(t, 0, settlementImport.Matched)
+		assert.Equal(t, 2, settlementImport.Suspended)
+		items, _ := importer.FetchSuspenseItems(constants.SuspenseOpen)
+		byReference := reasons(items)
+		assert.Equal(t, constants.SuspenseStatusMismatch, byReference[failed.Reference])
+		assert.Equal(t, constants.SuspenseStatusMismatch, byReference[pending.Reference])
+	})
+
+	t.Run("imports the same file only once", func(t *testing.T) {
+		repo := newTestRepository(t)
+		importer := settlement.NewImporter(repo.DB)
+		content := []byte("reference,amount,currency\nunknown-ref,10,NGN\n")
+
+		first, err := importer.Import(constants.SettlementFormatCSV, "", content)
+		assert.NoError(t, err)
+		second, err := importer.Import(constants.SettlementFormatCSV, "", content)
+		assert.True(t, errors.Is(err, settlement.ErrDuplicateImport))
+		assert.Equal(t, first.ID, second.ID)
+		items, _ := importer.FetchSuspenseItems("")
+		assert.Len(t, items, 1)
+	})
+
+	t.Run("stores a file that cannot be parsed as failed", func(t *testing.T) {
+		repo := newTestRepository(t)
+		importer := settlement.NewImporter(repo.DB)
+
+		settlementImport, err := importer.Import(constants.SettlementFormatCamt053, "", []byte("<Document>"))
+		assert.True(t, errors.Is(err, settlement.ErrInvalidStatement))
+		assert.Equal(t, constants.SettlementImportFailed, settlementImport.Status)
+		assert.NotEmpty(t, settlementImport.Error)
+		stored, err := importer.FetchImport(settlementImport.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, constants.SettlementImportFailed, stored.Status)
+	})
+
+	t.Run("re-runs against the stored file", func(t *testing.T) {
+		repo := newTestRepository(t)
+		importer := settlement.NewImporter(repo.DB)
+		matched := settledTransaction(t, repo, 100, constants.DirectionCredit)
+		content := fmt.Sprintf("reference,amount,currency\n%s,100,NGN\nlate-ref,40,NGN\nother-ref,20,NGN\n", matched.Reference)
+		settlementImport, err := importer.Import(constants.SettlementFormatCSV, "", []byte(content))
+		assert.NoError(t, err)
+		items, _ := importer.FetchSuspenseItems(constants.SuspenseOpen)
+		assert.Len(t, items, 2)
+		resolved := items[1]
+		_, err = importer.ResolveSuspenseItem(resolved.ID, "refunded by the partner")
+		assert.NoError(t, err)
+
+		// nothing changed, the outcome is the same
+		rerun, err := importer.Rerun(settlementImport.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, 2, rerun.Runs)
+		assert.Equal(t, 1, rerun.Matched)
+		assert.Equal(t, 2, rerun.Suspended)
+		open, _ := importer.FetchSuspenseItems(constants.SuspenseOpen)
+		assert.Len(t, open, 1)
+		assert.Equal(t, "late-ref", open[0].Reference)
+		closed, _ := importer.FetchSuspenseItems(constants.SuspenseResolved)
+		assert.Len(t, closed, 1)
+		assert.Equal(t, "refunded by the partner", closed[0].Note)
+
+		// the missing transaction was booked since, so its entry now matches
+		late := settledTransaction(t, repo, 40, constants.DirectionCredit)
+		repo.DB.Model(late).Update("reference", "late-ref")
+		rerun, err = importer.Rerun(settlementImport.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, 2, rerun.Matched)
+		open, _ = importer.FetchSuspenseItems(constants.SuspenseOpen)
+		assert.Empty(t, open)
+		fetched, err := importer.FetchImport(settlementImport.ID)
+		assert.NoError(t, err)
+		assert.Len(t, fetched.Entries, 3)
+	})
+
+	t.Run("reports unknown imports and suspense items", func(t *testing.T) {
+		repo := newTestRepository(t)
+		importer := settlement.NewImporter(repo.DB)
+
+		_, err := importer.Rerun(42)
+		assert.True(t, errors.Is(err, settlement.ErrImportNotFound))
+		_, err = importer.ResolveSuspenseItem(42, "note")
+		assert.True(t, errors.Is(err, settlement.ErrSuspenseItemNotFound))
+	})
+}
@@ -0,0 +1,97 @@
+package settlement_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/midedickson/simple-banking-app/constants"
+	"github.com/midedickson/simple-banking-app/settlement"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+)
+
+const camt053Statement = `<?xml version="1.0" encoding="UTF-8"?>
+<Document xmlns="urn:iso:std:iso:20022:tech:xsd:camt.053.001.02">
+  <BkToCstmrStmt>
+    <Stmt>
+      <Id>STMT-2024-06-01</Id>
+      <Ntry>
+        <NtryRef>ref-1</NtryRef>
+        <Amt Ccy="NGN">100.00</Amt>
+        <CdtDbtInd>CRDT</CdtDbtInd>
+        <BookgDt><Dt>2024-06-01</Dt></BookgDt>
+      </Ntry>
+      <Ntry>
+        <NtryRef>batch-1</NtryRef>
+        <Amt Ccy="NGN">80.00</Amt>
+        <CdtDbtInd>DBIT</CdtDbtInd>
+        <BookgDt><DtTm>2024-06-01T17:30:00Z</DtTm></BookgDt>
+        <NtryDtls>
+          <TxDtls>
+            <Refs><EndToEndId>ref-2</EndToEndId></Refs>
+            <AmtDtls><TxAmt><Amt Ccy="NGN">30.00</Amt></TxAmt></AmtDtls>
+          </TxDtls>
+          <TxDtls>
+            <Refs><EndToEndId>ref-3</EndToEndId></Refs>
+            <AmtDtls><TxAmt><Amt Ccy="NGN">50.00</Amt></TxAmt></AmtDtls>
+          </TxDtls>
+        </NtryDtls>
+      </Ntry>
+    </Stmt>
+  </BkToCstmrStmt>
+</Document>`
+
+func TestParseCSV(t *testing.T) {
+	t.Run("parses entries with optional columns", func(t *testing.T) {
+		content := "Reference,Amount,Currency,Direction,Booking_Date\nref-1,100.50,ngn,credit,2024-06-01\nref-2,30,NGN,,\n"
+		statement, err := settlement.ParseCSV([]byte(content))
+		assert.NoError(t, err)
+		assert.Len(t, statement.Entries, 2)
+		first := statement.Entries[0]
+		assert.Equal(t, 2, first.Line)
+		assert.Equal(t, "ref-1", first.Reference)
+		assert.True(t, first.Amount.Equal(decimal.RequireFromString("100.50")))
+		assert.Equal(t, "NGN", first.Currency)
+		assert.Equal(t, constants.DirectionCredit, first.Direction)
+		assert.Equal(t, "2024-06-01", first.BookingDate.Format("2006-01-02"))
+		second := statement.Entries[1]
+		assert.Equal(t, 3, second.Line)
+		assert.Empty(t, second.Direction)
+		assert.Nil(t, second.BookingDate)
+	})
+
+	t.Run("rejects a header without the required columns", func(t *testing.T) {
+		_, err := settlement.ParseCSV([]byte("reference,amount\nref-1,100\n"))
+		assert.ErrorContains(t, err, "currency")
+	})
+
+	t.Run("reports the line of an invalid amount", func(t *testing.T) {
+		_, err := settlement.ParseCSV([]byte("reference,amount,currency\nref-1,100,NGN\nref-2,ten,NGN\n"))
+		assert.ErrorContains(t, err, "line 3")
+	})
+}
+
+func TestParseCamt053(t *testing.T) {
+	statement, err := settlement.ParseCamt053([]byte(camt053Statement))
+	assert.NoError(t, err)
+	assert.Equal(t, "STMT-2024-06-01", statement.ID)
+	assert.Len(t, statement.Entries, 3)
+
+	single := statement.Entries[0]
+	assert.Equal(t, "ref-1", single.Reference)
+	assert.Equal(t, constants.DirectionCredit, single.Direction)
+	assert.True(t, single.Amount.Equal(decimal.NewFromInt(100)))
+
+	// a batched entry is split into its transactions, each with its own amount
+	assert.Equal(t, "ref-2", statement.Entries[1].Reference)
+	assert.True(t, statement.Entries[1].Amount.Equal(decimal.NewFromInt(30)))
+	assert.Equal(t, constants.DirectionDebit, statement.Entries[1].Direction)
+	assert.Equal(t, "ref-3", statement.Entries[2].Reference)
+	assert.Equal(t, 3, statement.Entries[2].Line)
+	assert.Equal(t, 17, statement.Entries[2].BookingDate.Hour())
+}
+
+func TestParseUnsupportedFormat(t *testing.T) {
+	_, err := settlement.Parse("mt940", []byte("anything"))
+	assert.True(t, errors.Is(err, settlement.ErrUnsupportedFormat))
+}
@@ -0,0 +1,56 @@
+package webhooks_test
+
+import (
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/midedickson/simple-banking-app/webhooks"
+	"github.com/stretchr/testify/assert"
+)
+
+func signedHeader(secret string, timestamp time.Time, body []byte) http.Header {
+	req, _ := http.NewRequest(http.MethodPost, "/webhooks/partner", nil)
+	webhooks.SignRequest(req, secret, timestamp, body)
+	return req.Header
+}
+
+func TestVerifier(t *testing.T) {
+	verifier := webhooks.NewVerifier("secret", 5*time.Minute)
+	body := []byte(`{"event_id":"evt-1","reference":"TRX-1","status":"completed"}`)
+	now := time.Now()
+
+	t.Run("accepts a signed webhook", func(t *testing.T) {
+		assert.NoError(t, verifier.Verify(signedHeader("secret", now, body), body, now))
+	})
+
+	t.Run("rejects a tampered body", func(t *testing.T) {
+		header := signedHeader("secret", now, body)
+
+		err := verifier.Verify(header, []byte(`{"event_id":"evt-1","reference":"TRX-1","status":"failed"}`), now)
+
+		assert.ErrorIs(t, err, webhooks.ErrInvalidSignature)
+	})
+
+	t.Run("rejects another secret", func(t *testing.T) {
+		assert.ErrorIs(t, verifier.Verify(signedHeader("other", now, body), body, now), webhooks.ErrInvalidSignature)
+	})
+
+	t.Run("rejects a replayed signature under a new timestamp", func(t *testing.T) {
+		header := signedHeader("secret", now.Add(-time.Hour), body)
+		header.Set(webhooks.TimestampHeader, strconv.FormatInt(now.Unix(), 10))
+
+		assert.ErrorIs(t, verifier.Verify(header, body, now), webhooks.ErrInvalidSignature)
+	})
+
+	t.Run("rejects a stale timestamp", func(t *testing.T) {
+		timestamp := now.Add(-10 * time.Minute)
+
+		assert.ErrorIs(t, verifier.Verify(signedHeader("secret", timestamp, body), body, now), webhooks.ErrStaleTimestamp)
+	})
+
+	t.Run("rejects missing headers", func(t *testing.T) {
+		assert.ErrorIs(t, verifier.Verify(http.Header{}, body, now), webhooks.ErrMissingSignature)
+	})
+}
@@ -0,0 +1,41 @@
+package utils
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/midedickson/simple-banking-app/dto"
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// opaque to clients, the creation time and ID of the last transaction on a page
+func EncodeTransactionCursor(cursor dto.TransactionCursor) string {
+	raw := fmt.Sprintf("%s|%d", cursor.CreatedAt.Format(time.RFC3339Nano), cursor.ID)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func DecodeTransactionCursor(encoded string) (*dto.TransactionCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	createdAt, id, ok := strings.Cut(string(raw), "|")
+	if !ok {
+		return nil, ErrInvalidCursor
+	}
+	cursor := &dto.TransactionCursor{}
+	if cursor.CreatedAt, err = time.Parse(time.RFC3339Nano, createdAt); err != nil {
+		return nil, ErrInvalidCursor
+	}
+	parsedID, err := strconv.ParseUint(id, 10, 64)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	cursor.ID = uint(parsedID)
+	return cursor, nil
+}
@@ -27,6 +27,13 @@ func Dispatch409Error(w http.ResponseWriter, msg string, err any) {
 	w.Write(WriteError(msg, err))
 }
 
+// 401 - unauthorized, the request could not be authenticated
+func Dispatch401Error(w http.ResponseWriter, msg string, err any) {
+	AddDefaultHeaders(w)
+	w.WriteHeader(http.StatusUnauthorized)
+	w.Write(WriteError(msg, err))
+}
+
 // 403 - forbidden request, incase of non-authorised request
 func Dispatch403Error(w http.ResponseWriter, msg string, err any) {
 	AddDefaultHeaders(w)
@@ -48,6 +55,20 @@ func Dispatch422Error(w http.ResponseWriter, msg string, err any) {
 	w.Write(WriteError(msg, err))
 }
 
+// 502 - bad gateway, a dependency answered with an error
+func Dispatch502Error(w http.ResponseWriter, msg string, err any) {
+	AddDefaultHeaders(w)
+	w.WriteHeader(http.StatusBadGateway)
+	w.Write(WriteError(msg, err))
+}
+
+// 503 - service unavailable, a dependency is down and the request can be retried later
+func Dispatch503Error(w http.ResponseWriter, msg string, err any) {
+	AddDefaultHeaders(w)
+	w.WriteHeader(http.StatusServiceUnavailable)
+	w.Write(WriteError(msg, err))
+}
+
 // 200 - OK
 func Dispatch200(w http.ResponseWriter, msg string, data any) {
 	AddDefaultHeaders(w)
@@ -55,6 +76,13 @@ func Dispatch200(w http.ResponseWriter, msg string, data any) {
 	w.Write(WriteInfo(msg, data))
 }
 
+// writes an already encoded response body as is
+func DispatchRaw(w http.ResponseWriter, statusCode int, body []byte) {
+	AddDefaultHeaders(w)
+	w.WriteHeader(statusCode)
+	w.Write(body)
+}
+
 func WriteInfo(message string, data any) []byte {
 	response := APIResponse{
 		Success: true,
@@ -0,0 +1,34 @@
+package utils
+
+import (
+	"github.com/midedickson/simple-banking-app/constants"
+	"github.com/midedickson/simple-banking-app/currency"
+	"github.com/shopspring/decimal"
+)
+
+// checks that an amount is positive and has no more than the allowed decimal places
+func ValidateAmount(amount decimal.Decimal, places int32) error {
+	if amount.LessThanOrEqual(decimal.Zero) {
+		return constants.ErrInvalidAmount
+	}
+	if !amount.Equal(amount.Truncate(places)) {
+		return constants.ErrAmountPrecision
+	}
+	return nil
+}
+
+// resolves the currency of a request against the account it targets,
+// an empty requested currency defaults to the account currency
+func ResolveCurrency(requested string, accountCurrency string) (currency.Currency, error) {
+	if requested == "" {
+		requested = accountCurrency
+	}
+	c, ok := currency.Lookup(requested)
+	if !ok {
+		return currency.Currency{}, constants.ErrUnsupportedCurrency
+	}
+	if c.Code != accountCurrency {
+		return currency.Currency{}, constants.ErrCurrencyMismatch
+	}
+	return c, nil
+}
@@ -0,0 +1,67 @@
+package webhooks
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	SignatureHeader = "X-Partner-Signature"
+	TimestampHeader = "X-Partner-Timestamp"
+	signaturePrefix = "sha256="
+)
+
+var ErrMissingSignature = errors.New("webhook signature or timestamp is missing")
+var ErrInvalidSignature = errors.New("webhook signature does not match")
+var ErrStaleTimestamp = errors.New("webhook timestamp is outside the allowed tolerance")
+
+// signs "{unix timestamp}.{body}" with HMAC-SHA256, so a captured body cannot be replayed under a new timestamp
+func Sign(secret string, timestamp time.Time, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp.Unix(), 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return signaturePrefix + hex.EncodeToString(mac.Sum(nil))
+}
+
+// sets the signature and timestamp headers on an outgoing webhook
+func SignRequest(req *http.Request, secret string, timestamp time.Time, body []byte) {
+	req.Header.Set(TimestampHeader, strconv.FormatInt(timestamp.Unix(), 10))
+	req.Header.Set(SignatureHeader, Sign(secret, timestamp, body))
+}
+
+// checks webhooks signed by the partner with a shared secret
+type Verifier struct {
+	secret string
+	// how far the webhook timestamp may be from our clock, in either direction
+	tolerance time.Duration
+}
+
+func NewVerifier(secret string, tolerance time.Duration) *Verifier {
+	return &Verifier{secret: secret, tolerance: tolerance}
+}
+
+func (v *Verifier) Verify(header http.Header, body []byte, now time.Time) error {
+	signature, rawTimestamp := header.Get(SignatureHeader), header.Get(TimestampHeader)
+	if signature == "" || rawTimestamp == "" || !strings.HasPrefix(signature, signaturePrefix) {
+		return ErrMissingSignature
+	}
+	unix, err := strconv.ParseInt(rawTimestamp, 10, 64)
+	if err != nil {
+		return ErrMissingSignature
+	}
+	timestamp := time.Unix(unix, 0)
+	if timestamp.Before(now.Add(-v.tolerance)) || timestamp.After(now.Add(v.tolerance)) {
+		return ErrStaleTimestamp
+	}
+	if !hmac.Equal([]byte(signature), []byte(Sign(v.secret, timestamp, body))) {
+		return ErrInvalidSignature
+	}
+	return nil
+}